@@ -0,0 +1,708 @@
+package fb
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"html"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AnkiImportOptions controls the conversion of an Anki collection to a
+// Package.
+type AnkiImportOptions struct {
+	// BundleID and Owner identify the Bundle created to hold the imported
+	// documents.
+	BundleID string
+	Owner    string
+	// Name is the name given to the bundle.
+	Name string
+}
+
+// ankiCollection holds the raw contents of an Anki collection, as read from
+// an *.apkg file.
+type ankiCollection struct {
+	// Created is the collection's creation time in seconds, and the base
+	// from which review due dates are counted.
+	Created int64
+	// Modified is the collection's modification time in milliseconds.
+	Modified    int64
+	Models      map[string]*ankiModel
+	Decks       map[string]*ankiDeck
+	DeckConfigs map[string]*ankiDeckConfig
+	Notes       []*ankiNote
+	Cards       []*ankiCard
+	Revlog      []*ankiRevlog
+	// Media maps media filenames to their content.
+	Media map[string][]byte
+}
+
+type ankiModel struct {
+	Name      string          `json:"name"`
+	Type      int             `json:"type"`
+	Modified  int64           `json:"mod"`
+	Fields    []*ankiField    `json:"flds"`
+	SortField int             `json:"sortf"`
+	Templates []*ankiTemplate `json:"tmpls"`
+	CSS       string          `json:"css"`
+}
+
+type ankiField struct {
+	Name string `json:"name"`
+	Ord  int    `json:"ord"`
+}
+
+type ankiTemplate struct {
+	Name            string `json:"name"`
+	Ord             int    `json:"ord"`
+	Question        string `json:"qfmt"`
+	Answer          string `json:"afmt"`
+	BrowserQuestion string `json:"bqfmt"`
+	BrowserAnswer   string `json:"bafmt"`
+}
+
+type ankiDeck struct {
+	Name        string `json:"name"`
+	Description string `json:"desc"`
+	Modified    int64  `json:"mod"`
+	Dynamic     int    `json:"dyn"`
+	ConfigID    int64  `json:"conf"`
+}
+
+type ankiDeckConfig struct {
+	Name     string `json:"name"`
+	Modified int64  `json:"mod"`
+	New      struct {
+		PerDay        int       `json:"perDay"`
+		Delays        []float64 `json:"delays"`
+		Ints          []int     `json:"ints"`
+		InitialFactor int       `json:"initialFactor"`
+		Order         int       `json:"order"`
+		Bury          bool      `json:"bury"`
+	} `json:"new"`
+	Rev struct {
+		PerDay int  `json:"perDay"`
+		MaxIvl int  `json:"maxIvl"`
+		Bury   bool `json:"bury"`
+	} `json:"rev"`
+	Lapse struct {
+		Delays      []float64 `json:"delays"`
+		LeechFails  int       `json:"leechFails"`
+		LeechAction int       `json:"leechAction"`
+	} `json:"lapse"`
+}
+
+type ankiNote struct {
+	ID       int64
+	GUID     string
+	ModelID  int64
+	Modified int64
+	Tags     string
+	Fields   string
+}
+
+type ankiCard struct {
+	ID           int64
+	NoteID       int64
+	DeckID       int64
+	Ord          int
+	Modified     int64
+	Type         int
+	Queue        int
+	Due          int64
+	Interval     int64
+	Factor       int
+	Reps         int
+	Lapses       int
+	Left         int
+	OriginalDue  int64
+	OriginalDeck int64
+}
+
+type ankiRevlog struct {
+	ID           int64
+	CardID       int64
+	Ease         int
+	Interval     int64
+	LastInterval int64
+	Factor       int
+	Time         int64
+	Type         int
+}
+
+// Anki card types and queues
+const (
+	ankiTypeNew        = 0
+	ankiTypeLearning   = 1
+	ankiTypeReview     = 2
+	ankiTypeRelearning = 3
+
+	ankiQueueSuspended   = -1
+	ankiQueueUserBuried  = -2
+	ankiQueueSchedBuried = -3
+)
+
+// ankiFieldSeparator separates field values in the flds column of notes.
+const ankiFieldSeparator = "\x1f"
+
+// ankiNamespace is the source namespace from which the IDs of imported notes
+// and cards are derived. See DeriveDocID.
+const ankiNamespace = "anki"
+
+// ankiMediaTypes maps the extensions of media files commonly found in Anki
+// decks to their content types.
+var ankiMediaTypes = map[string]string{
+	".css":  "text/css",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".m4a":  "audio/mp4",
+	".mp3":  "audio/mpeg",
+	".mp4":  "video/mp4",
+	".ogg":  "audio/ogg",
+	".otf":  "font/otf",
+	".png":  "image/png",
+	".svg":  "image/svg+xml",
+	".ttf":  "font/ttf",
+	".wav":  "audio/wav",
+	".webm": "video/webm",
+	".webp": "image/webp",
+	".woff": "font/woff",
+}
+
+var ankiMediaRE = regexp.MustCompile(`(?i)<img[^>]*\ssrc=["']?([^"'>\s]+)|\[sound:([^\]]+)\]|url\(["']?([^"')]+)`)
+
+// ankiMediaRefs returns the names of the media files referenced by text.
+func ankiMediaRefs(text string) []string {
+	var refs []string
+	for _, match := range ankiMediaRE.FindAllStringSubmatch(text, -1) {
+		for _, ref := range match[1:] {
+			if ref != "" {
+				refs = append(refs, html.UnescapeString(ref))
+			}
+		}
+	}
+	return refs
+}
+
+func ankiMediaType(name string) string {
+	if ctype, ok := ankiMediaTypes[strings.ToLower(path.Ext(name))]; ok {
+		return ctype
+	}
+	return "application/octet-stream"
+}
+
+// ankiTime converts an Anki ID, which is typically the creation time in
+// milliseconds, to a time. IDs too small to be timestamps, such as that of
+// the default deck, are given the fallback time instead.
+func ankiTime(id int64, fallback time.Time) time.Time {
+	if id < 1e12 {
+		return fallback
+	}
+	return time.Unix(id/1000, (id%1000)*int64(time.Millisecond)).UTC()
+}
+
+// ankiInterval converts an Anki interval, given in days if positive, or
+// seconds if negative.
+func ankiInterval(ivl int64) Interval {
+	if ivl < 0 {
+		return Interval(-ivl) * Second
+	}
+	return Interval(ivl) * Day
+}
+
+func ankiSteps(delays []float64) []Interval {
+	steps := make([]Interval, len(delays))
+	for i, d := range delays {
+		steps[i] = Interval(d * float64(Minute))
+	}
+	return steps
+}
+
+// readApkg reads the collection database and media files from an *.apkg
+// archive.
+func readApkg(zr *zip.Reader) (collection []byte, media map[string][]byte, err error) {
+	entries := newZipEntries(zr)
+	// Newer versions of Anki include both, with the legacy collection
+	// containing only a notice to upgrade.
+	dbName := "collection.anki2"
+	if _, ok := entries["collection.anki21"]; ok {
+		dbName = "collection.anki21"
+	}
+	if collection, err = entries.read(dbName); err != nil {
+		return nil, nil, err
+	}
+	media = make(map[string][]byte)
+	if _, ok := entries["media"]; !ok {
+		return collection, media, nil
+	}
+	mediaJSON, err := entries.read("media")
+	if err != nil {
+		return nil, nil, err
+	}
+	var names map[string]string
+	if err := json.Unmarshal(mediaJSON, &names); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid media map")
+	}
+	for entry, name := range names {
+		content, err := entries.read(entry)
+		if err != nil {
+			return nil, nil, err
+		}
+		media[name] = content
+	}
+	return collection, media, nil
+}
+
+// sortedAnkiKeys sorts the keys of an Anki JSON map in numeric order.
+func sortedAnkiKeys(keys []string) []string {
+	sort.Slice(keys, func(i, j int) bool {
+		a, _ := strconv.ParseInt(keys[i], 10, 64)
+		b, _ := strconv.ParseInt(keys[j], 10, 64)
+		return a < b
+	})
+	return keys
+}
+
+// toPackage converts the collection to a Package.
+func (col *ankiCollection) toPackage(opts AnkiImportOptions) (*Package, error) {
+	imported := now().UTC()
+	created := time.Unix(col.Created, 0).UTC()
+	modified := ankiTime(col.Modified, created)
+	bundle, err := NewBundle(opts.BundleID, opts.Owner)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid bundle")
+	}
+	bundle.Name = opts.Name
+	bundle.Created = created
+	bundle.Modified = modified
+	bundle.Imported = imported
+	p := &Package{
+		Created:  created,
+		Modified: modified,
+		Bundle:   bundle,
+	}
+
+	models := make(map[int64]*Model, len(col.Models))
+	keys := make([]string, 0, len(col.Models))
+	for key := range col.Models {
+		keys = append(keys, key)
+	}
+	for _, key := range sortedAnkiKeys(keys) {
+		id, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("invalid model ID '%s'", key)
+		}
+		m, err := col.convertModel(id, col.Models[key], imported)
+		if err != nil {
+			return nil, errors.Wrapf(err, "model '%s'", col.Models[key].Name)
+		}
+		models[id] = m
+		p.Themes = append(p.Themes, m.Theme)
+	}
+
+	notes := make(map[int64]*Note, len(col.Notes))
+	ankiNotes := make(map[int64]*ankiNote, len(col.Notes))
+	for _, an := range col.Notes {
+		m, ok := models[an.ModelID]
+		if !ok {
+			return nil, errors.Errorf("note %d: model %d not found", an.ID, an.ModelID)
+		}
+		n, err := col.convertNote(an, m, imported)
+		if err != nil {
+			return nil, errors.Wrapf(err, "note %d", an.ID)
+		}
+		notes[an.ID] = n
+		ankiNotes[an.ID] = an
+		p.Notes = append(p.Notes, n)
+	}
+
+	deckIDs := make([]int64, 0)
+	decks := make(map[int64]*Deck)
+	for _, ac := range col.Cards {
+		if _, ok := decks[ac.deckID()]; !ok {
+			id := ac.deckID()
+			decks[id] = nil
+			deckIDs = append(deckIDs, id)
+		}
+	}
+	sort.Slice(deckIDs, func(i, j int) bool { return deckIDs[i] < deckIDs[j] })
+	configs := make(map[int64]*DeckConfig)
+	deckConfigs := make(map[int64]*DeckConfig)
+	addDeck := func(id int64) (*Deck, error) {
+		ad, ok := col.Decks[strconv.FormatInt(id, 10)]
+		if !ok {
+			return nil, errors.Errorf("deck %d not found", id)
+		}
+		d, err := convertAnkiDeck(id, ad, created, imported)
+		if err != nil {
+			return nil, errors.Wrapf(err, "deck '%s'", ad.Name)
+		}
+		decks[id] = d
+		p.Decks = append(p.Decks, d)
+		dc, ok := configs[ad.ConfigID]
+		if !ok {
+			key := strconv.FormatInt(ad.ConfigID, 10)
+			if adc, ok := col.DeckConfigs[key]; ok {
+				if dc, err = convertAnkiDeckConfig(key, adc, created, imported); err != nil {
+					return nil, errors.Wrapf(err, "deck config '%s'", adc.Name)
+				}
+				p.DeckConfigs = append(p.DeckConfigs, dc)
+			}
+			configs[ad.ConfigID] = dc
+		}
+		if dc != nil {
+			d.ConfigID = dc.ID
+		}
+		deckConfigs[id] = dc
+		return d, nil
+	}
+	for _, id := range deckIDs {
+		if _, err := addDeck(id); err != nil {
+			return nil, err
+		}
+	}
+	// Anki names nested decks by their full paths. Each deck is given its
+	// own name, and linked to its parent, which is imported too if it holds
+	// no cards of its own.
+	deckNames := make(map[string]int64, len(col.Decks))
+	for key, ad := range col.Decks {
+		if id, err := strconv.ParseInt(key, 10, 64); err == nil {
+			deckNames[ad.Name] = id
+		}
+	}
+	for i := 0; i < len(p.Decks); i++ {
+		d := p.Decks[i]
+		sep := strings.LastIndex(d.Name, DeckSeparator)
+		if sep < 0 {
+			continue
+		}
+		parentID, ok := deckNames[d.Name[:sep]]
+		if !ok {
+			// Keep the full name of a deck whose parent is missing
+			continue
+		}
+		parent, ok := decks[parentID]
+		if !ok {
+			var err error
+			if parent, err = addDeck(parentID); err != nil {
+				return nil, err
+			}
+		}
+		d.Name = d.Name[sep+len(DeckSeparator):]
+		d.SetParent(parent)
+	}
+
+	cards := make(map[int64]*Card, len(col.Cards))
+	for _, ac := range col.Cards {
+		n, ok := notes[ac.NoteID]
+		if !ok {
+			return nil, errors.Errorf("card %d: note %d not found", ac.ID, ac.NoteID)
+		}
+		an := ankiNotes[ac.NoteID]
+		d := decks[ac.deckID()]
+		id, err := DeriveCardID(BundleID(bundle.ID), ankiNamespace, an.key(), uint32(ac.Ord))
+		if err != nil {
+			return nil, errors.Wrapf(err, "card %d", ac.ID)
+		}
+		c := col.convertCard(ac, id.String(), n, deckConfigs[ac.deckID()], imported)
+		c.Deck = d.ID
+		c.Leech = ankiHasTag(an.Tags, "leech")
+		d.AddCard(c.ID)
+		cards[ac.ID] = c
+		p.Cards = append(p.Cards, c)
+	}
+
+	for _, ar := range col.Revlog {
+		c, ok := cards[ar.CardID]
+		if !ok {
+			// Reviews of deleted cards are dropped
+			continue
+		}
+		r, ok := convertAnkiRevlog(ar, c.ID)
+		if !ok {
+			continue
+		}
+		if r.Timestamp.After(c.LastReview) {
+			c.LastReview = r.Timestamp
+		}
+		p.Reviews = append(p.Reviews, r)
+	}
+
+	if err := p.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid package")
+	}
+	return p, nil
+}
+
+// key returns the key from which the note's ID is derived: its GUID, or its
+// Anki ID if it has none.
+func (an *ankiNote) key() string {
+	if an.GUID == "" {
+		return strconv.FormatInt(an.ID, 10)
+	}
+	return an.GUID
+}
+
+func (ac *ankiCard) deckID() int64 {
+	if ac.OriginalDeck != 0 {
+		return ac.OriginalDeck
+	}
+	return ac.DeckID
+}
+
+// ankiHasTag returns true if the space-separated list of tags contains tag.
+func ankiHasTag(tags, tag string) bool {
+	for _, t := range strings.Fields(tags) {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// ankiDue converts a due value, which is a timestamp for cards in learning,
+// or a number of days from the collection's creation for review cards.
+func (col *ankiCollection) ankiDue(due int64) Due {
+	if due > 1e9 {
+		return Due(time.Unix(due, 0).UTC())
+	}
+	return On(time.Unix(col.Created, 0).UTC()).Add(Interval(due) * Day)
+}
+
+// addMedia adds any media files referenced by text to v.
+func (col *ankiCollection) addMedia(v *FileCollectionView, text string) {
+	for _, ref := range ankiMediaRefs(text) {
+		content, ok := col.Media[ref]
+		if !ok {
+			continue
+		}
+		if _, ok := v.GetFile(ref); ok {
+			continue
+		}
+		v.SetFile(ref, ankiMediaType(ref), content)
+	}
+}
+
+func (col *ankiCollection) convertModel(id int64, am *ankiModel, imported time.Time) (*Model, error) {
+	created := ankiTime(id, time.Unix(col.Created, 0).UTC())
+	t, err := NewTheme(EncodeDocID("theme", []byte(strconv.FormatInt(id, 10))))
+	if err != nil {
+		return nil, err
+	}
+	t.Name = am.Name
+	t.Created = created
+	t.Modified = created
+	if am.Modified > 0 {
+		t.Modified = time.Unix(am.Modified, 0).UTC()
+	}
+	t.Imported = imported
+	modelType := AnkiStandardModel
+	if am.Type == 1 {
+		modelType = AnkiClozeModel
+	}
+	m, err := t.NewModel(modelType)
+	if err != nil {
+		return nil, err
+	}
+	m.Name = am.Name
+	m.SortField = am.SortField
+
+	fields := append([]*ankiField{}, am.Fields...)
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Ord < fields[j].Ord })
+	for _, f := range fields {
+		if err := m.AddField(AnkiField, f.Name); err != nil {
+			return nil, err
+		}
+	}
+	templates := append([]*ankiTemplate{}, am.Templates...)
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Ord < templates[j].Ord })
+	for _, tmpl := range templates {
+		mt, err := m.AddTemplate(tmpl.Name, tmpl.Question, tmpl.Answer)
+		if err != nil {
+			return nil, err
+		}
+		mt.BrowserQuestion = tmpl.BrowserQuestion
+		mt.BrowserAnswer = tmpl.BrowserAnswer
+		col.addMedia(t.Files, tmpl.Question)
+		col.addMedia(t.Files, tmpl.Answer)
+	}
+	if am.CSS != "" {
+		t.SetFile("style.css", "text/css", []byte(am.CSS))
+		col.addMedia(t.Files, am.CSS)
+	}
+	return m, nil
+}
+
+func (col *ankiCollection) convertNote(an *ankiNote, m *Model, imported time.Time) (*Note, error) {
+	n, err := NewNote(DeriveDocID("note", ankiNamespace, an.key()), m)
+	if err != nil {
+		return nil, err
+	}
+	n.Created = ankiTime(an.ID, time.Unix(col.Created, 0).UTC())
+	n.Modified = time.Unix(an.Modified, 0).UTC()
+	n.Imported = imported
+	n.AddTags(strings.Fields(an.Tags)...)
+	values := strings.Split(an.Fields, ankiFieldSeparator)
+	if len(values) != len(m.Fields) {
+		return nil, errors.Errorf("expected %d fields, found %d", len(m.Fields), len(values))
+	}
+	for i, text := range values {
+		fv := n.GetFieldValue(i)
+		fv.Text = text
+		col.addMedia(fv.files, text)
+	}
+	return n, nil
+}
+
+func convertAnkiDeck(id int64, ad *ankiDeck, created, imported time.Time) (*Deck, error) {
+	d, err := NewDeck(EncodeDocID("deck", []byte(strconv.FormatInt(id, 10))))
+	if err != nil {
+		return nil, err
+	}
+	d.Name = ad.Name
+	d.Description = ad.Description
+	d.Created = ankiTime(id, created)
+	d.Modified = d.Created
+	if ad.Modified > 0 {
+		d.Modified = time.Unix(ad.Modified, 0).UTC()
+	}
+	d.Imported = imported
+	return d, nil
+}
+
+func convertAnkiDeckConfig(key string, adc *ankiDeckConfig, created, imported time.Time) (*DeckConfig, error) {
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil {
+		return nil, errors.Errorf("invalid ID '%s'", key)
+	}
+	dc := &DeckConfig{
+		ID:       EncodeDocID("dconf", []byte(key)),
+		Name:     adc.Name,
+		Created:  ankiTime(id, created),
+		Imported: imported,
+		New: NewCardConfig{
+			PerDay:      adc.New.PerDay,
+			Steps:       ankiSteps(adc.New.Delays),
+			InitialEase: float32(adc.New.InitialFactor) / 1000,
+			Bury:        adc.New.Bury,
+		},
+		Reviews: ReviewConfig{
+			PerDay:      adc.Rev.PerDay,
+			MaxInterval: Interval(adc.Rev.MaxIvl) * Day,
+			Bury:        adc.Rev.Bury,
+		},
+		Lapses: LapseConfig{
+			Steps:          ankiSteps(adc.Lapse.Delays),
+			LeechThreshold: adc.Lapse.LeechFails,
+			LeechAction:    LeechAction(adc.Lapse.LeechAction),
+		},
+	}
+	dc.Modified = dc.Created
+	if adc.Modified > 0 {
+		dc.Modified = time.Unix(adc.Modified, 0).UTC()
+	}
+	if len(adc.New.Ints) > 0 {
+		dc.New.GraduatingInterval = Interval(adc.New.Ints[0]) * Day
+	}
+	if len(adc.New.Ints) > 1 {
+		dc.New.EasyInterval = Interval(adc.New.Ints[1]) * Day
+	}
+	// Anki orders new cards randomly (0) or by due position (1)
+	if adc.New.Order == 0 {
+		dc.New.Order = NewCardsRandom
+	}
+	if err := dc.Validate(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+func (col *ankiCollection) convertCard(ac *ankiCard, id string, n *Note, dc *DeckConfig, imported time.Time) *Card {
+	c := &Card{
+		ID:          id,
+		ModelID:     fmt.Sprintf("%s/%d", n.ThemeID, n.ModelID),
+		Created:     ankiTime(ac.ID, n.Created),
+		Modified:    time.Unix(ac.Modified, 0).UTC(),
+		Imported:    imported,
+		EaseFactor:  float32(ac.Factor) / 1000,
+		ReviewCount: ac.Reps,
+		LapseCount:  ac.Lapses,
+	}
+	if dc == nil {
+		dc = defaultDeckConfig()
+	}
+	due := ac.Due
+	if ac.OriginalDeck != 0 && ac.OriginalDue != 0 {
+		due = ac.OriginalDue
+	}
+	switch ac.Type {
+	case ankiTypeLearning, ankiTypeRelearning:
+		c.Queue = QueueLearning
+		steps := stepsOrDefault(dc.New.Steps, DefaultLearningSteps)
+		if ac.Type == ankiTypeRelearning {
+			c.Queue = QueueRelearning
+			c.Interval = ankiInterval(ac.Interval)
+			steps = stepsOrDefault(dc.Lapses.Steps, DefaultRelearningSteps)
+		}
+		// Anki records the number of steps remaining before graduation
+		c.LearningStep = len(steps) - ac.Left%1000
+		if c.LearningStep >= len(steps) {
+			c.LearningStep = len(steps) - 1
+		}
+		if c.LearningStep < 0 {
+			c.LearningStep = 0
+		}
+		c.Due = col.ankiDue(due)
+	case ankiTypeReview:
+		c.Queue = QueueReview
+		c.Interval = ankiInterval(ac.Interval)
+		c.Due = col.ankiDue(due)
+	}
+	switch ac.Queue {
+	case ankiQueueSuspended:
+		c.Suspended = true
+	case ankiQueueUserBuried:
+		c.Buried = true
+		c.BuriedUntil = Today().Add(Day)
+	case ankiQueueSchedBuried:
+		c.AutoBuried = true
+		c.BuriedUntil = Today().Add(Day)
+	}
+	return c
+}
+
+// ankiReviewTypes maps Anki revlog types to review types. Manual reschedules
+// (type 4) are not reviews, and are omitted.
+var ankiReviewTypes = map[int]ReviewType{
+	0: ReviewTypeLearn,
+	1: ReviewTypeReview,
+	2: ReviewTypeRelearn,
+	3: ReviewTypeCram,
+}
+
+// convertAnkiRevlog converts a revlog entry to a Review, returning false if
+// the entry does not represent a review.
+func convertAnkiRevlog(ar *ankiRevlog, cardID string) (*Review, bool) {
+	reviewType, ok := ankiReviewTypes[ar.Type]
+	if !ok || !ReviewEase(ar.Ease).valid() {
+		return nil, false
+	}
+	return &Review{
+		CardID:           cardID,
+		Timestamp:        ankiTime(ar.ID, time.Time{}),
+		Ease:             ReviewEase(ar.Ease),
+		Interval:         ankiInterval(ar.Interval),
+		PreviousInterval: ankiInterval(ar.LastInterval),
+		SRSFactor:        float32(ar.Factor) / 1000,
+		ReviewTime:       time.Duration(ar.Time) * time.Millisecond,
+		Type:             reviewType,
+	}, true
+}
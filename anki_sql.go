@@ -0,0 +1,116 @@
+//go:build !js
+// +build !js
+
+package fb
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// ImportAnki reads an Anki package (*.apkg) of the given size from r, and
+// converts it to a Package. The SQLite collection within the package is read
+// via database/sql, using the named driver, which the caller must register
+// (for example, by importing github.com/mattn/go-sqlite3 as "sqlite3").
+func ImportAnki(r io.ReaderAt, size int64, driverName string, opts AnkiImportOptions) (*Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid apkg file")
+	}
+	dbData, media, err := readApkg(zr)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite drivers open databases by filename only
+	f, err := ioutil.TempFile("", "fb-anki-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(dbData); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driverName, f.Name())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open collection")
+	}
+	defer db.Close()
+	col, err := readAnkiCollection(db)
+	if err != nil {
+		return nil, err
+	}
+	col.Media = media
+	return col.toPackage(opts)
+}
+
+// readAnkiCollection reads the contents of an Anki collection database.
+func readAnkiCollection(db *sql.DB) (*ankiCollection, error) {
+	col := &ankiCollection{}
+	var models, decks, dconf []byte
+	err := db.QueryRow(`SELECT crt, mod, models, decks, dconf FROM col`).
+		Scan(&col.Created, &col.Modified, &models, &decks, &dconf)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read collection")
+	}
+	if err := json.Unmarshal(models, &col.Models); err != nil {
+		return nil, errors.Wrap(err, "invalid models")
+	}
+	if err := json.Unmarshal(decks, &col.Decks); err != nil {
+		return nil, errors.Wrap(err, "invalid decks")
+	}
+	if err := json.Unmarshal(dconf, &col.DeckConfigs); err != nil {
+		return nil, errors.Wrap(err, "invalid deck configs")
+	}
+
+	err = queryAnki(db, `SELECT id, guid, mid, mod, tags, flds FROM notes ORDER BY id`, func(rows *sql.Rows) error {
+		n := &ankiNote{}
+		col.Notes = append(col.Notes, n)
+		return rows.Scan(&n.ID, &n.GUID, &n.ModelID, &n.Modified, &n.Tags, &n.Fields)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read notes")
+	}
+	err = queryAnki(db, `SELECT id, nid, did, ord, mod, type, queue, due, ivl, factor, reps, lapses, left, odue, odid
+		FROM cards ORDER BY id`, func(rows *sql.Rows) error {
+		c := &ankiCard{}
+		col.Cards = append(col.Cards, c)
+		return rows.Scan(&c.ID, &c.NoteID, &c.DeckID, &c.Ord, &c.Modified, &c.Type, &c.Queue, &c.Due,
+			&c.Interval, &c.Factor, &c.Reps, &c.Lapses, &c.Left, &c.OriginalDue, &c.OriginalDeck)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read cards")
+	}
+	err = queryAnki(db, `SELECT id, cid, ease, ivl, lastIvl, factor, time, type FROM revlog ORDER BY id`, func(rows *sql.Rows) error {
+		r := &ankiRevlog{}
+		col.Revlog = append(col.Revlog, r)
+		return rows.Scan(&r.ID, &r.CardID, &r.Ease, &r.Interval, &r.LastInterval, &r.Factor, &r.Time, &r.Type)
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read revlog")
+	}
+	return col, nil
+}
+
+func queryAnki(db *sql.DB, query string, scan func(*sql.Rows) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
@@ -0,0 +1,267 @@
+//go:build !js
+// +build !js
+
+package fb
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/pkg/errors"
+)
+
+// ankiStubRow is a row of an ankiStub table, by column name.
+type ankiStubRow map[string]driver.Value
+
+// ankiStub is a database/sql driver which serves the tables of an Anki
+// collection from memory, in place of an SQLite driver. Queries are answered
+// from the table they select from, with the columns they name.
+type ankiStub struct {
+	tables map[string][]ankiStubRow
+	// opened holds the content of the database file last opened, if any.
+	opened []byte
+}
+
+var testAnkiStub = &ankiStub{}
+
+func init() {
+	sql.Register("fb-anki-stub", testAnkiStub)
+}
+
+var ankiStubQuery = regexp.MustCompile(`(?s)^SELECT (.*?)\s+FROM (\w+)`)
+
+func (s *ankiStub) Open(name string) (driver.Conn, error) {
+	if name == "" {
+		s.opened = nil
+		return s, nil
+	}
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	s.opened = data
+	return s, nil
+}
+
+func (s *ankiStub) Prepare(query string) (driver.Stmt, error) {
+	m := ankiStubQuery.FindStringSubmatch(query)
+	if m == nil {
+		return nil, errors.Errorf("unsupported query: %s", query)
+	}
+	rows, ok := s.tables[m[2]]
+	if !ok {
+		return nil, errors.Errorf("no such table: %s", m[2])
+	}
+	columns := strings.Split(m[1], ",")
+	for i, c := range columns {
+		columns[i] = strings.TrimSpace(c)
+	}
+	return &ankiStubStmt{columns: columns, rows: rows}, nil
+}
+
+func (s *ankiStub) Close() error { return nil }
+
+func (s *ankiStub) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions not supported")
+}
+
+type ankiStubStmt struct {
+	columns []string
+	rows    []ankiStubRow
+}
+
+func (s *ankiStubStmt) Close() error  { return nil }
+func (s *ankiStubStmt) NumInput() int { return 0 }
+
+func (s *ankiStubStmt) Exec(_ []driver.Value) (driver.Result, error) {
+	return nil, errors.New("exec not supported")
+}
+
+func (s *ankiStubStmt) Query(_ []driver.Value) (driver.Rows, error) {
+	return &ankiStubRows{ankiStubStmt: s}, nil
+}
+
+type ankiStubRows struct {
+	*ankiStubStmt
+	next int
+}
+
+func (r *ankiStubRows) Columns() []string { return r.columns }
+
+func (r *ankiStubRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	row := r.rows[r.next]
+	r.next++
+	for i, c := range r.columns {
+		dest[i] = row[c]
+	}
+	return nil
+}
+
+// ankiStubTables returns the tables of the database holding col.
+func ankiStubTables(t *testing.T, col *ankiCollection) map[string][]ankiStubRow {
+	marshal := func(v interface{}) []byte {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	tables := map[string][]ankiStubRow{
+		"col": {{
+			"crt":    col.Created,
+			"mod":    col.Modified,
+			"models": marshal(col.Models),
+			"decks":  marshal(col.Decks),
+			"dconf":  marshal(col.DeckConfigs),
+		}},
+		"notes":  {},
+		"cards":  {},
+		"revlog": {},
+	}
+	for _, n := range col.Notes {
+		tables["notes"] = append(tables["notes"], ankiStubRow{
+			"id": n.ID, "guid": n.GUID, "mid": n.ModelID, "mod": n.Modified, "tags": n.Tags, "flds": n.Fields,
+		})
+	}
+	for _, c := range col.Cards {
+		tables["cards"] = append(tables["cards"], ankiStubRow{
+			"id": c.ID, "nid": c.NoteID, "did": c.DeckID, "ord": int64(c.Ord), "mod": c.Modified,
+			"type": int64(c.Type), "queue": int64(c.Queue), "due": c.Due, "ivl": c.Interval,
+			"factor": int64(c.Factor), "reps": int64(c.Reps), "lapses": int64(c.Lapses),
+			"left": int64(c.Left), "odue": c.OriginalDue, "odid": c.OriginalDeck,
+		})
+	}
+	for _, r := range col.Revlog {
+		tables["revlog"] = append(tables["revlog"], ankiStubRow{
+			"id": r.ID, "cid": r.CardID, "ease": int64(r.Ease), "ivl": r.Interval, "lastIvl": r.LastInterval,
+			"factor": int64(r.Factor), "time": r.Time, "type": int64(r.Type),
+		})
+	}
+	return tables
+}
+
+func TestReadAnkiCollection(t *testing.T) {
+	tests := []struct {
+		name   string
+		tables func(map[string][]ankiStubRow)
+		err    string
+	}{
+		{
+			name:   "valid",
+			tables: func(_ map[string][]ankiStubRow) {},
+		},
+		{
+			name:   "missing collection",
+			tables: func(tables map[string][]ankiStubRow) { delete(tables, "col") },
+			err:    "failed to read collection: no such table: col",
+		},
+		{
+			name:   "invalid models",
+			tables: func(tables map[string][]ankiStubRow) { tables["col"][0]["models"] = []byte("foo") },
+			err:    "invalid models: invalid character 'o' in literal false (expecting 'a')",
+		},
+		{
+			name:   "invalid decks",
+			tables: func(tables map[string][]ankiStubRow) { tables["col"][0]["decks"] = []byte("foo") },
+			err:    "invalid decks: invalid character 'o' in literal false (expecting 'a')",
+		},
+		{
+			name:   "missing cards",
+			tables: func(tables map[string][]ankiStubRow) { delete(tables, "cards") },
+			err:    "failed to read cards: no such table: cards",
+		},
+		{
+			name:   "missing notes",
+			tables: func(tables map[string][]ankiStubRow) { delete(tables, "notes") },
+			err:    "failed to read notes: no such table: notes",
+		},
+		{
+			name:   "missing revlog",
+			tables: func(tables map[string][]ankiStubRow) { delete(tables, "revlog") },
+			err:    "failed to read revlog: no such table: revlog",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := testAnkiCollection()
+			testAnkiStub.tables = ankiStubTables(t, expected)
+			test.tables(testAnkiStub.tables)
+			db, err := sql.Open("fb-anki-stub", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+			col, err := readAnkiCollection(db)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			expected.Media = nil
+			if d := diff.Interface(expected, col); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestImportAnki(t *testing.T) {
+	opts := AnkiImportOptions{
+		BundleID: "bundle-krsxg5baij2w4zdmmu",
+		Owner:    "tui5ajfbabaeljnxt4om7fwmt4",
+		Name:     "Imported",
+	}
+	t.Run("invalid archive", func(t *testing.T) {
+		_, err := ImportAnki(bytes.NewReader([]byte("foo")), 3, "fb-anki-stub", opts)
+		checkErr(t, "invalid apkg file: zip: not a valid zip file", err)
+	})
+
+	col := testAnkiCollection()
+	testAnkiStub.tables = ankiStubTables(t, col)
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	files := map[string][]byte{
+		"collection.anki2": []byte("collection"),
+		"media":            []byte(`{"0":"one.mp3","1":"_bg.png","2":"unused"}`),
+		"0":                col.Media["one.mp3"],
+		"1":                col.Media["_bg.png"],
+		"2":                col.Media["unused"],
+	}
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write(content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	p, err := ImportAnki(bytes.NewReader(buf.Bytes()), int64(buf.Len()), "fb-anki-stub", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(testAnkiStub.opened) != "collection" {
+		t.Errorf("Unexpected database opened: %q", testAnkiStub.opened)
+	}
+	expected, err := col.toPackage(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.AsJSON(expected, p); d != nil {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,416 @@
+package fb
+
+import (
+	"archive/zip"
+	"bytes"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+)
+
+func TestAnkiMediaRefs(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name: "no media",
+			text: "<b>foo</b>",
+		},
+		{
+			name:     "image",
+			text:     `<div><img src="foo.jpg" /> and <IMG class=x src=bar&amp;baz.png></div>`,
+			expected: []string{"foo.jpg", "bar&baz.png"},
+		},
+		{
+			name:     "sound",
+			text:     "foo [sound:foo bar.mp3]",
+			expected: []string{"foo bar.mp3"},
+		},
+		{
+			name:     "css url",
+			text:     `@font-face { src: url("_font.ttf"); }`,
+			expected: []string{"_font.ttf"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := ankiMediaRefs(test.text)
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestReadApkg(t *testing.T) {
+	archive := func(files map[string]string) *zip.Reader {
+		buf := &bytes.Buffer{}
+		w := zip.NewWriter(buf)
+		for name, content := range files {
+			f, err := w.Create(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := f.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	tests := []struct {
+		name          string
+		files         map[string]string
+		expectedDB    string
+		expectedMedia map[string][]byte
+		err           string
+	}{
+		{
+			name:  "no collection",
+			files: map[string]string{"media": "{}"},
+			err:   "collection.anki2 not found in archive",
+		},
+		{
+			name:          "no media",
+			files:         map[string]string{"collection.anki2": "db"},
+			expectedDB:    "db",
+			expectedMedia: map[string][]byte{},
+		},
+		{
+			name:  "invalid media map",
+			files: map[string]string{"collection.anki2": "db", "media": "foo"},
+			err:   "invalid media map: invalid character 'o' in literal false (expecting 'a')",
+		},
+		{
+			name:  "missing media file",
+			files: map[string]string{"collection.anki2": "db", "media": `{"0":"foo.jpg"}`},
+			err:   "0 not found in archive",
+		},
+		{
+			name: "anki 2.1 collection with media",
+			files: map[string]string{
+				"collection.anki2":  "legacy",
+				"collection.anki21": "db",
+				"media":             `{"0":"foo.jpg","1":"bar.mp3"}`,
+				"0":                 "jpeg",
+				"1":                 "mp3",
+			},
+			expectedDB: "db",
+			expectedMedia: map[string][]byte{
+				"foo.jpg": []byte("jpeg"),
+				"bar.mp3": []byte("mp3"),
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			db, media, err := readApkg(archive(test.files))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if string(db) != test.expectedDB {
+				t.Errorf("Unexpected collection: %s", string(db))
+			}
+			if d := diff.Interface(test.expectedMedia, media); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func testAnkiCollection() *ankiCollection {
+	dconf := &ankiDeckConfig{Name: "Default", Modified: 1483315200}
+	dconf.New.PerDay = 10
+	dconf.New.Delays = []float64{1, 10}
+	dconf.New.Ints = []int{1, 4, 7}
+	dconf.New.InitialFactor = 2500
+	dconf.New.Order = 1
+	dconf.Rev.PerDay = 100
+	dconf.Rev.MaxIvl = 36500
+	dconf.Lapse.Delays = []float64{10}
+	dconf.Lapse.LeechFails = 8
+	dconf.Lapse.LeechAction = 1
+	return &ankiCollection{
+		Created:  1483228800,
+		Modified: 1483315200000,
+		Models: map[string]*ankiModel{
+			"1342697561419": {
+				Name:     "Basic",
+				Modified: 1483315200,
+				Fields:   []*ankiField{{Name: "Back", Ord: 1}, {Name: "Front", Ord: 0}},
+				Templates: []*ankiTemplate{
+					{Name: "Card 1", Ord: 0, Question: "{{Front}}", Answer: "{{FrontSide}}<hr id=answer>{{Back}}", BrowserQuestion: "{{text:Front}}"},
+				},
+				CSS: `.card { background: url("_bg.png"); }`,
+			},
+		},
+		Decks: map[string]*ankiDeck{
+			"1":             {Name: "Default", ConfigID: 1},
+			"1483228800000": {Name: "Spanish", Description: "Vocabulary", Modified: 1483315200, ConfigID: 1},
+			"1483228900000": {Name: "Filtered", Dynamic: 1},
+		},
+		DeckConfigs: map[string]*ankiDeckConfig{"1": dconf},
+		Notes: []*ankiNote{
+			{ID: 1483228800000, GUID: "abc", ModelID: 1342697561419, Modified: 1483315200, Fields: "uno\x1fone [sound:one.mp3]"},
+			{ID: 1483228801000, GUID: "abd", ModelID: 1342697561419, Modified: 1483315200, Tags: " leech Spanish::Verbs ", Fields: "dos\x1ftwo"},
+		},
+		Cards: []*ankiCard{
+			{ID: 1483228800000, NoteID: 1483228800000, DeckID: 1483228800000, Modified: 1483315200,
+				Type: ankiTypeReview, Queue: 2, Due: 10, Interval: 5, Factor: 2300, Reps: 3},
+			{ID: 1483228801000, NoteID: 1483228801000, DeckID: 1483228900000, OriginalDeck: 1483228800000, Modified: 1483315200,
+				Type: ankiTypeRelearning, Queue: ankiQueueSuspended, Due: 1483315800, Interval: 2, Factor: 2100, Reps: 9, Lapses: 8, Left: 1},
+		},
+		Revlog: []*ankiRevlog{
+			{ID: 1483315200000, CardID: 1483228800000, Ease: 3, Interval: 5, LastInterval: -600, Factor: 2300, Time: 4500, Type: 1},
+			{ID: 1483315300000, CardID: 1483228800000, Ease: 0, Interval: 6, LastInterval: 5, Factor: 2300, Type: 4},
+			{ID: 1483315400000, CardID: 999, Ease: 3, Type: 1},
+		},
+		Media: map[string][]byte{
+			"one.mp3": []byte("mp3"),
+			"_bg.png": []byte("png"),
+			"unused":  []byte("unused"),
+		},
+	}
+}
+
+func TestAnkiToPackage(t *testing.T) {
+	opts := AnkiImportOptions{
+		BundleID: "bundle-krsxg5baij2w4zdmmu",
+		Owner:    "tui5ajfbabaeljnxt4om7fwmt4",
+		Name:     "Imported",
+	}
+	t.Run("invalid bundle", func(t *testing.T) {
+		_, err := testAnkiCollection().toPackage(AnkiImportOptions{})
+		checkErr(t, "invalid bundle: id required", err)
+	})
+	t.Run("missing model", func(t *testing.T) {
+		col := testAnkiCollection()
+		col.Notes[0].ModelID = 123
+		_, err := col.toPackage(opts)
+		checkErr(t, "note 1483228800000: model 123 not found", err)
+	})
+	t.Run("field count mismatch", func(t *testing.T) {
+		col := testAnkiCollection()
+		col.Notes[0].Fields = "uno"
+		_, err := col.toPackage(opts)
+		checkErr(t, "note 1483228800000: expected 2 fields, found 1", err)
+	})
+	t.Run("missing deck", func(t *testing.T) {
+		col := testAnkiCollection()
+		col.Cards[0].DeckID = 123
+		_, err := col.toPackage(opts)
+		checkErr(t, "deck 123 not found", err)
+	})
+	t.Run("nested decks", func(t *testing.T) {
+		col := testAnkiCollection()
+		col.Decks["1483228800000"].Name = "Languages::Spanish"
+		col.Decks["1483228700000"] = &ankiDeck{Name: "Languages", ConfigID: 1}
+		p, err := col.toPackage(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(p.Decks) != 2 {
+			t.Fatalf("Expected 2 decks, got %d", len(p.Decks))
+		}
+		d, parent := p.Decks[0], p.Decks[1]
+		if parent.ID != EncodeDocID("deck", []byte("1483228700000")) || parent.Name != "Languages" || parent.ParentID != "" {
+			t.Errorf("Unexpected parent deck %s (%s)", parent.ID, parent.Name)
+		}
+		if d.Name != "Spanish" || d.ParentID != parent.ID || d.Path() != "Languages::Spanish" {
+			t.Errorf("Unexpected deck %s (%s)", d.Name, d.ParentID)
+		}
+		if err := p.Validate(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("missing note", func(t *testing.T) {
+		col := testAnkiCollection()
+		col.Cards[0].NoteID = 123
+		_, err := col.toPackage(opts)
+		checkErr(t, "card 1483228800000: note 123 not found", err)
+	})
+
+	p, err := testAnkiCollection().toPackage(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	themeID := EncodeDocID("theme", []byte("1342697561419"))
+	deckID := EncodeDocID("deck", []byte("1483228800000"))
+	confID := EncodeDocID("dconf", []byte("1"))
+	t.Run("bundle", func(t *testing.T) {
+		expected := &Bundle{
+			ID:       "bundle-krsxg5baij2w4zdmmu",
+			Owner:    "tui5ajfbabaeljnxt4om7fwmt4",
+			Name:     "Imported",
+			Created:  parseTime("2017-01-01T00:00:00Z"),
+			Modified: parseTime("2017-01-02T00:00:00Z"),
+			Imported: now(),
+		}
+		if d := diff.Interface(expected, p.Bundle); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("themes", func(t *testing.T) {
+		if len(p.Themes) != 1 {
+			t.Fatalf("Expected 1 theme, got %d", len(p.Themes))
+		}
+		theme := p.Themes[0]
+		if theme.ID != themeID || theme.Name != "Basic" {
+			t.Errorf("Unexpected theme %s (%s)", theme.ID, theme.Name)
+		}
+		if d := diff.Interface([]string{"_bg.png", "style.css"}, sortedFileList(theme.Files.FileList())); d != nil {
+			t.Error(d)
+		}
+		m := theme.Models[0]
+		if m.Type != AnkiStandardModel {
+			t.Errorf("Unexpected model type %s", m.Type)
+		}
+		if d := diff.Interface([]*Field{{Type: AnkiField, Name: "Front"}, {Type: AnkiField, Name: "Back"}}, m.Fields); d != nil {
+			t.Error(d)
+		}
+		expected := []*Template{{
+			Name:            "Card 1",
+			Question:        "{{Front}}",
+			Answer:          "{{FrontSide}}<hr id=answer>{{Back}}",
+			BrowserQuestion: "{{text:Front}}",
+		}}
+		if d := diff.Interface(expected, m.Templates); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("notes", func(t *testing.T) {
+		if len(p.Notes) != 2 {
+			t.Fatalf("Expected 2 notes, got %d", len(p.Notes))
+		}
+		n := p.Notes[0]
+		if n.ID != "note-5fP55x7bV8mSsYczcwlKKQ" {
+			t.Errorf("Unexpected note ID %s", n.ID)
+		}
+		if n.FieldValues[0].Text != "uno" || n.FieldValues[1].Text != "one [sound:one.mp3]" {
+			t.Errorf("Unexpected field values")
+		}
+		if d := diff.Interface([]string{"one.mp3"}, n.FieldValues[1].files.FileList()); d != nil {
+			t.Error(d)
+		}
+		att, _ := n.Attachments.GetFile("one.mp3")
+		if att == nil || att.ContentType != "audio/mpeg" {
+			t.Errorf("Unexpected attachment: %v", att)
+		}
+		if n.Tags != nil {
+			t.Errorf("Unexpected tags: %v", n.Tags.All())
+		}
+		if d := diff.Interface([]string{"leech", "Spanish::Verbs"}, p.Notes[1].Tags.All()); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("decks", func(t *testing.T) {
+		if len(p.Decks) != 1 {
+			t.Fatalf("Expected 1 deck, got %d", len(p.Decks))
+		}
+		d := p.Decks[0]
+		if d.ID != deckID || d.Name != "Spanish" || d.Description != "Vocabulary" || d.ConfigID != confID {
+			t.Errorf("Unexpected deck %s (%s)", d.ID, d.Name)
+		}
+		expected := []string{"card-krsxg5baij2w4zdmmu.5fP55x7bV8mSsYczcwlKKQ.0", "card-krsxg5baij2w4zdmmu.uRLgEH2BWBqq0olD8Mp5Kg.0"}
+		if d := diff.Interface(expected, d.Cards.All()); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("deck configs", func(t *testing.T) {
+		expected := []*DeckConfig{
+			{
+				ID:       confID,
+				Name:     "Default",
+				Created:  parseTime("2017-01-01T00:00:00Z"),
+				Modified: parseTime("2017-01-02T00:00:00Z"),
+				Imported: now(),
+				New: NewCardConfig{
+					PerDay:             10,
+					Steps:              []Interval{Minute, 10 * Minute},
+					GraduatingInterval: Day,
+					EasyInterval:       4 * Day,
+					InitialEase:        2.5,
+				},
+				Reviews: ReviewConfig{PerDay: 100, MaxInterval: 36500 * Day},
+				Lapses: LapseConfig{
+					Steps:          []Interval{10 * Minute},
+					LeechThreshold: 8,
+					LeechAction:    LeechTagOnly,
+				},
+			},
+		}
+		if d := diff.Interface(expected, p.DeckConfigs); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("cards", func(t *testing.T) {
+		expected := []*Card{
+			{
+				ID:          "card-krsxg5baij2w4zdmmu.5fP55x7bV8mSsYczcwlKKQ.0",
+				Created:     parseTime("2017-01-01T00:00:00Z"),
+				Modified:    parseTime("2017-01-02T00:00:00Z"),
+				Imported:    now(),
+				LastReview:  parseTime("2017-01-02T00:00:00Z"),
+				Deck:        deckID,
+				ModelID:     themeID + "/0",
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-11"),
+				Interval:    5 * Day,
+				EaseFactor:  2.3,
+				ReviewCount: 3,
+			},
+			{
+				ID:          "card-krsxg5baij2w4zdmmu.uRLgEH2BWBqq0olD8Mp5Kg.0",
+				Created:     parseTime("2017-01-01T00:00:01Z"),
+				Modified:    parseTime("2017-01-02T00:00:00Z"),
+				Imported:    now(),
+				Deck:        deckID,
+				ModelID:     themeID + "/0",
+				Queue:       QueueRelearning,
+				Suspended:   true,
+				Due:         Due(time.Unix(1483315800, 0).UTC()),
+				Interval:    2 * Day,
+				EaseFactor:  2.1,
+				ReviewCount: 9,
+				LapseCount:  8,
+				Leech:       true,
+			},
+		}
+		if d := diff.Interface(expected, p.Cards); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("reviews", func(t *testing.T) {
+		expected := []*Review{
+			{
+				CardID:           "card-krsxg5baij2w4zdmmu.5fP55x7bV8mSsYczcwlKKQ.0",
+				Timestamp:        parseTime("2017-01-02T00:00:00Z"),
+				Ease:             ReviewEaseOK,
+				Interval:         5 * Day,
+				PreviousInterval: 10 * Minute,
+				SRSFactor:        2.3,
+				ReviewTime:       4500 * time.Millisecond,
+				Type:             ReviewTypeReview,
+			},
+		}
+		if d := diff.Interface(expected, p.Reviews); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func sortedFileList(files []string) []string {
+	sort.Strings(files)
+	return files
+}
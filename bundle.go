@@ -30,28 +30,36 @@ type Bundle struct {
 // Validate validates that all of the data in the bundle appears valid and self
 // consistent. A nil return value means no errors were detected.
 func (b *Bundle) Validate() error {
+	return b.ValidateAll().Err()
+}
+
+// ValidateAll validates the bundle as Validate does, but reports every problem
+// found, rather than only the first.
+func (b *Bundle) ValidateAll() *ValidationReport {
+	v := newReporter()
+	b.validate(v)
+	return v.report
+}
+
+func (b *Bundle) validate(v *reporter) {
 	if b.ID == "" {
-		return errors.New("id required")
-	}
-	if err := validateDBID(b.ID); err != nil {
-		return err
-	}
-	if !strings.HasPrefix(b.ID, "bundle-") {
-		return errors.New("incorrect doc type")
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if err := validateDBID(b.ID); err != nil {
+		v.error("_id", ProblemInvalidID, err)
+	} else if !strings.HasPrefix(b.ID, "bundle-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
 	}
 	if b.Created.IsZero() {
-		return errors.New("created time required")
+		v.errorf("created", ProblemRequired, "created time required")
 	}
 	if b.Modified.IsZero() {
-		return errors.New("modified time required")
+		v.errorf("modified", ProblemRequired, "modified time required")
 	}
 	if b.Owner == "" {
-		return errors.New("owner required")
-	}
-	if _, err := B32dec(b.Owner); err != nil {
-		return errors.Wrap(err, "invalid owner name")
+		v.errorf("owner", ProblemRequired, "owner required")
+	} else if _, err := B32dec(b.Owner); err != nil {
+		v.error("owner", ProblemInvalidValue, errors.Wrap(err, "invalid owner name"))
 	}
-	return nil
 }
 
 // NewBundle creates a new Bundle with the provided id and owner.
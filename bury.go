@@ -0,0 +1,73 @@
+package fb
+
+import "github.com/pkg/errors"
+
+// Bury hides the card from study until the next day.
+func (c *Card) Bury() {
+	c.Buried = true
+	c.BuriedUntil = Today().Add(Day)
+	c.Modified = now().UTC()
+}
+
+// Unbury returns a buried card to study immediately.
+func (c *Card) Unbury() {
+	c.Buried = false
+	c.AutoBuried = false
+	c.BuriedUntil = Due{}
+	c.Modified = now().UTC()
+}
+
+// IsBuried returns true if the card is currently buried. Cards are unburied
+// automatically once their BuriedUntil date is reached.
+func (c *Card) IsBuried() bool {
+	return c.BuriedUntil.After(Today())
+}
+
+// BurySiblings buries those of cards which share a note with answered, until
+// the next day, and returns the cards which were modified. Cards in one of the
+// learning queues, and those already suspended or buried, are left alone. An
+// error is returned if the ID of answered, or of any of cards, is invalid.
+func BurySiblings(answered *Card, cards []*Card) ([]*Card, error) {
+	return burySiblings(answered, cards, true, true)
+}
+
+// BurySiblings buries the siblings of answered according to the deck config's
+// bury settings, and returns the cards which were modified.
+func (dc *DeckConfig) BurySiblings(answered *Card, cards []*Card) ([]*Card, error) {
+	return burySiblings(answered, cards, dc.New.Bury, dc.Reviews.Bury)
+}
+
+func burySiblings(answered *Card, cards []*Card, buryNew, buryReviews bool) ([]*Card, error) {
+	var buried []*Card
+	noteID, err := answered.NoteID()
+	if err != nil {
+		return nil, errors.Wrapf(err, "card '%s'", answered.ID)
+	}
+	until := Today().Add(Day)
+	for _, c := range cards {
+		id, err := c.NoteID()
+		if err != nil {
+			return nil, errors.Wrapf(err, "card '%s'", c.ID)
+		}
+		if c.ID == answered.ID || id != noteID || c.Suspended || c.IsBuried() {
+			continue
+		}
+		switch c.queue() {
+		case QueueNew:
+			if !buryNew {
+				continue
+			}
+		case QueueReview:
+			if !buryReviews {
+				continue
+			}
+		default:
+			continue
+		}
+		c.AutoBuried = true
+		c.BuriedUntil = until
+		c.Modified = now().UTC()
+		buried = append(buried, c)
+	}
+	return buried, nil
+}
@@ -0,0 +1,144 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestCardBury(t *testing.T) {
+	c := &Card{ID: "card-abcd.note.0"}
+	c.Bury()
+	expected := &Card{
+		ID:          "card-abcd.note.0",
+		Modified:    now(),
+		Buried:      true,
+		BuriedUntil: parseDue("2017-01-02"),
+	}
+	if d := diff.Interface(expected, c); d != nil {
+		t.Error(d)
+	}
+	if !c.IsBuried() {
+		t.Errorf("Card should be buried")
+	}
+	c.Unbury()
+	expected = &Card{ID: "card-abcd.note.0", Modified: now()}
+	if d := diff.Interface(expected, c); d != nil {
+		t.Error(d)
+	}
+	if c.IsBuried() {
+		t.Errorf("Card should not be buried")
+	}
+}
+
+func TestCardIsBuried(t *testing.T) {
+	tests := []struct {
+		name     string
+		until    string
+		expected bool
+	}{
+		{name: "not buried"},
+		{name: "until today", until: "2017-01-01"},
+		{name: "until tomorrow", until: "2017-01-02", expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &Card{}
+			if test.until != "" {
+				c.BuriedUntil = parseDue(test.until)
+			}
+			if result := c.IsBuried(); result != test.expected {
+				t.Errorf("Unexpected result: %t", result)
+			}
+		})
+	}
+}
+
+func TestBurySiblings(t *testing.T) {
+	tests := []struct {
+		name     string
+		conf     *DeckConfig
+		answered *Card
+		cards    []*Card
+		expected []string
+		err      string
+	}{
+		{
+			name:     "no siblings",
+			answered: &Card{ID: "card-abcd.note.0"},
+			cards: []*Card{
+				{ID: "card-abcd.note.0"},
+				{ID: "card-abcd.other.1"},
+			},
+		},
+		{
+			name:     "siblings",
+			answered: &Card{ID: "card-abcd.note.0"},
+			cards: []*Card{
+				{ID: "card-abcd.note.0"},
+				{ID: "card-abcd.note.1"},
+				{ID: "card-abcd.note.2", Queue: QueueReview, Interval: Day},
+				{ID: "card-abcd.note.3", Queue: QueueLearning},
+				{ID: "card-abcd.note.4", Suspended: true},
+				{ID: "card-abcd.note.5", Buried: true, BuriedUntil: parseDue("2017-01-05")},
+			},
+			expected: []string{"card-abcd.note.1", "card-abcd.note.2"},
+		},
+		{
+			name:     "invalid answered card",
+			answered: &Card{ID: "note-abcd"},
+			err:      "card 'note-abcd': invalid ID type",
+		},
+		{
+			name:     "invalid sibling",
+			answered: &Card{ID: "card-abcd.note.0"},
+			cards:    []*Card{{ID: "card-abcd.note"}},
+			err:      "card 'card-abcd.note': invalid ID format",
+		},
+		{
+			name:     "config buries new only",
+			conf:     &DeckConfig{New: NewCardConfig{Bury: true}},
+			answered: &Card{ID: "card-abcd.note.0"},
+			cards: []*Card{
+				{ID: "card-abcd.note.1"},
+				{ID: "card-abcd.note.2", Queue: QueueReview, Interval: Day},
+			},
+			expected: []string{"card-abcd.note.1"},
+		},
+		{
+			name:     "config buries reviews only",
+			conf:     &DeckConfig{Reviews: ReviewConfig{Bury: true}},
+			answered: &Card{ID: "card-abcd.note.0"},
+			cards: []*Card{
+				{ID: "card-abcd.note.1"},
+				{ID: "card-abcd.note.2", Queue: QueueReview, Interval: Day},
+			},
+			expected: []string{"card-abcd.note.2"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result []*Card
+			var err error
+			if test.conf != nil {
+				result, err = test.conf.BurySiblings(test.answered, test.cards)
+			} else {
+				result, err = BurySiblings(test.answered, test.cards)
+			}
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, c := range result {
+				ids = append(ids, c.ID)
+				if !c.AutoBuried || c.Buried || !c.BuriedUntil.Equal(parseDue("2017-01-02")) {
+					t.Errorf("%s not auto-buried until tomorrow", c.ID)
+				}
+			}
+			if d := diff.Interface(test.expected, ids); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -3,23 +3,12 @@ package fb
 import (
 	"encoding/json"
 	"fmt"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/pkg/errors"
 )
 
-/*
-type CardQueue int
-
-const (
-	QueueNew CardQueue = iota
-	QueueLearning
-	QueueReview
-)
-*/
-
 // Card represents a struct of card-related statistics and configuration.
 type Card struct {
 	// ID is the unique ID for the card. It is a compound key, in the format:
@@ -32,63 +21,91 @@ type Card struct {
 	Imported   time.Time `json:"imported,omitempty"`
 	LastReview time.Time `json:"lastReview,omitempty"`
 	Deck       string    `json:"deck,omitempty"`
+	// HomeDeck is the deck to which the card returns when removed from the
+	// filtered deck it is in. It is empty unless Deck is a filtered deck.
+	HomeDeck string `json:"homeDeck,omitempty"`
 
 	// ModelID is a compound key refering to a specific model. It is in the
 	// format:
 	//
 	//    theme-<theme>/<model>
 	ModelID string `json:"model"`
-	// 	Queue       CardQueue      `json:"state"`
-	Suspended bool `json:"suspended,omitempty"`
-	// 	Buried      *bool          `json:"buried,omitempty"`
-	// 	AutoBuried  *bool          `json:"autoBuried,omitempty"`
+	// Queue is the study state of the card. It is changed only by answering
+	// the card, via a Scheduler.
+	Queue CardQueue `json:"state,omitempty"`
+	// LearningStep is the index of the card's current learning step, while
+	// in one of the learning queues.
+	LearningStep int  `json:"learningStep,omitempty"`
+	Suspended    bool `json:"suspended,omitempty"`
+	// Buried and AutoBuried indicate whether the card was buried manually, or
+	// automatically as the sibling of an answered card. Either way, it remains
+	// buried until BuriedUntil.
+	Buried      bool     `json:"buried,omitempty"`
+	AutoBuried  bool     `json:"autoBuried,omitempty"`
 	Due         Due      `json:"due,omitempty"`
 	BuriedUntil Due      `json:"buriedUntil,omitempty"`
 	Interval    Interval `json:"interval,omitempty"`
 	EaseFactor  float32  `json:"easeFactor,omitempty"`
-	ReviewCount int      `json:"reviewCount,omitempty"`
-	// 	LapseCount  *int           `json:"lapseCount,omitempty"`
+	// Stability and Difficulty hold the card's memory state, as used by the
+	// FSRS scheduler.
+	Stability   float32 `json:"stability,omitempty"`
+	Difficulty  float32 `json:"difficulty,omitempty"`
+	ReviewCount int     `json:"reviewCount,omitempty"`
+	// LapseCount is the number of times the card has been forgotten after
+	// graduating to the review queue.
+	LapseCount int `json:"lapseCount,omitempty"`
+	// Leech is set once the card has lapsed often enough to cross its deck's
+	// leech threshold.
+	Leech   bool        `json:"leech,omitempty"`
 	Context interface{} `json:"context,omitempty"`
 }
 
 // Validate validates that all of the data in the card appears valid and self
 // consistent. A nil return value means no errors were detected.
 func (c *Card) Validate() error {
+	return c.ValidateAll().Err()
+}
+
+// ValidateAll validates the card as Validate does, but reports every problem
+// found, rather than only the first.
+func (c *Card) ValidateAll() *ValidationReport {
+	v := newReporter()
+	c.validate(v)
+	return v.report
+}
+
+func (c *Card) validate(v *reporter) {
 	if c.ID == "" {
-		return errors.New("id required")
-	}
-	if _, _, _, err := c.parseID(); err != nil {
-		return err
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if _, err := c.CardID(); err != nil {
+		v.error("_id", ProblemInvalidID, err)
 	}
 	if c.Created.IsZero() {
-		return errors.New("created time required")
+		v.errorf("created", ProblemRequired, "created time required")
 	}
 	if c.Modified.IsZero() {
-		return errors.New("modified time required")
+		v.errorf("modified", ProblemRequired, "modified time required")
 	}
-	if _, _, err := c.parseThemeID(); err != nil {
-		return err
+	if _, err := c.ModelRef(); err != nil {
+		v.error("model", ProblemInvalidID, err)
 	}
-	return nil
-}
-
-func (c *Card) parseID() (bundleID, noteID string, templateID uint32, err error) {
-	return parseCardID(c.ID)
-}
-
-func parseCardID(id string) (bundleID, noteID string, templateID uint32, err error) {
-	if !strings.HasPrefix(id, "card-") {
-		return "", "", 0, errors.New("invalid ID type")
+	if !c.Queue.valid() {
+		v.errorf("state", ProblemInvalidValue, "invalid queue %d", c.Queue)
 	}
-	parts := strings.Split(strings.TrimPrefix(id, "card-"), ".")
-	if len(parts) != 3 {
-		return "", "", 0, errors.New("invalid ID format")
+	if c.LearningStep < 0 {
+		v.errorf("learningStep", ProblemInvalidValue, "learning step must not be negative")
+	} else if c.LearningStep > 0 && !c.Queue.learning() {
+		v.errorf("learningStep", ProblemInconsistent, "learning step not permitted in %s queue", c.Queue)
 	}
-	template, err := strconv.Atoi(parts[2])
-	if err != nil {
-		return "", "", 0, errors.Wrap(err, "invalid TemplateID")
+	if c.LapseCount < 0 {
+		v.errorf("lapseCount", ProblemInvalidValue, "lapse count must not be negative")
+	}
+	if (c.Buried || c.AutoBuried) && c.BuriedUntil.IsZero() {
+		v.errorf("buriedUntil", ProblemRequired, "buried card requires buriedUntil date")
+	}
+	if c.HomeDeck != "" && !isFilteredDeckID(c.Deck) {
+		v.errorf("homeDeck", ProblemInconsistent, "home deck not permitted outside a filtered deck")
 	}
-	return parts[0], parts[1], uint32(template), nil
 }
 
 // NewCard returns a new Card instance, with the requested id
@@ -172,75 +189,70 @@ func (c *Card) ImportedTime() time.Time { return c.Imported }
 func (c *Card) ModifiedTime() time.Time { return c.Modified }
 
 // MergeImport attempts to merge i into c, returning true on success, or false
-// if no merge was necessary.
+// if no merge was necessary. The existing card's scheduling state is always
+// kept, as described by DefaultCardMergePolicy.
 func (c *Card) MergeImport(i interface{}) (bool, error) {
-	existing, ok := i.(*Card)
-	if !ok {
-		return false, errors.Errorf("i is %T, not *fb.Card", i)
-	}
-	if c.Identity() != existing.Identity() {
-		return false, errors.New("IDs don't match")
-	}
-	if c.Imported.IsZero() || existing.Imported.IsZero() {
-		return false, errors.New("not an import")
-	}
-	if !c.Created.Equal(existing.Created) {
-		return false, errors.New("Created timestamps don't match")
-	}
-	c.Rev = existing.Rev
-	if c.Modified.After(existing.Modified) {
-		// The new version is newer than the existing one, so update
-		return true, nil
-	}
-	// The new version is older, so we need to use the version we just read
-	c.Modified = existing.Modified
-	c.Imported = existing.Imported
-	return false, nil
+	return c.MergeImportPolicy(i, DefaultCardMergePolicy())
 }
 
-// BundleID returns the card's BundleID
-func (c *Card) BundleID() string {
-	bundleID, _, _, _ := c.parseID()
-	return "bundle-" + bundleID
+// CardID returns the parsed ID of the card.
+func (c *Card) CardID() (CardID, error) {
+	return ParseCardID(c.ID)
 }
 
-// TemplateID returns the card's TemplateID
-func (c *Card) TemplateID() uint32 {
-	_, _, templateID, _ := c.parseID()
-	return templateID
+// ModelRef returns the parsed reference to the card's model.
+func (c *Card) ModelRef() (ModelRef, error) {
+	return ParseModelRef(c.ModelID)
 }
 
-// NoteID returns the card's NoteID
-func (c *Card) NoteID() string {
-	_, noteID, _, _ := c.parseID()
-	return "note-" + noteID
+// BundleID returns the ID of the card's bundle, or an error if the card's ID
+// is invalid. See CardID.
+func (c *Card) BundleID() (BundleID, error) {
+	id, err := c.CardID()
+	if err != nil {
+		return "", err
+	}
+	return id.Bundle, nil
 }
 
-const themeIDPrefix = "theme-"
-
-func (c *Card) parseThemeID() (theme string, model int, err error) {
-	if !strings.HasPrefix(c.ModelID, themeIDPrefix) {
-		return "", 0, errors.New("invalid theme ID type")
-	}
-	parts := strings.Split(strings.TrimPrefix(c.ModelID, themeIDPrefix), "/")
-	if len(parts) != 2 {
-		return "", 0, errors.New("invalid theme ID format")
+// TemplateID returns the index of the card's template, or an error if the
+// card's ID is invalid. See CardID.
+func (c *Card) TemplateID() (uint32, error) {
+	id, err := c.CardID()
+	if err != nil {
+		return 0, err
 	}
-	model, err = strconv.Atoi(parts[1])
+	return id.Template, nil
+}
+
+// NoteID returns the ID of the card's note, or an error if the card's ID is
+// invalid. See CardID.
+func (c *Card) NoteID() (NoteID, error) {
+	id, err := c.CardID()
 	if err != nil {
-		return "", 0, errors.Wrap(err, "invalid Model index")
+		return "", err
 	}
-	return parts[0], model, nil
+	return id.Note, nil
 }
 
-// ThemeID returns the fully qualified ThemeID associated with this card.
-func (c *Card) ThemeID() string {
-	theme, _, _ := c.parseThemeID()
-	return themeIDPrefix + theme
+const themeIDPrefix = "theme-"
+
+// ThemeID returns the ID of the card's theme, or an error if the card's model
+// reference is invalid. See ModelRef.
+func (c *Card) ThemeID() (ThemeID, error) {
+	ref, err := c.ModelRef()
+	if err != nil {
+		return "", err
+	}
+	return ref.Theme, nil
 }
 
-// ThemeModelID returns the integer model ID relative to the theme.
-func (c *Card) ThemeModelID() int {
-	_, model, _ := c.parseThemeID()
-	return model
+// ThemeModelID returns the ID of the card's model, relative to its theme, or
+// an error if the card's model reference is invalid. See ModelRef.
+func (c *Card) ThemeModelID() (uint32, error) {
+	ref, err := c.ModelRef()
+	if err != nil {
+		return 0, err
+	}
+	return ref.Model, nil
 }
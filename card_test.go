@@ -8,7 +8,7 @@ import (
 	"github.com/flimzy/diff"
 )
 
-func TestParseID(t *testing.T) {
+func TestCardCardID(t *testing.T) {
 	type pidTest struct {
 		name              string
 		input             string
@@ -28,7 +28,7 @@ func TestParseID(t *testing.T) {
 		{
 			name:  "invalid template",
 			input: "card-krsxg5baij2w4zdmmu.mViuXQThMLoh1G1Nlc4d_E8kR8o.boo",
-			err:   `invalid TemplateID: strconv.Atoi: parsing "boo": invalid syntax`,
+			err:   `invalid TemplateID: strconv.ParseUint: parsing "boo": invalid syntax`,
 		},
 		{
 			name:  "wrong id type",
@@ -46,13 +46,13 @@ func TestParseID(t *testing.T) {
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
 			c := &Card{ID: test.input}
-			bundle, note, template, err := c.parseID()
+			id, err := c.CardID()
 			checkErr(t, test.err, err)
 			if err != nil {
 				return
 			}
-			if bundle != test.bundle || note != test.note || template != test.template {
-				t.Errorf("Unexpected result: %s %s %d", bundle, note, template)
+			if id.Bundle.Key() != test.bundle || id.Note.Key() != test.note || id.Template != test.template {
+				t.Errorf("Unexpected result: %s %s %d", id.Bundle, id.Note, id.Template)
 			}
 		})
 	}
@@ -127,16 +127,23 @@ func TestCardMarshalJSON(t *testing.T) {
 	})
 	t.Run("full fields", func(t *testing.T) {
 		card := &Card{
-			ID:          "card-foo.bar.1",
-			ModelID:     "theme-baz/2",
-			Created:     parseTime("2017-01-01T01:01:01Z"),
-			Modified:    parseTime("2017-01-01T01:01:01Z"),
-			Imported:    parseTime("2017-01-01T01:01:01Z"),
-			BuriedUntil: Due(parseTime("2017-03-01T00:00:00Z")),
-			Deck:        "deck-foo",
-			Due:         Due(parseTime("2018-01-01T00:00:00Z")),
-			LastReview:  parseTime("2016-12-30T12:00:00Z"),
-			Suspended:   true,
+			ID:           "card-foo.bar.1",
+			ModelID:      "theme-baz/2",
+			Created:      parseTime("2017-01-01T01:01:01Z"),
+			Modified:     parseTime("2017-01-01T01:01:01Z"),
+			Imported:     parseTime("2017-01-01T01:01:01Z"),
+			BuriedUntil:  Due(parseTime("2017-03-01T00:00:00Z")),
+			Deck:         "deck-foo",
+			Due:          Due(parseTime("2018-01-01T00:00:00Z")),
+			LastReview:   parseTime("2016-12-30T12:00:00Z"),
+			Suspended:    true,
+			Stability:    3.5,
+			Difficulty:   5.25,
+			Queue:        QueueLearning,
+			LearningStep: 2,
+			LapseCount:   3,
+			Leech:        true,
+			AutoBuried:   true,
 		}
 		expected := []byte(`{
 			"type":        "card",
@@ -149,7 +156,14 @@ func TestCardMarshalJSON(t *testing.T) {
 			"deck":        "deck-foo",
 			"buriedUntil": "2017-03-01",
 			"due":         "2018-01-01",
-			"suspended":   true
+			"suspended":   true,
+			"stability":   3.5,
+			"difficulty":  5.25,
+			"state":        "learning",
+			"learningStep": 2,
+			"lapseCount":   3,
+			"leech":        true,
+			"autoBuried":   true
 		}`)
 		result, err := json.Marshal(card)
 		checkErr(t, nil, err)
@@ -187,6 +201,17 @@ func TestUnmarshalJSON(t *testing.T) {
 				Suspended: true,
 			},
 		},
+		{
+			name:  "with queue",
+			input: `{"_id":"card-krsxg5baij2w4zdmmu.mViuXQThMLoh1G1Nlc4d_E8kR8o.1", "model": "theme-foo/2", "state":"relearning", "created":"2017-01-01T01:01:01Z", "modified":"2017-01-01T01:01:01Z"}`,
+			expected: &Card{
+				ID:       "card-krsxg5baij2w4zdmmu.mViuXQThMLoh1G1Nlc4d_E8kR8o.1",
+				ModelID:  "theme-foo/2",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-01-01T01:01:01Z"),
+				Queue:    QueueRelearning,
+			},
+		},
 		{
 			name: "test frozen card",
 			input: `
@@ -359,18 +384,22 @@ func TestMergeImport(t *testing.T) {
 
 func TestCardBundleID(t *testing.T) {
 	card := &Card{ID: "card-foo.bar.1"}
-	expected := "bundle-foo"
-	if id := card.BundleID(); id != expected {
-		t.Errorf("Unexpected result: %s", id)
+	expected := BundleID("bundle-foo")
+	if id, err := card.BundleID(); err != nil || id != expected {
+		t.Errorf("Unexpected result: %s, %v", id, err)
 	}
+	_, err := (&Card{ID: "note-foo"}).BundleID()
+	checkErr(t, "invalid ID type", err)
 }
 
 func TestTemplateID(t *testing.T) {
 	expected := uint32(3)
 	card := &Card{ID: "card-foo.bar.3"}
-	if id := card.TemplateID(); id != expected {
-		t.Errorf("Unexpected result: %d", id)
+	if id, err := card.TemplateID(); err != nil || id != expected {
+		t.Errorf("Unexpected result: %d, %v", id, err)
 	}
+	_, err := (&Card{ID: "card-foo.bar"}).TemplateID()
+	checkErr(t, "invalid ID format", err)
 }
 
 // func TestModelID(t *testing.T) {
@@ -383,10 +412,12 @@ func TestTemplateID(t *testing.T) {
 
 func TestCardNoteID(t *testing.T) {
 	card := &Card{ID: "card-foo.bar.1"}
-	expected := "note-bar"
-	if id := card.NoteID(); id != expected {
-		t.Errorf("Unexpected result: %s", id)
+	expected := NoteID("note-bar")
+	if id, err := card.NoteID(); err != nil || id != expected {
+		t.Errorf("Unexpected result: %s, %v", id, err)
 	}
+	_, err := (&Card{}).NoteID()
+	checkErr(t, "invalid ID type", err)
 }
 
 func TestCardValidate(t *testing.T) {
@@ -422,21 +453,62 @@ func TestCardValidate(t *testing.T) {
 				ModelID: "chicken"},
 			err: "invalid theme ID type",
 		},
+		{
+			name: "invalid queue",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", Queue: 7},
+			err: "invalid queue 7",
+		},
+		{
+			name: "negative learning step",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", Queue: QueueLearning, LearningStep: -1},
+			err: "learning step must not be negative",
+		},
+		{
+			name: "learning step outside learning queue",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", Queue: QueueReview, LearningStep: 1},
+			err: "learning step not permitted in review queue",
+		},
+		{
+			name: "negative lapse count",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", LapseCount: -1},
+			err: "lapse count must not be negative",
+		},
+		{
+			name: "buried without date",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", AutoBuried: true},
+			err: "buried card requires buriedUntil date",
+		},
+		{
+			name: "home deck outside filtered deck",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", Deck: "deck-AQ", HomeDeck: "deck-Ag"},
+			err: "home deck not permitted outside a filtered deck",
+		},
 		{
 			name: "valid",
 			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
 				ModelID: "theme-foo/2"},
 		},
+		{
+			name: "valid learning card",
+			v: &Card{ID: "card-foo.bar.0", Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"),
+				ModelID: "theme-foo/2", Queue: QueueRelearning, LearningStep: 1},
+		},
 	}
 	testValidation(t, tests)
 }
 
-func TestParseThemeID(t *testing.T) {
+func TestCardModelRef(t *testing.T) {
 	type ptiTest struct {
 		name  string
 		card  *Card
 		theme string
-		model int
+		model uint32
 		err   string
 	}
 	tests := []ptiTest{
@@ -458,7 +530,7 @@ func TestParseThemeID(t *testing.T) {
 		{
 			name: "invalid model id",
 			card: &Card{ModelID: "theme-foo/bar"},
-			err:  `invalid Model index: strconv.Atoi: parsing "bar": invalid syntax`,
+			err:  `invalid Model index: strconv.ParseUint: parsing "bar": invalid syntax`,
 		},
 		{
 			name:  "valid",
@@ -469,13 +541,13 @@ func TestParseThemeID(t *testing.T) {
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			theme, model, err := test.card.parseThemeID()
+			ref, err := test.card.ModelRef()
 			checkErr(t, test.err, err)
 			if err != nil {
 				return
 			}
-			if theme != test.theme || model != test.model {
-				t.Errorf("Unexpected result: %s %d", theme, model)
+			if ref.Theme != ThemeID("theme-"+test.theme) || ref.Model != test.model {
+				t.Errorf("Unexpected result: %s %d", ref.Theme, ref.Model)
 			}
 		})
 	}
@@ -483,16 +555,20 @@ func TestParseThemeID(t *testing.T) {
 
 func TestCardThemeID(t *testing.T) {
 	card := &Card{ModelID: "theme-foo/2"}
-	expected := "theme-foo"
-	if id := card.ThemeID(); id != expected {
-		t.Errorf("Unexpected result: %s", id)
+	expected := ThemeID("theme-foo")
+	if id, err := card.ThemeID(); err != nil || id != expected {
+		t.Errorf("Unexpected result: %s, %v", id, err)
 	}
+	_, err := (&Card{ModelID: "foo/2"}).ThemeID()
+	checkErr(t, "invalid theme ID type", err)
 }
 
 func TestCardThemeModelID(t *testing.T) {
 	card := &Card{ModelID: "theme-foo/2"}
-	expected := 2
-	if id := card.ThemeModelID(); id != expected {
-		t.Errorf("Unexpected result: %d", id)
+	expected := uint32(2)
+	if id, err := card.ThemeModelID(); err != nil || id != expected {
+		t.Errorf("Unexpected result: %d, %v", id, err)
 	}
+	_, err := (&Card{ModelID: "theme-foo/x"}).ThemeModelID()
+	checkErr(t, `invalid Model index: strconv.ParseUint: parsing "x": invalid syntax`, err)
 }
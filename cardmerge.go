@@ -0,0 +1,187 @@
+package fb
+
+import (
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CardField names a field of a card which may be merged by a CardMergePolicy.
+// The names match the card's JSON field names.
+type CardField string
+
+// The card fields subject to a CardMergePolicy.
+const (
+	CardFieldDeck         CardField = "deck"
+	CardFieldModel        CardField = "model"
+	CardFieldLastReview   CardField = "lastReview"
+	CardFieldQueue        CardField = "state"
+	CardFieldLearningStep CardField = "learningStep"
+	CardFieldSuspended    CardField = "suspended"
+	CardFieldBuried       CardField = "buried"
+	CardFieldAutoBuried   CardField = "autoBuried"
+	CardFieldDue          CardField = "due"
+	CardFieldBuriedUntil  CardField = "buriedUntil"
+	CardFieldInterval     CardField = "interval"
+	CardFieldEaseFactor   CardField = "easeFactor"
+	CardFieldStability    CardField = "stability"
+	CardFieldDifficulty   CardField = "difficulty"
+	CardFieldReviewCount  CardField = "reviewCount"
+	CardFieldLapseCount   CardField = "lapseCount"
+	CardFieldLeech        CardField = "leech"
+	CardFieldContext      CardField = "context"
+)
+
+// cardFields copies each mergeable field from src to dst.
+var cardFields = map[CardField]func(dst, src *Card){
+	CardFieldDeck:         func(dst, src *Card) { dst.Deck = src.Deck },
+	CardFieldModel:        func(dst, src *Card) { dst.ModelID = src.ModelID },
+	CardFieldLastReview:   func(dst, src *Card) { dst.LastReview = src.LastReview },
+	CardFieldQueue:        func(dst, src *Card) { dst.Queue = src.Queue },
+	CardFieldLearningStep: func(dst, src *Card) { dst.LearningStep = src.LearningStep },
+	CardFieldSuspended:    func(dst, src *Card) { dst.Suspended = src.Suspended },
+	CardFieldBuried:       func(dst, src *Card) { dst.Buried = src.Buried },
+	CardFieldAutoBuried:   func(dst, src *Card) { dst.AutoBuried = src.AutoBuried },
+	CardFieldDue:          func(dst, src *Card) { dst.Due = src.Due },
+	CardFieldBuriedUntil:  func(dst, src *Card) { dst.BuriedUntil = src.BuriedUntil },
+	CardFieldInterval:     func(dst, src *Card) { dst.Interval = src.Interval },
+	CardFieldEaseFactor:   func(dst, src *Card) { dst.EaseFactor = src.EaseFactor },
+	CardFieldStability:    func(dst, src *Card) { dst.Stability = src.Stability },
+	CardFieldDifficulty:   func(dst, src *Card) { dst.Difficulty = src.Difficulty },
+	CardFieldReviewCount:  func(dst, src *Card) { dst.ReviewCount = src.ReviewCount },
+	CardFieldLapseCount:   func(dst, src *Card) { dst.LapseCount = src.LapseCount },
+	CardFieldLeech:        func(dst, src *Card) { dst.Leech = src.Leech },
+	CardFieldContext:      func(dst, src *Card) { dst.Context = src.Context },
+}
+
+// MergeStrategy determines which version of a field is kept when an imported
+// card is merged with an existing one.
+type MergeStrategy int
+
+const (
+	// MergeNewer keeps the value of whichever card was modified more
+	// recently.
+	MergeNewer MergeStrategy = iota
+	// KeepExisting always keeps the value of the existing card.
+	KeepExisting
+	// TakeImported always takes the value of the imported card.
+	TakeImported
+)
+
+// CardMergePolicy selects the MergeStrategy for each field of a card. Fields
+// not listed are merged with MergeNewer.
+type CardMergePolicy map[CardField]MergeStrategy
+
+// DefaultCardMergePolicy returns the policy used by Card.MergeImport. It
+// keeps all of the existing card's scheduling state, so that re-importing a
+// deck never resets study progress, while content changes, the card's model
+// and deck, are always taken from the import. As studying a card updates its
+// modification time, an import is usually older than a card which has been
+// studied, so these cannot be merged with MergeNewer.
+func DefaultCardMergePolicy() CardMergePolicy {
+	return CardMergePolicy{
+		CardFieldDeck:         TakeImported,
+		CardFieldModel:        TakeImported,
+		CardFieldLastReview:   KeepExisting,
+		CardFieldQueue:        KeepExisting,
+		CardFieldLearningStep: KeepExisting,
+		CardFieldSuspended:    KeepExisting,
+		CardFieldBuried:       KeepExisting,
+		CardFieldAutoBuried:   KeepExisting,
+		CardFieldDue:          KeepExisting,
+		CardFieldBuriedUntil:  KeepExisting,
+		CardFieldInterval:     KeepExisting,
+		CardFieldEaseFactor:   KeepExisting,
+		CardFieldStability:    KeepExisting,
+		CardFieldDifficulty:   KeepExisting,
+		CardFieldReviewCount:  KeepExisting,
+		CardFieldLapseCount:   KeepExisting,
+		CardFieldLeech:        KeepExisting,
+		CardFieldContext:      KeepExisting,
+	}
+}
+
+// Validate returns an error if the policy names an unknown field or strategy.
+func (p CardMergePolicy) Validate() error {
+	fields := make([]string, 0, len(p))
+	for field := range p {
+		fields = append(fields, string(field))
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		if _, ok := cardFields[CardField(field)]; !ok {
+			return errors.Errorf("unknown card field '%s'", field)
+		}
+		if s := p[CardField(field)]; s < MergeNewer || s > TakeImported {
+			return errors.Errorf("invalid merge strategy %d for card field '%s'", s, field)
+		}
+	}
+	return nil
+}
+
+// MergeImportPolicy merges c, a newly imported card, with i, the existing
+// copy of the same card, field by field according to policy. The result is
+// stored in c. It returns true if the import is newer than the existing card,
+// or if any field taken from the import differs from the existing card,
+// meaning that c should be saved, or false if no merge was necessary.
+func (c *Card) MergeImportPolicy(i interface{}, policy CardMergePolicy) (bool, error) {
+	existing, ok := i.(*Card)
+	if !ok {
+		return false, errors.Errorf("i is %T, not *fb.Card", i)
+	}
+	if err := policy.Validate(); err != nil {
+		return false, err
+	}
+	if c.Identity() != existing.Identity() {
+		return false, errors.New("IDs don't match")
+	}
+	if c.Imported.IsZero() || existing.Imported.IsZero() {
+		return false, errors.New("not an import")
+	}
+	if !c.Created.Equal(existing.Created) {
+		return false, errors.New("Created timestamps don't match")
+	}
+	c.Rev = existing.Rev
+	newer := c.Modified.After(existing.Modified)
+	// Fields taken from the import are compared with the existing card, as
+	// it would be outside of any filtered deck
+	base := *existing
+	if base.HomeDeck != "" {
+		base.Deck = base.HomeDeck
+	}
+	var changed bool
+	for field, copyField := range cardFields {
+		switch policy[field] {
+		case KeepExisting:
+			copyField(c, existing)
+		case MergeNewer:
+			if !newer {
+				copyField(c, existing)
+			}
+		case TakeImported:
+			probe := base
+			copyField(&probe, c)
+			changed = changed || !reflect.DeepEqual(probe, base)
+		}
+	}
+	if existing.HomeDeck != "" {
+		// The existing card is in a filtered deck, where it stays, so the
+		// merged deck becomes its home deck
+		if c.Deck == existing.Deck {
+			c.HomeDeck = existing.HomeDeck
+		} else {
+			c.HomeDeck = c.Deck
+		}
+		c.Deck = existing.Deck
+	}
+	if !newer {
+		// The new version is older, so we need to use the version we just
+		// read, noting only the import of any fields taken from it
+		c.Modified = existing.Modified
+		if !changed {
+			c.Imported = existing.Imported
+		}
+	}
+	return newer || changed, nil
+}
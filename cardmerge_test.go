@@ -0,0 +1,210 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestCardMergePolicyValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy CardMergePolicy
+		err    string
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:   "default",
+			policy: DefaultCardMergePolicy(),
+		},
+		{
+			name:   "unknown field",
+			policy: CardMergePolicy{"foo": KeepExisting, CardFieldDue: KeepExisting},
+			err:    "unknown card field 'foo'",
+		},
+		{
+			name:   "invalid strategy",
+			policy: CardMergePolicy{CardFieldDue: 7},
+			err:    "invalid merge strategy 7 for card field 'due'",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkErr(t, test.err, test.policy.Validate())
+		})
+	}
+}
+
+func TestCardMergeImportPolicy(t *testing.T) {
+	existing := func() *Card {
+		return &Card{ID: "card-foo.bar.1",
+			Rev:         "2-abc",
+			Created:     parseTime("2017-01-01T00:00:00Z"),
+			Modified:    parseTime("2017-01-10T00:00:00Z"),
+			Imported:    parseTime("2017-01-01T00:00:00Z"),
+			LastReview:  parseTime("2017-01-10T00:00:00Z"),
+			Deck:        "deck-Zm9v",
+			ModelID:     "theme-abcd/0",
+			Queue:       QueueReview,
+			Due:         parseDue("2017-01-20"),
+			Interval:    parseInterval("10d"),
+			EaseFactor:  2.5,
+			ReviewCount: 4,
+			Suspended:   true,
+		}
+	}
+	imported := func(modified string) *Card {
+		return &Card{ID: "card-foo.bar.1",
+			Created:  parseTime("2017-01-01T00:00:00Z"),
+			Modified: parseTime(modified),
+			Imported: parseTime("2017-02-01T00:00:00Z"),
+			Deck:     "deck-YmFy",
+			ModelID:  "theme-abcd/1",
+		}
+	}
+	tests := []struct {
+		name     string
+		card     *Card
+		policy   CardMergePolicy
+		filtered bool
+		expected bool
+		result   *Card
+		err      string
+	}{
+		{
+			name:   "invalid policy",
+			card:   imported("2017-01-15T00:00:00Z"),
+			policy: CardMergePolicy{"foo": KeepExisting},
+			err:    "unknown card field 'foo'",
+		},
+		{
+			name:     "newer import keeps progress",
+			card:     imported("2017-01-15T00:00:00Z"),
+			policy:   DefaultCardMergePolicy(),
+			expected: true,
+			result: func() *Card {
+				c := existing()
+				c.Modified = parseTime("2017-01-15T00:00:00Z")
+				c.Imported = parseTime("2017-02-01T00:00:00Z")
+				c.Deck = "deck-YmFy"
+				c.ModelID = "theme-abcd/1"
+				return c
+			}(),
+		},
+		{
+			name:     "reviewed after import",
+			card:     imported("2017-01-05T00:00:00Z"),
+			policy:   DefaultCardMergePolicy(),
+			expected: true,
+			result: func() *Card {
+				c := existing()
+				c.Imported = parseTime("2017-02-01T00:00:00Z")
+				c.Deck = "deck-YmFy"
+				c.ModelID = "theme-abcd/1"
+				return c
+			}(),
+		},
+		{
+			name: "reviewed after unchanged import",
+			card: func() *Card {
+				c := imported("2017-01-05T00:00:00Z")
+				c.Deck, c.ModelID = "deck-Zm9v", "theme-abcd/0"
+				return c
+			}(),
+			policy: DefaultCardMergePolicy(),
+			result: existing(),
+		},
+		{
+			name:     "older import, take imported deck",
+			card:     imported("2017-01-05T00:00:00Z"),
+			policy:   CardMergePolicy{CardFieldDeck: TakeImported},
+			expected: true,
+			result: func() *Card {
+				c := existing()
+				c.Imported = parseTime("2017-02-01T00:00:00Z")
+				c.Deck = "deck-YmFy"
+				return c
+			}(),
+		},
+		{
+			name:     "newer import, newer wins",
+			card:     imported("2017-01-15T00:00:00Z"),
+			policy:   CardMergePolicy{CardFieldModel: KeepExisting},
+			expected: true,
+			result: func() *Card {
+				c := imported("2017-01-15T00:00:00Z")
+				c.Rev = "2-abc"
+				c.ModelID = "theme-abcd/0"
+				return c
+			}(),
+		},
+		{
+			name:     "newer import, existing in filtered deck",
+			card:     imported("2017-01-15T00:00:00Z"),
+			policy:   DefaultCardMergePolicy(),
+			filtered: true,
+			expected: true,
+			result: func() *Card {
+				c := existing()
+				c.Modified = parseTime("2017-01-15T00:00:00Z")
+				c.Imported = parseTime("2017-02-01T00:00:00Z")
+				c.Deck = "fdeck-AQ"
+				c.HomeDeck = "deck-YmFy"
+				c.ModelID = "theme-abcd/1"
+				return c
+			}(),
+		},
+		{
+			name:     "older import, existing in filtered deck",
+			card:     imported("2017-01-05T00:00:00Z"),
+			policy:   DefaultCardMergePolicy(),
+			filtered: true,
+			expected: true,
+			result: func() *Card {
+				c := existing()
+				c.Imported = parseTime("2017-02-01T00:00:00Z")
+				c.Deck = "fdeck-AQ"
+				c.HomeDeck = "deck-YmFy"
+				c.ModelID = "theme-abcd/1"
+				return c
+			}(),
+		},
+		{
+			name: "reviewed after unchanged import, existing in filtered deck",
+			card: func() *Card {
+				c := imported("2017-01-05T00:00:00Z")
+				c.Deck, c.ModelID = "deck-Zm9v", "theme-abcd/0"
+				return c
+			}(),
+			policy:   DefaultCardMergePolicy(),
+			filtered: true,
+			result: func() *Card {
+				c := existing()
+				c.Deck = "fdeck-AQ"
+				c.HomeDeck = "deck-Zm9v"
+				return c
+			}(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ex := existing()
+			if test.filtered {
+				ex.HomeDeck, ex.Deck = ex.Deck, "fdeck-AQ"
+			}
+			result, err := test.card.MergeImportPolicy(ex, test.policy)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result != test.expected {
+				t.Errorf("Unexpected result: %t", result)
+			}
+			if d := diff.Interface(test.result, test.card); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
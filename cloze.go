@@ -0,0 +1,120 @@
+package fb
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Cloze represents a single cloze deletion, as marked up in a field value in
+// the Anki format: {{c1::text::hint}}
+type Cloze struct {
+	// Index is the cloze number, starting at 1. Clozes with the same index
+	// are hidden together, on the same card.
+	Index int
+	Text  string
+	Hint  string
+}
+
+var clozeRE = regexp.MustCompile(`(?s)\{\{c(\d+)::(.*?)(?:::(.*?))?\}\}`)
+
+// ParseClozes returns the cloze deletions found in text, in the order they
+// appear.
+func ParseClozes(text string) []Cloze {
+	var clozes []Cloze
+	for _, match := range clozeRE.FindAllStringSubmatch(text, -1) {
+		index, err := strconv.Atoi(match[1])
+		if err != nil || index < 1 {
+			continue
+		}
+		clozes = append(clozes, Cloze{
+			Index: index,
+			Text:  match[2],
+			Hint:  match[3],
+		})
+	}
+	return clozes
+}
+
+// TemplateOrdinals returns the template IDs of the cards which should exist
+// for the note. For cloze models, there is one card per cloze index used in
+// any of the note's fields, with the template ID one less than the cloze
+// index. For other models, there is one card per template.
+func (n *Note) TemplateOrdinals() ([]uint32, error) {
+	if n.Model == nil {
+		return nil, errors.New("model required")
+	}
+	if n.Model.Type != AnkiClozeModel {
+		ords := make([]uint32, len(n.Model.Templates))
+		for i := range n.Model.Templates {
+			ords[i] = uint32(i)
+		}
+		return ords, nil
+	}
+	seen := make(map[uint32]struct{})
+	for _, fv := range n.FieldValues {
+		if fv == nil {
+			continue
+		}
+		for _, c := range ParseClozes(fv.Text) {
+			seen[uint32(c.Index-1)] = struct{}{}
+		}
+	}
+	ords := make([]uint32, 0, len(seen))
+	for ord := range seen {
+		ords = append(ords, ord)
+	}
+	sort.Slice(ords, func(i, j int) bool { return ords[i] < ords[j] })
+	return ords, nil
+}
+
+// SyncCards compares the note's cards, as given by existing, with those which
+// should exist according to TemplateOrdinals. Any missing cards are created
+// in the bundle with the provided ID, and returned as created. Existing cards
+// which no longer correspond to a template or cloze are returned as retired,
+// for the caller to remove.
+func (n *Note) SyncCards(bundleID string, existing []*Card) (created, retired []*Card, err error) {
+	if err := validateDBID(bundleID); err != nil {
+		return nil, nil, errors.Wrap(err, "invalid bundle ID")
+	}
+	ords, err := n.TemplateOrdinals()
+	if err != nil {
+		return nil, nil, err
+	}
+	want := make(map[uint32]bool, len(ords))
+	for _, ord := range ords {
+		want[ord] = true
+	}
+	have := make(map[uint32]bool, len(existing))
+	for _, c := range existing {
+		id, err := c.CardID()
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "card '%s'", c.ID)
+		}
+		if id.Note != NoteID(n.ID) {
+			return nil, nil, errors.Errorf("card '%s' does not belong to note '%s'", c.ID, n.ID)
+		}
+		ord := id.Template
+		have[ord] = true
+		if !want[ord] {
+			retired = append(retired, c)
+		}
+	}
+	for _, ord := range ords {
+		if have[ord] {
+			continue
+		}
+		id, err := NewCardID(BundleID(bundleID), NoteID(n.ID), ord)
+		if err != nil {
+			return nil, nil, err
+		}
+		c, err := NewCard(n.ThemeID, n.ModelID, id.String())
+		if err != nil {
+			return nil, nil, err
+		}
+		created = append(created, c)
+	}
+	return created, retired, nil
+}
@@ -0,0 +1,184 @@
+package fb
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestParseClozes(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected []Cloze
+	}{
+		{
+			name: "no clozes",
+			text: "Canberra is the capital of Australia",
+		},
+		{
+			name: "clozes",
+			text: "{{c1::Canberra}} is the capital of {{c2::Australia::country}}",
+			expected: []Cloze{
+				{Index: 1, Text: "Canberra"},
+				{Index: 2, Text: "Australia", Hint: "country"},
+			},
+		},
+		{
+			name: "repeated index",
+			text: "{{c1::foo}} {{c1::bar}}",
+			expected: []Cloze{
+				{Index: 1, Text: "foo"},
+				{Index: 1, Text: "bar"},
+			},
+		},
+		{
+			name:     "multi-line",
+			text:     "{{c3::foo\nbar}}",
+			expected: []Cloze{{Index: 3, Text: "foo\nbar"}},
+		},
+		{
+			name: "invalid index",
+			text: "{{c0::foo}} {{cx::bar}}",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := ParseClozes(test.text)
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func testClozeNote(modelType string, templates int, values ...string) *Note {
+	th, _ := NewTheme("theme-Zm9v")
+	m, _ := th.NewModel(modelType)
+	for i := 0; i < templates; i++ {
+		m.Templates = append(m.Templates, &Template{Name: fmt.Sprintf("Card %d", i+1)})
+	}
+	n := &Note{ID: "note-YmFy", ThemeID: th.ID, Model: m}
+	for _, v := range values {
+		n.FieldValues = append(n.FieldValues, &FieldValue{Text: v})
+	}
+	return n
+}
+
+func TestNoteTemplateOrdinals(t *testing.T) {
+	tests := []struct {
+		name     string
+		note     *Note
+		expected []uint32
+		err      string
+	}{
+		{
+			name: "no model",
+			note: &Note{},
+			err:  "model required",
+		},
+		{
+			name:     "standard model",
+			note:     testClozeNote(AnkiStandardModel, 2, "{{c1::foo}}"),
+			expected: []uint32{0, 1},
+		},
+		{
+			name:     "cloze model",
+			note:     testClozeNote(AnkiClozeModel, 1, "{{c3::foo}} {{c1::bar}}", "{{c1::baz}}", ""),
+			expected: []uint32{0, 2},
+		},
+		{
+			name:     "cloze model without clozes",
+			note:     testClozeNote(AnkiClozeModel, 1, "foo"),
+			expected: []uint32{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.note.TemplateOrdinals()
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestNoteSyncCards(t *testing.T) {
+	const bundleID = "bundle-krsxg5baij2w4zdmmu"
+	tests := []struct {
+		name            string
+		note            *Note
+		bundleID        string
+		existing        []*Card
+		expectedCreated []string
+		expectedRetired []string
+		err             string
+	}{
+		{
+			name:     "invalid bundle",
+			note:     testClozeNote(AnkiClozeModel, 1, "{{c1::foo}}"),
+			bundleID: "foo",
+			err:      "invalid bundle ID: invalid DBID format",
+		},
+		{
+			name:     "foreign card",
+			note:     testClozeNote(AnkiClozeModel, 1, "{{c1::foo}}"),
+			bundleID: bundleID,
+			existing: []*Card{{ID: "card-krsxg5baij2w4zdmmu.Zm9v.0"}},
+			err:      "card 'card-krsxg5baij2w4zdmmu.Zm9v.0' does not belong to note 'note-YmFy'",
+		},
+		{
+			name:            "new note",
+			note:            testClozeNote(AnkiClozeModel, 1, "{{c1::foo}} {{c2::bar}}"),
+			bundleID:        bundleID,
+			expectedCreated: []string{"card-krsxg5baij2w4zdmmu.YmFy.0", "card-krsxg5baij2w4zdmmu.YmFy.1"},
+		},
+		{
+			name:     "cloze added and removed",
+			note:     testClozeNote(AnkiClozeModel, 1, "{{c1::foo}} {{c3::bar}}"),
+			bundleID: bundleID,
+			existing: []*Card{
+				{ID: "card-krsxg5baij2w4zdmmu.YmFy.0"},
+				{ID: "card-krsxg5baij2w4zdmmu.YmFy.1"},
+			},
+			expectedCreated: []string{"card-krsxg5baij2w4zdmmu.YmFy.2"},
+			expectedRetired: []string{"card-krsxg5baij2w4zdmmu.YmFy.1"},
+		},
+		{
+			name:     "unchanged",
+			note:     testClozeNote(AnkiStandardModel, 1, "foo"),
+			bundleID: bundleID,
+			existing: []*Card{{ID: "card-krsxg5baij2w4zdmmu.YmFy.0"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			created, retired, err := test.note.SyncCards(test.bundleID, test.existing)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			var createdIDs, retiredIDs []string
+			for _, c := range created {
+				createdIDs = append(createdIDs, c.ID)
+				if c.ModelID != "theme-Zm9v/0" {
+					t.Errorf("Unexpected model ID %s", c.ModelID)
+				}
+			}
+			for _, c := range retired {
+				retiredIDs = append(retiredIDs, c.ID)
+			}
+			if d := diff.Interface(test.expectedCreated, createdIDs); d != nil {
+				t.Error(d)
+			}
+			if d := diff.Interface(test.expectedRetired, retiredIDs); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package fb
 import (
 	"encoding/json"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -17,12 +18,19 @@ type CardCollection struct {
 // Validate validates that all of the data in the card collection appears valid
 // and self consistent. A nil return value means no errors were detected.
 func (cc *CardCollection) Validate() error {
-	for cid := range cc.col {
-		if _, _, _, err := parseCardID(cid); err != nil {
-			return errors.Wrapf(err, "'%s'", cid)
+	v := newReporter()
+	cc.validate(v)
+	return v.report.Err()
+}
+
+// validate reports invalid card IDs by their index in the sorted list, as
+// they are stored.
+func (cc *CardCollection) validate(v *reporter) {
+	for i, cid := range cc.All() {
+		if _, err := ParseCardID(cid); err != nil {
+			v.error("["+strconv.Itoa(i)+"]", ProblemInvalidID, errors.Wrapf(err, "'%s'", cid))
 		}
 	}
-	return nil
 }
 
 // MarshalJSON fulfills the json.Marshaler interface for the CardCollection type.
@@ -68,83 +76,73 @@ func (cc *CardCollection) All() []string {
 
 // Deck represents a Flashback Deck
 type Deck struct {
-	ID          string          `json:"_id"`
-	Rev         string          `json:"_rev,omitempty"`
-	Created     time.Time       `json:"created"`
-	Modified    time.Time       `json:"modified"`
-	Imported    time.Time       `json:"imported,omitempty"`
-	Name        string          `json:"name,omitempty"`
-	Description string          `json:"description,omitempty"`
-	Cards       *CardCollection `json:"cards,omitempty"`
+	ID          string    `json:"_id"`
+	Rev         string    `json:"_rev,omitempty"`
+	Created     time.Time `json:"created"`
+	Modified    time.Time `json:"modified"`
+	Imported    time.Time `json:"imported,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	// ConfigID is the ID of the DeckConfig which controls the study options
+	// of the deck. If empty, the default options are used.
+	ConfigID string `json:"config,omitempty"`
+	// ParentID is the ID of the deck's parent, or empty for a top-level deck.
+	ParentID string `json:"parent,omitempty"`
+	// Parent is the deck's parent, once linked by NewDeckTree or
+	// SetParent.
+	Parent *Deck           `json:"-"`
+	Cards  *CardCollection `json:"cards,omitempty"`
 }
 
 // Validate validates that all of the data in the deck appears valid and
 // self consistent. A nil return value means no errors were detected.
 func (d *Deck) Validate() error {
+	return d.ValidateAll().Err()
+}
+
+// ValidateAll validates the deck as Validate does, but reports every problem
+// found, rather than only the first.
+func (d *Deck) ValidateAll() *ValidationReport {
+	v := newReporter()
+	d.validate(v)
+	return v.report
+}
+
+func (d *Deck) validate(v *reporter) {
 	if d.ID == "" {
-		return errors.New("id required")
-	}
-	if err := validateDocID(d.ID); err != nil {
-		return err
-	}
-	if !strings.HasPrefix(d.ID, "deck-") {
-		return errors.New("incorrect doc type")
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if err := validateDocID(d.ID); err != nil {
+		v.error("_id", ProblemInvalidID, err)
+	} else if !strings.HasPrefix(d.ID, "deck-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
 	}
 	if d.Created.IsZero() {
-		return errors.New("created time required")
+		v.errorf("created", ProblemRequired, "created time required")
 	}
 	if d.Modified.IsZero() {
-		return errors.New("modified time required")
+		v.errorf("modified", ProblemRequired, "modified time required")
 	}
-	if d.Cards == nil {
-		return errors.New("collection is nil")
+	if d.ConfigID != "" {
+		if err := validateDocID(d.ConfigID); err != nil {
+			v.error("config", ProblemInvalidID, errors.Wrap(err, "invalid config ID"))
+		} else if !strings.HasPrefix(d.ConfigID, "dconf-") {
+			v.errorf("config", ProblemInvalidID, "invalid config ID: incorrect doc type")
+		}
 	}
-	if err := d.Cards.Validate(); err != nil {
-		return err
+	if d.ParentID != "" {
+		if err := validateDocID(d.ParentID); err != nil {
+			v.error("parent", ProblemInvalidID, errors.Wrap(err, "invalid parent ID"))
+		} else if !strings.HasPrefix(d.ParentID, "deck-") {
+			v.errorf("parent", ProblemInvalidID, "invalid parent ID: incorrect doc type")
+		}
+	}
+	if d.Cards == nil {
+		v.errorf("cards", ProblemRequired, "collection is nil")
+	} else {
+		d.Cards.validate(v.at("cards"))
 	}
-	return nil
 }
 
-/*
-type Deck struct {
-	ConfigID                ID                `json:"conf"`             // ID of option group from dconf in `col` table
-}
-
-type DeckConfig struct {
-	ID               ID                `json:"id"`       // Deck ID
-	Name             string            `json:"name"`     // Deck Name
-	ReplayAudio      bool              `json:"replayq"`  // When answer shown, replay both question and answer audio
-	ShowTimer        BoolInt           `json:"timer"`    // Show answer timer
-	MaxAnswerSeconds int               `json:"maxTaken"` // Ignore answers that take longer than this many seconds
-	Modified         *TimestampSeconds `json:"mod"`      // Modified timestamp
-	AutoPlay         bool              `json:"autoplay"` // Automatically play audio
-	Lapses           struct {
-		LeechFails      int               `json:"leechFails"`  // Leech threshold
-		MinimumInterval DurationDays      `json:"minInt"`      // Minimum interval in days
-		LeechAction     LeechAction       `json:"leechAction"` // Leech action: Suspend or Tag Only
-		Delays          []DurationMinutes `json:"delays"`      // Steps in minutes
-		NewInterval     float32           `json:"mult"`        // New Interval Multiplier
-	} `json:"lapse"`
-	Reviews struct {
-		PerDay           int          `json:"perDay"` // Maximum reviews per day
-		Fuzz             float32      `json:"fuzz"`   // Apparently not used?
-		IntervalModifier float32      `json:"ivlFct"` // Interval modifier (fraction)
-		MaxInterval      DurationDays `json:"maxIvl"` // Maximum interval in days
-		EasyBonus        float32      `json:ease4"`   // Easy bonus
-		Bury             bool         `json:"bury"`   // Bury related reviews until next day
-	} `json:"rev"`
-	New struct {
-		PerDay        int               `json:"perDay"`        // Maximum new cards per day
-		Delays        []DurationMinutes `json:"delays"`        // Steps in minutes
-		Bury          bool              `json:"bury"`          // Bury related cards until the next day
-		Separate      bool              `json:"separate"`      // Unused??
-		Intervals     [3]DurationDays   `json:"ints"`          // Intervals??
-		InitialFactor float32           `json:"initialFactor"` // Starting Ease
-		Order         NewCardOrder      `json:"order"`         // New card order: Random, or order added
-	} `json:"new"`
-}
-*/
-
 // NewDeck creates a new Deck with the provided id.
 func NewDeck(id string) (*Deck, error) {
 	d := &Deck{
@@ -230,6 +228,9 @@ func (d *Deck) MergeImport(i interface{}) (bool, error) {
 	d.Imported = existing.Imported
 	d.Name = existing.Name
 	d.Description = existing.Description
+	d.ConfigID = existing.ConfigID
+	d.ParentID = existing.ParentID
+	d.Parent = existing.Parent
 	d.Cards = existing.Cards
 	return false, nil
 }
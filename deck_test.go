@@ -162,6 +162,7 @@ func TestDeckMarshalJSON(t *testing.T) {
 				Imported:    now(),
 				Name:        "test name",
 				Description: "test description",
+				ConfigID:    "dconf-Zm9v",
 				Cards: &CardCollection{col: map[string]struct{}{
 					"card-Zm9v.bmlsCg.0": {}, "card-YmFy.bmlsCg.0": {},
 				}},
@@ -171,6 +172,7 @@ func TestDeckMarshalJSON(t *testing.T) {
 				"type":        "deck",
 				"name":        "test name",
 				"description": "test description",
+				"config":      "dconf-Zm9v",
 				"created":     "2017-01-01T00:00:00Z",
 				"modified":    "2017-01-01T00:00:00Z",
 				"imported":    "2017-01-01T00:00:00Z",
@@ -390,6 +392,8 @@ func TestDeckMergeImport(t *testing.T) {
 				ID:          "deck-YWJjZAo",
 				Name:        "bar",
 				Description: "BAR",
+				ConfigID:    "dconf-YmFy",
+				ParentID:    "deck-YmFy",
 				Created:     parseTime("2017-01-01T01:01:01Z"),
 				Modified:    parseTime("2017-02-01T01:01:01Z"),
 				Imported:    parseTime("2017-01-20T00:00:00Z"),
@@ -400,6 +404,8 @@ func TestDeckMergeImport(t *testing.T) {
 				ID:          "deck-YWJjZAo",
 				Name:        "bar",
 				Description: "BAR",
+				ConfigID:    "dconf-YmFy",
+				ParentID:    "deck-YmFy",
 				Created:     parseTime("2017-01-01T01:01:01Z"),
 				Modified:    parseTime("2017-02-01T01:01:01Z"),
 				Imported:    parseTime("2017-01-20T00:00:00Z"),
@@ -476,10 +482,34 @@ func TestDeckValidate(t *testing.T) {
 			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), Cards: &CardCollection{col: map[string]struct{}{"foo": {}}}},
 			err:  "'foo': invalid ID type",
 		},
+		{
+			name: "invalid config id",
+			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), ConfigID: "foo"},
+			err:  "invalid config ID: invalid DocID format",
+		},
+		{
+			name: "wrong config doc type",
+			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), ConfigID: "deck-Zm9v"},
+			err:  "invalid config ID: incorrect doc type",
+		},
+		{
+			name: "invalid parent id",
+			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), ParentID: "foo"},
+			err:  "invalid parent ID: invalid DocID format",
+		},
+		{
+			name: "wrong parent doc type",
+			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), ParentID: "fdeck-Zm9v"},
+			err:  "invalid parent ID: incorrect doc type",
+		},
 		{
 			name: "valid",
 			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), Cards: &CardCollection{col: map[string]struct{}{"card-abcd.abcd.0": {}}}},
 		},
+		{
+			name: "valid with config",
+			v:    &Deck{ID: "deck-YWJjZAo", Created: now(), Modified: now(), ConfigID: "dconf-Zm9v", Cards: NewCardCollection()},
+		},
 	}
 	testValidation(t, tests)
 }
@@ -0,0 +1,311 @@
+package fb
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NewCardOrder determines the order in which new cards are introduced.
+type NewCardOrder int
+
+// The valid new card orders.
+const (
+	// NewCardsInOrder introduces new cards in the order they were added.
+	NewCardsInOrder NewCardOrder = iota
+	// NewCardsRandom introduces new cards in random order.
+	NewCardsRandom
+)
+
+// LeechAction determines what happens to a card once it becomes a leech.
+type LeechAction int
+
+// The valid leech actions.
+const (
+	// LeechSuspend suspends leeches.
+	LeechSuspend LeechAction = iota
+	// LeechTagOnly marks leeches, but leaves them in the review queue.
+	LeechTagOnly
+)
+
+// NewCardConfig controls the introduction and learning of new cards.
+type NewCardConfig struct {
+	// PerDay is the maximum number of new cards introduced per day.
+	PerDay int `json:"perDay"`
+	// Steps are the learning steps. If nil, the scheduler's defaults are used.
+	Steps []Interval `json:"steps"`
+	// GraduatingInterval is the interval given to a card which graduates from
+	// the learning steps. If zero, the scheduler's default is used.
+	GraduatingInterval Interval `json:"graduatingInterval,omitempty"`
+	// EasyInterval is the interval given to a card which is answered as easy
+	// while learning. If zero, the scheduler's default is used.
+	EasyInterval Interval `json:"easyInterval,omitempty"`
+	// InitialEase is the ease factor given to new cards. If zero, the
+	// DefaultEaseFactor is used.
+	InitialEase float32      `json:"initialEase,omitempty"`
+	Order       NewCardOrder `json:"order"`
+	// Bury indicates that the siblings of a new card should be buried until
+	// the next day, once it has been studied.
+	Bury bool `json:"bury,omitempty"`
+}
+
+// ReviewConfig controls the scheduling of review cards.
+type ReviewConfig struct {
+	// PerDay is the maximum number of review cards studied per day.
+	PerDay int `json:"perDay"`
+	// MaxInterval is the longest interval which will be scheduled. If zero,
+	// the scheduler's default is used.
+	MaxInterval Interval `json:"maxInterval,omitempty"`
+	// Bury indicates that the siblings of a review card should be buried
+	// until the next day, once it has been studied.
+	Bury bool `json:"bury,omitempty"`
+}
+
+// LapseConfig controls the handling of forgotten review cards.
+type LapseConfig struct {
+	// Steps are the relearning steps. If nil, the scheduler's defaults are
+	// used.
+	Steps []Interval `json:"steps"`
+	// LeechThreshold is the number of lapses after which a card is considered
+	// a leech. Zero disables leech detection.
+	LeechThreshold int         `json:"leechThreshold"`
+	LeechAction    LeechAction `json:"leechAction"`
+}
+
+// DeckConfig represents a set of study options, which may be shared by any
+// number of decks.
+type DeckConfig struct {
+	ID          string    `json:"_id"`
+	Rev         string    `json:"_rev,omitempty"`
+	Created     time.Time `json:"created"`
+	Modified    time.Time `json:"modified"`
+	Imported    time.Time `json:"imported,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	// Algorithm is the name of the registered Scheduler used to schedule
+	// cards. If empty, SM-2 is used.
+	Algorithm string        `json:"algorithm,omitempty"`
+	New       NewCardConfig `json:"new"`
+	Reviews   ReviewConfig  `json:"rev"`
+	Lapses    LapseConfig   `json:"lapse"`
+}
+
+// Validate validates that all of the data in the deck config appears valid and
+// self consistent. A nil return value means no errors were detected.
+func (dc *DeckConfig) Validate() error {
+	return dc.ValidateAll().Err()
+}
+
+// ValidateAll validates the deck config as Validate does, but reports every
+// problem found, rather than only the first.
+func (dc *DeckConfig) ValidateAll() *ValidationReport {
+	v := newReporter()
+	dc.validate(v)
+	return v.report
+}
+
+func (dc *DeckConfig) validate(v *reporter) {
+	if dc.ID == "" {
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if err := validateDocID(dc.ID); err != nil {
+		v.error("_id", ProblemInvalidID, err)
+	} else if !strings.HasPrefix(dc.ID, "dconf-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
+	}
+	if dc.Created.IsZero() {
+		v.errorf("created", ProblemRequired, "created time required")
+	}
+	if dc.Modified.IsZero() {
+		v.errorf("modified", ProblemRequired, "modified time required")
+	}
+	if dc.New.PerDay < 0 {
+		v.errorf("new.perDay", ProblemInvalidValue, "new cards per day must not be negative")
+	}
+	if dc.Reviews.PerDay < 0 {
+		v.errorf("rev.perDay", ProblemInvalidValue, "reviews per day must not be negative")
+	}
+	if err := validateSteps(dc.New.Steps); err != nil {
+		v.error("new.steps", ProblemInvalidValue, errors.Wrap(err, "invalid learning steps"))
+	}
+	if err := validateSteps(dc.Lapses.Steps); err != nil {
+		v.error("lapse.steps", ProblemInvalidValue, errors.Wrap(err, "invalid relearning steps"))
+	}
+	if dc.New.GraduatingInterval < 0 {
+		v.errorf("new.graduatingInterval", ProblemInvalidValue, "intervals must not be negative")
+	}
+	if dc.New.EasyInterval < 0 {
+		v.errorf("new.easyInterval", ProblemInvalidValue, "intervals must not be negative")
+	}
+	if dc.Reviews.MaxInterval < 0 {
+		v.errorf("rev.maxInterval", ProblemInvalidValue, "intervals must not be negative")
+	}
+	if dc.New.InitialEase != 0 && dc.New.InitialEase < MinEaseFactor {
+		v.errorf("new.initialEase", ProblemInvalidValue, "initial ease must be at least %v", MinEaseFactor)
+	}
+	if dc.New.Order != NewCardsInOrder && dc.New.Order != NewCardsRandom {
+		v.errorf("new.order", ProblemInvalidValue, "invalid new card order %d", dc.New.Order)
+	}
+	if dc.Lapses.LeechThreshold < 0 {
+		v.errorf("lapse.leechThreshold", ProblemInvalidValue, "leech threshold must not be negative")
+	}
+	if dc.Lapses.LeechAction != LeechSuspend && dc.Lapses.LeechAction != LeechTagOnly {
+		v.errorf("lapse.leechAction", ProblemInvalidValue, "invalid leech action %d", dc.Lapses.LeechAction)
+	}
+}
+
+func validateSteps(steps []Interval) error {
+	for _, step := range steps {
+		if step <= 0 {
+			return errors.New("steps must be positive")
+		}
+	}
+	return nil
+}
+
+// NewDeckConfig returns a new DeckConfig with the provided id, and default
+// settings.
+func NewDeckConfig(id string) (*DeckConfig, error) {
+	dc := defaultDeckConfig()
+	dc.ID = id
+	dc.Created = now().UTC()
+	dc.Modified = now().UTC()
+	if err := dc.Validate(); err != nil {
+		return nil, err
+	}
+	return dc, nil
+}
+
+// defaultDeckConfig returns the default settings, as used by decks with no
+// config of their own.
+func defaultDeckConfig() *DeckConfig {
+	return &DeckConfig{
+		New: NewCardConfig{
+			PerDay: 20,
+			Steps:  DefaultLearningSteps,
+		},
+		Reviews: ReviewConfig{
+			PerDay: 200,
+		},
+		Lapses: LapseConfig{
+			Steps:          DefaultRelearningSteps,
+			LeechThreshold: 8,
+		},
+	}
+}
+
+// Scheduler returns the Scheduler used by decks with this configuration. The
+// built-in schedulers are configured according to dc; any other registered
+// scheduler is returned as is.
+func (dc *DeckConfig) Scheduler() (Scheduler, error) {
+	name := dc.Algorithm
+	if name == "" {
+		name = SchedulerSM2
+	}
+	s, err := GetScheduler(name)
+	if err != nil {
+		return nil, err
+	}
+	switch base := s.(type) {
+	case *SM2Scheduler:
+		sm2 := *base
+		sm2.LearningSteps = dc.New.Steps
+		sm2.RelearningSteps = dc.Lapses.Steps
+		sm2.GraduatingInterval = dc.New.GraduatingInterval
+		sm2.EasyInterval = dc.New.EasyInterval
+		sm2.InitialEase = dc.New.InitialEase
+		sm2.MaxInterval = dc.Reviews.MaxInterval
+		sm2.LeechThreshold = dc.Lapses.LeechThreshold
+		sm2.LeechAction = dc.Lapses.LeechAction
+		return &sm2, nil
+	case *FSRSScheduler:
+		fsrs := *base
+		fsrs.LearningSteps = dc.New.Steps
+		fsrs.RelearningSteps = dc.Lapses.Steps
+		fsrs.LeechThreshold = dc.Lapses.LeechThreshold
+		fsrs.LeechAction = dc.Lapses.LeechAction
+		if dc.Reviews.MaxInterval > 0 {
+			fsrs.MaxInterval = dc.Reviews.MaxInterval
+		}
+		return &fsrs, nil
+	}
+	return s, nil
+}
+
+type deckConfigAlias DeckConfig
+
+// MarshalJSON implements the json.Marshaler interface for the DeckConfig type.
+func (dc *DeckConfig) MarshalJSON() ([]byte, error) {
+	if err := dc.Validate(); err != nil {
+		return nil, err
+	}
+	doc := struct {
+		deckConfigAlias
+		Type     string     `json:"type"`
+		Imported *time.Time `json:"imported,omitempty"`
+	}{
+		Type:            "deckConfig",
+		deckConfigAlias: deckConfigAlias(*dc),
+	}
+	if !dc.Imported.IsZero() {
+		doc.Imported = &dc.Imported
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for the DeckConfig
+// type.
+func (dc *DeckConfig) UnmarshalJSON(data []byte) error {
+	doc := &deckConfigAlias{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return errors.Wrap(err, "failed to unmarshal DeckConfig")
+	}
+	*dc = DeckConfig(*doc)
+	return dc.Validate()
+}
+
+// SetRev sets the DeckConfig's _rev attribute.
+func (dc *DeckConfig) SetRev(rev string) { dc.Rev = rev }
+
+// DocID returns the DeckConfig's _id attribute.
+func (dc *DeckConfig) DocID() string { return dc.ID }
+
+// ImportedTime returns the time the DeckConfig was imported, or nil.
+func (dc *DeckConfig) ImportedTime() time.Time { return dc.Imported }
+
+// ModifiedTime returns the time the DeckConfig was last modified.
+func (dc *DeckConfig) ModifiedTime() time.Time { return dc.Modified }
+
+// MergeImport attempts to merge i into dc, returning true on success, or false
+// if no merge was necessary.
+func (dc *DeckConfig) MergeImport(i interface{}) (bool, error) {
+	existing, ok := i.(*DeckConfig)
+	if !ok {
+		return false, errors.Errorf("i is %T, not *fb.DeckConfig", i)
+	}
+	if dc.ID != existing.ID {
+		return false, errors.New("IDs don't match")
+	}
+	if dc.Imported.IsZero() || existing.Imported.IsZero() {
+		return false, errors.New("not an import")
+	}
+	if !dc.Created.Equal(existing.Created) {
+		return false, errors.New("Created timestamps don't match")
+	}
+	dc.Rev = existing.Rev
+	if dc.Modified.After(existing.Modified) {
+		// The new version is newer than the existing one, so update
+		return true, nil
+	}
+	// The new version is older, so we need to use the version we just read
+	dc.Modified = existing.Modified
+	dc.Imported = existing.Imported
+	dc.Name = existing.Name
+	dc.Description = existing.Description
+	dc.Algorithm = existing.Algorithm
+	dc.New = existing.New
+	dc.Reviews = existing.Reviews
+	dc.Lapses = existing.Lapses
+	return false, nil
+}
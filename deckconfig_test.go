@@ -0,0 +1,420 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestNewDeckConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		expected *DeckConfig
+		err      string
+	}{
+		{
+			name: "no id",
+			err:  "id required",
+		},
+		{
+			name: "wrong doc type",
+			id:   "deck-Zm9v",
+			err:  "incorrect doc type",
+		},
+		{
+			name: "valid",
+			id:   "dconf-Zm9v",
+			expected: &DeckConfig{
+				ID:       "dconf-Zm9v",
+				Created:  now(),
+				Modified: now(),
+				New: NewCardConfig{
+					PerDay: 20,
+					Steps:  []Interval{Minute, 10 * Minute},
+				},
+				Reviews: ReviewConfig{PerDay: 200},
+				Lapses: LapseConfig{
+					Steps:          []Interval{10 * Minute},
+					LeechThreshold: 8,
+				},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewDeckConfig(test.id)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestDeckConfigValidate(t *testing.T) {
+	valid := func(fn func(dc *DeckConfig)) *DeckConfig {
+		dc := &DeckConfig{ID: "dconf-Zm9v", Created: now(), Modified: now()}
+		fn(dc)
+		return dc
+	}
+	tests := []validationTest{
+		{
+			name: "no id",
+			v:    &DeckConfig{},
+			err:  "id required",
+		},
+		{
+			name: "invalid doctype",
+			v:    &DeckConfig{ID: "chicken-abcd"},
+			err:  "unsupported DocID type 'chicken'",
+		},
+		{
+			name: "incorrect doctype",
+			v:    &DeckConfig{ID: "deck-abcd"},
+			err:  "incorrect doc type",
+		},
+		{
+			name: "no created time",
+			v:    &DeckConfig{ID: "dconf-abcd"},
+			err:  "created time required",
+		},
+		{
+			name: "no modified time",
+			v:    &DeckConfig{ID: "dconf-abcd", Created: now()},
+			err:  "modified time required",
+		},
+		{
+			name: "negative new per day",
+			v:    valid(func(dc *DeckConfig) { dc.New.PerDay = -1 }),
+			err:  "new cards per day must not be negative",
+		},
+		{
+			name: "negative reviews per day",
+			v:    valid(func(dc *DeckConfig) { dc.Reviews.PerDay = -1 }),
+			err:  "reviews per day must not be negative",
+		},
+		{
+			name: "invalid learning step",
+			v:    valid(func(dc *DeckConfig) { dc.New.Steps = []Interval{Minute, 0} }),
+			err:  "invalid learning steps: steps must be positive",
+		},
+		{
+			name: "invalid relearning step",
+			v:    valid(func(dc *DeckConfig) { dc.Lapses.Steps = []Interval{-Minute} }),
+			err:  "invalid relearning steps: steps must be positive",
+		},
+		{
+			name: "negative max interval",
+			v:    valid(func(dc *DeckConfig) { dc.Reviews.MaxInterval = -Day }),
+			err:  "intervals must not be negative",
+		},
+		{
+			name: "initial ease too low",
+			v:    valid(func(dc *DeckConfig) { dc.New.InitialEase = 1.2 }),
+			err:  "initial ease must be at least 1.3",
+		},
+		{
+			name: "invalid order",
+			v:    valid(func(dc *DeckConfig) { dc.New.Order = 3 }),
+			err:  "invalid new card order 3",
+		},
+		{
+			name: "negative leech threshold",
+			v:    valid(func(dc *DeckConfig) { dc.Lapses.LeechThreshold = -1 }),
+			err:  "leech threshold must not be negative",
+		},
+		{
+			name: "invalid leech action",
+			v:    valid(func(dc *DeckConfig) { dc.Lapses.LeechAction = 2 }),
+			err:  "invalid leech action 2",
+		},
+		{
+			name: "valid",
+			v:    valid(func(_ *DeckConfig) {}),
+		},
+	}
+	testValidation(t, tests)
+}
+
+func TestDeckConfigMarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		dc       *DeckConfig
+		expected string
+		err      string
+	}{
+		{
+			name: "invalid",
+			dc:   &DeckConfig{},
+			err:  "id required",
+		},
+		{
+			name: "full fields",
+			dc: &DeckConfig{
+				ID:          "dconf-Zm9v",
+				Created:     now(),
+				Modified:    now(),
+				Imported:    now(),
+				Name:        "test name",
+				Description: "test description",
+				Algorithm:   "fsrs",
+				New: NewCardConfig{
+					PerDay:             10,
+					Steps:              []Interval{Minute, 10 * Minute},
+					GraduatingInterval: 2 * Day,
+					EasyInterval:       5 * Day,
+					InitialEase:        2.3,
+					Order:              NewCardsRandom,
+					Bury:               true,
+				},
+				Reviews: ReviewConfig{PerDay: 100, MaxInterval: 100 * Day, Bury: true},
+				Lapses: LapseConfig{
+					Steps:          []Interval{},
+					LeechThreshold: 5,
+					LeechAction:    LeechTagOnly,
+				},
+			},
+			expected: `{
+				"_id":         "dconf-Zm9v",
+				"type":        "deckConfig",
+				"created":     "2017-01-01T00:00:00Z",
+				"modified":    "2017-01-01T00:00:00Z",
+				"imported":    "2017-01-01T00:00:00Z",
+				"name":        "test name",
+				"description": "test description",
+				"algorithm":   "fsrs",
+				"new": {
+					"perDay":             10,
+					"steps":              [-60, -600],
+					"graduatingInterval": 2,
+					"easyInterval":       5,
+					"initialEase":        2.3,
+					"order":              1,
+					"bury":               true
+				},
+				"rev": {"perDay": 100, "maxInterval": 100, "bury": true},
+				"lapse": {"steps": [], "leechThreshold": 5, "leechAction": 1}
+			}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.dc.MarshalJSON()
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.JSON([]byte(test.expected), result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestDeckConfigUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected *DeckConfig
+		err      string
+	}{
+		{
+			name:  "invalid json",
+			input: "invalid json",
+			err:   "failed to unmarshal DeckConfig: invalid character 'i' looking for beginning of value",
+		},
+		{
+			name:  "invalid deck config",
+			input: `{}`,
+			err:   "id required",
+		},
+		{
+			name: "all fields",
+			input: `{
+				"_id":       "dconf-Zm9v",
+				"created":   "2017-01-01T00:00:00Z",
+				"modified":  "2017-01-01T00:00:00Z",
+				"name":      "test name",
+				"algorithm": "sm2",
+				"new":       {"perDay": 10, "steps": [-60]},
+				"rev":       {"perDay": 100},
+				"lapse":     {"steps": null, "leechThreshold": 5}
+			}`,
+			expected: &DeckConfig{
+				ID:        "dconf-Zm9v",
+				Created:   now(),
+				Modified:  now(),
+				Name:      "test name",
+				Algorithm: "sm2",
+				New:       NewCardConfig{PerDay: 10, Steps: []Interval{Minute}},
+				Reviews:   ReviewConfig{PerDay: 100},
+				Lapses:    LapseConfig{LeechThreshold: 5},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := &DeckConfig{}
+			err := result.UnmarshalJSON([]byte(test.input))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestDeckConfigScheduler(t *testing.T) {
+	tests := []struct {
+		name     string
+		dc       *DeckConfig
+		expected Scheduler
+		err      string
+	}{
+		{
+			name: "unknown algorithm",
+			dc:   &DeckConfig{Algorithm: "foo"},
+			err:  "unknown scheduler 'foo'",
+		},
+		{
+			name: "default",
+			dc: &DeckConfig{
+				New: NewCardConfig{
+					Steps:              []Interval{Minute},
+					GraduatingInterval: 2 * Day,
+					EasyInterval:       5 * Day,
+					InitialEase:        2.3,
+				},
+				Reviews: ReviewConfig{MaxInterval: 100 * Day},
+				Lapses:  LapseConfig{Steps: []Interval{}},
+			},
+			expected: &SM2Scheduler{
+				LearningSteps:      []Interval{Minute},
+				RelearningSteps:    []Interval{},
+				GraduatingInterval: 2 * Day,
+				EasyInterval:       5 * Day,
+				InitialEase:        2.3,
+				MaxInterval:        100 * Day,
+			},
+		},
+		{
+			name: "fsrs",
+			dc: &DeckConfig{
+				Algorithm: SchedulerFSRS,
+				New:       NewCardConfig{Steps: []Interval{Minute}},
+			},
+			expected: func() Scheduler {
+				s := NewFSRSScheduler()
+				s.LearningSteps = []Interval{Minute}
+				return s
+			}(),
+		},
+		{
+			name: "fsrs with max interval",
+			dc: &DeckConfig{
+				Algorithm: SchedulerFSRS,
+				Reviews:   ReviewConfig{MaxInterval: 100 * Day},
+			},
+			expected: func() Scheduler {
+				s := NewFSRSScheduler()
+				s.MaxInterval = 100 * Day
+				return s
+			}(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.dc.Scheduler()
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+	t.Run("registry unmodified", func(t *testing.T) {
+		s, _ := GetScheduler(SchedulerSM2)
+		if d := diff.Interface(&SM2Scheduler{}, s); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func TestDeckConfigMergeImport(t *testing.T) {
+	tests := []struct {
+		name           string
+		new            *DeckConfig
+		existing       interface{}
+		expected       bool
+		expectedConfig *DeckConfig
+		err            string
+	}{
+		{
+			name:     "wrong type",
+			new:      &DeckConfig{ID: "dconf-YWJjZAo"},
+			existing: &Deck{},
+			err:      "i is *fb.Deck, not *fb.DeckConfig",
+		},
+		{
+			name:     "different ids",
+			new:      &DeckConfig{ID: "dconf-YWJjZAo"},
+			existing: &DeckConfig{ID: "dconf-YWJjZQo"},
+			err:      "IDs don't match",
+		},
+		{
+			name:     "not an import",
+			new:      &DeckConfig{ID: "dconf-YWJjZAo", Created: parseTime("2017-01-01T01:01:01Z")},
+			existing: &DeckConfig{ID: "dconf-YWJjZAo", Created: parseTime("2017-01-01T01:01:01Z"), Imported: parseTime("2017-01-15T00:00:00Z")},
+			err:      "not an import",
+		},
+		{
+			name:     "created timestamps don't match",
+			new:      &DeckConfig{ID: "dconf-YWJjZAo", Created: parseTime("2017-01-01T01:01:01Z"), Imported: parseTime("2017-01-15T00:00:00Z")},
+			existing: &DeckConfig{ID: "dconf-YWJjZAo", Created: parseTime("2017-02-01T01:01:01Z"), Imported: parseTime("2017-01-20T00:00:00Z")},
+			err:      "Created timestamps don't match",
+		},
+		{
+			name: "new is newer",
+			new: &DeckConfig{ID: "dconf-YWJjZAo", Name: "foo", New: NewCardConfig{PerDay: 10},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-02-01T01:01:01Z"), Imported: parseTime("2017-01-15T00:00:00Z")},
+			existing: &DeckConfig{ID: "dconf-YWJjZAo", Rev: "1-xxx", Name: "bar", New: NewCardConfig{PerDay: 20},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"), Imported: parseTime("2017-01-20T00:00:00Z")},
+			expected: true,
+			expectedConfig: &DeckConfig{ID: "dconf-YWJjZAo", Rev: "1-xxx", Name: "foo", New: NewCardConfig{PerDay: 10},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-02-01T01:01:01Z"), Imported: parseTime("2017-01-15T00:00:00Z")},
+		},
+		{
+			name: "existing is newer",
+			new: &DeckConfig{ID: "dconf-YWJjZAo", Name: "foo", New: NewCardConfig{PerDay: 10},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-01-01T01:01:01Z"), Imported: parseTime("2017-01-15T00:00:00Z")},
+			existing: &DeckConfig{ID: "dconf-YWJjZAo", Rev: "1-xxx", Name: "bar", New: NewCardConfig{PerDay: 20},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-02-01T01:01:01Z"), Imported: parseTime("2017-01-20T00:00:00Z")},
+			expectedConfig: &DeckConfig{ID: "dconf-YWJjZAo", Rev: "1-xxx", Name: "bar", New: NewCardConfig{PerDay: 20},
+				Created: parseTime("2017-01-01T01:01:01Z"), Modified: parseTime("2017-02-01T01:01:01Z"), Imported: parseTime("2017-01-20T00:00:00Z")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.new.MergeImport(test.existing)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if test.expected != result {
+				t.Errorf("Unexpected result: %t", result)
+			}
+			if d := diff.Interface(test.expectedConfig, test.new); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
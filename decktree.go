@@ -0,0 +1,203 @@
+package fb
+
+import (
+	"sort"
+	"strings"
+)
+
+// DeckSeparator separates the names in a deck's path, as in Anki. The path
+// "Languages::Spanish" refers to the deck named "Spanish", a child of the
+// top-level deck named "Languages".
+const DeckSeparator = "::"
+
+// SetParent makes d a child of parent, or a top-level deck if parent is nil.
+func (d *Deck) SetParent(parent *Deck) {
+	d.Parent = parent
+	d.ParentID = ""
+	if parent != nil {
+		d.ParentID = parent.ID
+	}
+}
+
+// Path returns the names of the deck and its ancestors, from the top-level
+// deck down, joined by DeckSeparator. The deck must have been linked to its
+// ancestors, by NewDeckTree or SetParent, or only its own name is returned.
+func (d *Deck) Path() string {
+	names := []string{d.Name}
+	seen := map[*Deck]bool{d: true}
+	for p := d.Parent; p != nil && !seen[p]; p = p.Parent {
+		seen[p] = true
+		names = append(names, p.Name)
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return strings.Join(names, DeckSeparator)
+}
+
+// DeckCounts holds the numbers of cards in a deck.
+type DeckCounts struct {
+	// Total is the number of cards, in any state.
+	Total    int
+	New      int
+	Learning int
+	Review   int
+	// Due is the number of learning and review cards due for study now,
+	// which are neither suspended nor buried.
+	Due int
+}
+
+func (dc *DeckCounts) count(c *Card) {
+	dc.Total++
+	switch q := c.queue(); {
+	case q == QueueNew:
+		dc.New++
+	case q.learning():
+		dc.Learning++
+	default:
+		dc.Review++
+	}
+	if matchState(c, "due") {
+		dc.Due++
+	}
+}
+
+func (dc *DeckCounts) add(other DeckCounts) {
+	dc.Total += other.Total
+	dc.New += other.New
+	dc.Learning += other.Learning
+	dc.Review += other.Review
+	dc.Due += other.Due
+}
+
+// DeckNode is a deck within a DeckTree.
+type DeckNode struct {
+	Deck     *Deck
+	Parent   *DeckNode
+	Children []*DeckNode
+	// Own counts the cards in the deck itself, and Counts those in the deck
+	// and all of its descendants, as set by DeckTree.CountCards.
+	Own    DeckCounts
+	Counts DeckCounts
+}
+
+// DeckTree is the hierarchy of a set of decks.
+type DeckTree struct {
+	// Roots are the top-level decks. Roots and children are ordered by
+	// name.
+	Roots []*DeckNode
+	nodes map[string]*DeckNode
+}
+
+// NewDeckTree arranges decks into a tree, by their ParentIDs, and links each
+// deck to its parent. An error is returned if the parent of any deck is not
+// among decks, or if any deck is its own ancestor.
+func NewDeckTree(decks []*Deck) (*DeckTree, error) {
+	v := newReporter()
+	t := buildDeckTree(decks, v)
+	if err := v.report.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// copyDecks returns shallow copies of decks, so that a tree may be built
+// without linking the originals to their parents.
+func copyDecks(decks []*Deck) []*Deck {
+	copies := make([]*Deck, len(decks))
+	for i, d := range decks {
+		c := *d
+		copies[i] = &c
+	}
+	return copies
+}
+
+// buildDeckTree builds the tree of decks, reporting problems at the index of
+// the offending deck. Decks whose parents are missing, and those which are
+// their own ancestors, are placed at the top level.
+func buildDeckTree(decks []*Deck, v *reporter) *DeckTree {
+	t := &DeckTree{nodes: make(map[string]*DeckNode, len(decks))}
+	for _, d := range decks {
+		t.nodes[d.ID] = &DeckNode{Deck: d}
+	}
+	for i, d := range decks {
+		node := t.nodes[d.ID]
+		d.Parent = nil
+		if d.ParentID == "" {
+			t.Roots = append(t.Roots, node)
+			continue
+		}
+		parent, ok := t.nodes[d.ParentID]
+		switch {
+		case !ok:
+			v.atIndex("decks", i).errorf("parent", ProblemMissingReference, "parent deck '%s' of deck '%s' not found", d.ParentID, d.ID)
+		case t.isOwnAncestor(d):
+			v.atIndex("decks", i).errorf("parent", ProblemInconsistent, "deck '%s' is its own ancestor", d.ID)
+		default:
+			d.Parent = parent.Deck
+			node.Parent = parent
+			parent.Children = append(parent.Children, node)
+			continue
+		}
+		t.Roots = append(t.Roots, node)
+	}
+	sortDeckNodes(t.Roots)
+	for _, node := range t.nodes {
+		sortDeckNodes(node.Children)
+	}
+	return t
+}
+
+// isOwnAncestor returns true if following the parents of d leads back to d.
+func (t *DeckTree) isOwnAncestor(d *Deck) bool {
+	seen := map[string]bool{}
+	for id := d.ParentID; id != "" && !seen[id]; {
+		if id == d.ID {
+			return true
+		}
+		seen[id] = true
+		node, ok := t.nodes[id]
+		if !ok {
+			return false
+		}
+		id = node.Deck.ParentID
+	}
+	return false
+}
+
+func sortDeckNodes(nodes []*DeckNode) {
+	sort.Slice(nodes, func(i, j int) bool {
+		a, b := strings.ToLower(nodes[i].Deck.Name), strings.ToLower(nodes[j].Deck.Name)
+		if a == b {
+			return nodes[i].Deck.ID < nodes[j].Deck.ID
+		}
+		return a < b
+	})
+}
+
+// Node returns the node of the deck with the given ID, or nil if it is not in
+// the tree.
+func (t *DeckTree) Node(id string) *DeckNode {
+	return t.nodes[id]
+}
+
+// CountCards counts cards into the decks of the tree, replacing any previous
+// counts. Each card is counted in the deck it is currently in, which for a
+// card in a filtered deck is not its home deck, and then in each ancestor of
+// that deck. Cards in decks not in the tree are ignored.
+func (t *DeckTree) CountCards(cards []*Card) {
+	for _, node := range t.nodes {
+		node.Own = DeckCounts{}
+		node.Counts = DeckCounts{}
+	}
+	for _, c := range cards {
+		if node, ok := t.nodes[c.Deck]; ok {
+			node.Own.count(c)
+		}
+	}
+	for _, node := range t.nodes {
+		for n := node; n != nil; n = n.Parent {
+			n.Counts.add(node.Own)
+		}
+	}
+}
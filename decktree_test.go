@@ -0,0 +1,164 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func testDecks() []*Deck {
+	return []*Deck{
+		{ID: "deck-AQ", Name: "Verbs", ParentID: "deck-Ag"},
+		{ID: "deck-Ag", Name: "spanish", ParentID: "deck-Aw"},
+		{ID: "deck-Aw", Name: "Languages"},
+		{ID: "deck-BA", Name: "French", ParentID: "deck-Aw"},
+		{ID: "deck-BQ", Name: "Misc"},
+	}
+}
+
+// deckTreeNames lists the paths of the decks in the tree, depth first.
+func deckTreeNames(nodes []*DeckNode) []string {
+	var names []string
+	for _, n := range nodes {
+		names = append(names, n.Deck.Path())
+		names = append(names, deckTreeNames(n.Children)...)
+	}
+	return names
+}
+
+func TestNewDeckTree(t *testing.T) {
+	tests := []struct {
+		name     string
+		decks    func([]*Deck)
+		expected []string
+		err      string
+	}{
+		{
+			name:     "valid",
+			decks:    func(d []*Deck) {},
+			expected: []string{"Languages", "Languages::French", "Languages::spanish", "Languages::spanish::Verbs", "Misc"},
+		},
+		{
+			name:  "missing parent",
+			decks: func(d []*Deck) { d[3].ParentID = "deck-Zm9v" },
+			err:   "parent deck 'deck-Zm9v' of deck 'deck-BA' not found",
+		},
+		{
+			name:  "own parent",
+			decks: func(d []*Deck) { d[4].ParentID = "deck-BQ" },
+			err:   "deck 'deck-BQ' is its own ancestor",
+		},
+		{
+			name:  "cycle",
+			decks: func(d []*Deck) { d[2].ParentID = "deck-AQ" },
+			err:   "deck 'deck-AQ' is its own ancestor",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decks := testDecks()
+			test.decks(decks)
+			tree, err := NewDeckTree(decks)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, deckTreeNames(tree.Roots)); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestBuildDeckTreeCycle(t *testing.T) {
+	decks := testDecks()
+	decks[2].ParentID = "deck-AQ"
+	v := newReporter()
+	tree := buildDeckTree(decks, v)
+	expected := []string{
+		"error: decks[0].parent: deck 'deck-AQ' is its own ancestor (inconsistent)",
+		"error: decks[1].parent: deck 'deck-Ag' is its own ancestor (inconsistent)",
+		"error: decks[2].parent: deck 'deck-Aw' is its own ancestor (inconsistent)",
+	}
+	var problems []string
+	for _, p := range v.report.Problems {
+		problems = append(problems, p.String())
+	}
+	if d := diff.Interface(expected, problems); d != nil {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"Languages", "Languages::French", "Misc", "spanish", "Verbs"}, deckTreeNames(tree.Roots)); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestDeckPath(t *testing.T) {
+	parent := &Deck{ID: "deck-AQ", Name: "Languages"}
+	d := &Deck{ID: "deck-Ag", Name: "Spanish"}
+	if path := d.Path(); path != "Spanish" {
+		t.Errorf("Unexpected path: %s", path)
+	}
+	d.SetParent(parent)
+	if path := d.Path(); path != "Languages::Spanish" || d.ParentID != "deck-AQ" {
+		t.Errorf("Unexpected path: %s (%s)", path, d.ParentID)
+	}
+	parent.SetParent(d)
+	if path := d.Path(); path != "Languages::Spanish" {
+		t.Errorf("Unexpected path: %s", path)
+	}
+	d.SetParent(nil)
+	if path := d.Path(); path != "Spanish" || d.ParentID != "" {
+		t.Errorf("Unexpected path: %s (%s)", path, d.ParentID)
+	}
+}
+
+func TestDeckTreeCountCards(t *testing.T) {
+	tree, err := NewDeckTree(testDecks())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cards := []*Card{
+		{ID: "card-foo.bar.0", Deck: "deck-AQ"},
+		{ID: "card-foo.bar.1", Deck: "deck-AQ", Queue: QueueReview, Due: parseDue("2016-12-31")},
+		{ID: "card-foo.baz.0", Deck: "deck-Ag", Queue: QueueLearning, Due: parseDue("2017-01-02")},
+		{ID: "card-foo.qux.0", Deck: "deck-BA", Queue: QueueReview, Due: parseDue("2016-12-31"), Suspended: true},
+		{ID: "card-foo.quux.0", Deck: "deck-BQ", Queue: QueueRelearning, Due: parseDue("2017-01-01")},
+		{ID: "card-foo.corge.0", Deck: "fdeck-AQ", HomeDeck: "deck-AQ"},
+	}
+	tree.CountCards(cards)
+	expected := map[string][2]DeckCounts{
+		"deck-AQ": {
+			{Total: 2, New: 1, Review: 1, Due: 1},
+			{Total: 2, New: 1, Review: 1, Due: 1},
+		},
+		"deck-Ag": {
+			{Total: 1, Learning: 1},
+			{Total: 3, New: 1, Learning: 1, Review: 1, Due: 1},
+		},
+		"deck-Aw": {
+			{},
+			{Total: 4, New: 1, Learning: 1, Review: 2, Due: 1},
+		},
+		"deck-BA": {
+			{Total: 1, Review: 1},
+			{Total: 1, Review: 1},
+		},
+		"deck-BQ": {
+			{Total: 1, Learning: 1, Due: 1},
+			{Total: 1, Learning: 1, Due: 1},
+		},
+	}
+	for id, counts := range expected {
+		node := tree.Node(id)
+		if d := diff.Interface(counts, [2]DeckCounts{node.Own, node.Counts}); d != nil {
+			t.Errorf("%s: %s", id, d)
+		}
+	}
+	if tree.Node("fdeck-AQ") != nil {
+		t.Errorf("Unexpected node for filtered deck")
+	}
+	tree.CountCards(nil)
+	if d := diff.Interface(DeckCounts{}, tree.Node("deck-Aw").Counts); d != nil {
+		t.Error(d)
+	}
+}
@@ -202,7 +202,9 @@ func (i *Interval) UnmarshalJSON(src []byte) error {
 // round up to the next whole day.
 func (i Interval) Days() int {
 	if i >= Day {
-		return int(time.Duration(i+24*Hour-1).Hours() / 24)
+		// Integer arithmetic, as the floating point hours of long intervals
+		// lose the precision needed to round whole days correctly.
+		return int((i + Day - 1) / Day)
 	}
 	return 0
 }
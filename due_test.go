@@ -369,3 +369,26 @@ func TestIntervalUnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestIntervalDays(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    Interval
+		expected int
+	}{
+		{name: "zero", input: 0},
+		{name: "less than a day", input: 23 * Hour},
+		{name: "one day", input: Day, expected: 1},
+		{name: "partial day", input: Day + Hour, expected: 2},
+		{name: "just over a day", input: Day + Second, expected: 2},
+		{name: "many days", input: 36500 * Day, expected: 36500},
+		{name: "most days", input: 106000 * Day, expected: 106000},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.input.Days(); result != test.expected {
+				t.Errorf("Unexpected result: %d", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package fb
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var soundRefRE = regexp.MustCompile(`\[sound:[^\]]*\]`)
+
+// normalizeSortField strips HTML and sound references from s, and collapses
+// whitespace, leaving only the text which identifies the note.
+func normalizeSortField(s string) string {
+	s = stripHTML(soundRefRE.ReplaceAllString(s, " "))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// SortField returns the normalized text of the note's sort field, which is
+// designated by its model. HTML and sound references are removed, and
+// whitespace is collapsed. The note's model must be set.
+func (n *Note) SortField() (string, error) {
+	if n.Model == nil {
+		return "", errors.New("note has no model")
+	}
+	i := n.Model.SortField
+	if i < 0 || i >= len(n.FieldValues) {
+		return "", errors.Errorf("sort field %d out of range", i)
+	}
+	if fv := n.FieldValues[i]; fv != nil {
+		return normalizeSortField(fv.Text), nil
+	}
+	return "", nil
+}
+
+// Checksum returns a checksum of the note's sort field, computed as by Anki
+// from the first 32 bits of the SHA-1 hash of the normalized text. Notes with
+// equal sort fields have equal checksums.
+func (n *Note) Checksum() (uint32, error) {
+	text, err := n.SortField()
+	if err != nil {
+		return 0, err
+	}
+	return sortFieldChecksum(text), nil
+}
+
+func sortFieldChecksum(text string) uint32 {
+	sum := sha1.Sum([]byte(text))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// DuplicateGroup is a group of notes with identical sort fields.
+type DuplicateGroup struct {
+	SortField string
+	Checksum  uint32
+	Notes     []*Note
+}
+
+// duplicateKey identifies the notes which may duplicate each other: those
+// of the same model, whose sort fields have the same checksum.
+type duplicateKey struct {
+	model    ModelRef
+	checksum uint32
+}
+
+func noteDuplicateKey(n *Note, text string) duplicateKey {
+	return duplicateKey{
+		model:    ModelRef{Theme: ThemeID(n.ThemeID), Model: n.ModelID},
+		checksum: sortFieldChecksum(text),
+	}
+}
+
+// duplicateText returns the sort field by which n is compared with other
+// notes, or false if it has none. Notes whose models have no fields, and
+// those with empty sort fields, are never considered duplicates.
+func duplicateText(n *Note) (string, bool, error) {
+	if n.Model == nil {
+		return "", false, errors.New("note has no model")
+	}
+	if i := n.Model.SortField; i < 0 || i >= len(n.FieldValues) {
+		return "", false, nil
+	}
+	text, err := n.SortField()
+	if err != nil {
+		return "", false, err
+	}
+	return text, text != "", nil
+}
+
+// noteIndex indexes notes by their models and the checksums of their sort
+// fields. Notes without sort fields are not indexed.
+type noteIndex struct {
+	notes map[duplicateKey][]*Note
+	text  map[*Note]string
+}
+
+func newNoteIndex(notes []*Note) (*noteIndex, error) {
+	idx := &noteIndex{
+		notes: make(map[duplicateKey][]*Note, len(notes)),
+		text:  make(map[*Note]string, len(notes)),
+	}
+	for _, n := range notes {
+		text, ok, err := duplicateText(n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "note '%s'", n.ID)
+		}
+		if !ok {
+			continue
+		}
+		key := noteDuplicateKey(n, text)
+		idx.notes[key] = append(idx.notes[key], n)
+		idx.text[n] = text
+	}
+	return idx, nil
+}
+
+// matches returns the indexed notes of the same model as n, with the given
+// sort field, other than those with the same ID as n.
+func (idx *noteIndex) matches(n *Note, text string) []*Note {
+	var result []*Note
+	for _, m := range idx.notes[noteDuplicateKey(n, text)] {
+		if m.ID != n.ID && idx.text[m] == text {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// FindDuplicates returns the groups of notes which have identical sort
+// fields, in the order of their first note. As in Anki, notes are only
+// compared with others of the same model. Every note must have its model
+// set.
+func FindDuplicates(notes []*Note) ([]*DuplicateGroup, error) {
+	idx, err := newNoteIndex(notes)
+	if err != nil {
+		return nil, err
+	}
+	var groups []*DuplicateGroup
+	grouped := make(map[*Note]bool)
+	for _, n := range notes {
+		text, ok := idx.text[n]
+		if !ok || grouped[n] {
+			continue
+		}
+		matches := idx.matches(n, text)
+		if len(matches) == 0 {
+			continue
+		}
+		group := &DuplicateGroup{
+			SortField: text,
+			Checksum:  sortFieldChecksum(text),
+			Notes:     []*Note{n},
+		}
+		for _, m := range matches {
+			if !grouped[m] && m != n {
+				group.Notes = append(group.Notes, m)
+				grouped[m] = true
+			}
+		}
+		grouped[n] = true
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// FindDuplicates returns the groups of notes within the package which have
+// identical sort fields. See FindDuplicates.
+func (p *Package) FindDuplicates() ([]*DuplicateGroup, error) {
+	return FindDuplicates(p.Notes)
+}
+
+// NoteDuplicates pairs a note with the existing notes which duplicate it.
+type NoteDuplicates struct {
+	Note     *Note
+	Existing []*Note
+}
+
+// DuplicatesOf returns, for each note of the package which duplicates any of
+// the existing notes of the same model, the matching existing notes. A note
+// is not considered a duplicate of an existing note with the same ID, as that
+// is the same note, imported again. Every note must have its model set.
+func (p *Package) DuplicatesOf(existing []*Note) ([]*NoteDuplicates, error) {
+	idx, err := newNoteIndex(existing)
+	if err != nil {
+		return nil, errors.Wrap(err, "existing")
+	}
+	var result []*NoteDuplicates
+	for _, n := range p.Notes {
+		text, ok, err := duplicateText(n)
+		if err != nil {
+			return nil, errors.Wrapf(err, "note '%s'", n.ID)
+		}
+		if !ok {
+			continue
+		}
+		if matches := idx.matches(n, text); len(matches) > 0 {
+			result = append(result, &NoteDuplicates{Note: n, Existing: matches})
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,181 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestNormalizeSortField(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{name: "empty", input: "", expected: ""},
+		{name: "plain", input: "hola", expected: "hola"},
+		{name: "html", input: "<b>hola</b>&nbsp;<br/>mundo", expected: "hola mundo"},
+		{name: "sound", input: "uno[sound:one.mp3]", expected: "uno"},
+		{name: "image only", input: `<img src="one.jpg">`, expected: ""},
+		{name: "whitespace", input: "  el\n\tgato  ", expected: "el gato"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := normalizeSortField(test.input); result != test.expected {
+				t.Errorf("Unexpected result: %q", result)
+			}
+		})
+	}
+}
+
+func testDuplicateModel(sortField int) *Model {
+	theme, _ := NewTheme("theme-Zm9v")
+	model, _ := theme.NewModel("foo")
+	_ = model.AddField(TextField, "Front")
+	_ = model.AddField(TextField, "Back")
+	model.SortField = sortField
+	return model
+}
+
+func testDuplicateNote(id string, model *Model, front, back string) *Note {
+	n, _ := NewNote(id, model)
+	n.FieldValues = []*FieldValue{{Text: front}, {Text: back}}
+	return n
+}
+
+func TestNoteSortField(t *testing.T) {
+	tests := []struct {
+		name     string
+		note     *Note
+		expected string
+		checksum uint32
+		err      string
+	}{
+		{
+			name: "no model",
+			note: &Note{ID: "note-Zm9v"},
+			err:  "note has no model",
+		},
+		{
+			name: "missing field values",
+			note: &Note{ID: "note-Zm9v", Model: testDuplicateModel(1)},
+			err:  "sort field 1 out of range",
+		},
+		{
+			name:     "nil field value",
+			note:     &Note{ID: "note-Zm9v", Model: testDuplicateModel(0), FieldValues: []*FieldValue{nil}},
+			checksum: 0xda39a3ee,
+		},
+		{
+			name:     "first field",
+			note:     testDuplicateNote("note-Zm9v", testDuplicateModel(0), "<i>hello</i>", "bye"),
+			expected: "hello",
+			checksum: 0xaaf4c61d,
+		},
+		{
+			name:     "second field",
+			note:     testDuplicateNote("note-Zm9v", testDuplicateModel(1), "bye", "hello "),
+			expected: "hello",
+			checksum: 0xaaf4c61d,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.note.SortField()
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result != test.expected {
+				t.Errorf("Unexpected result: %q", result)
+			}
+			checksum, err := test.note.Checksum()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if checksum != test.checksum {
+				t.Errorf("Unexpected checksum: %x", checksum)
+			}
+		})
+	}
+}
+
+func noteIDs(notes []*Note) []string {
+	ids := make([]string, len(notes))
+	for i, n := range notes {
+		ids[i] = n.ID
+	}
+	return ids
+}
+
+func TestFindDuplicates(t *testing.T) {
+	m1 := testDuplicateModel(0)
+	m2, _ := m1.Theme.NewModel("foo")
+	_ = m2.AddField(TextField, "Front")
+	_ = m2.AddField(TextField, "Back")
+	m2.SortField = 1
+	empty, _ := m1.Theme.NewModel("foo")
+	p := &Package{Notes: []*Note{
+		testDuplicateNote("note-MQ", m1, "gato", "cat"),
+		testDuplicateNote("note-Mg", m1, "perro", "dog"),
+		testDuplicateNote("note-Mw", m2, "cat", "<b>gato</b>"),
+		testDuplicateNote("note-NA", m1, "", "empty"),
+		testDuplicateNote("note-NQ", m1, "", "empty"),
+		testDuplicateNote("note-Ng", m1, "gato ", "cat"),
+		testDuplicateNote("note-Nw", m2, "kitten", "gato"),
+		{ID: "note-OA", Model: empty, ThemeID: m1.Theme.ID, ModelID: empty.ID},
+		{ID: "note-OQ", Model: empty, ThemeID: m1.Theme.ID, ModelID: empty.ID},
+	}}
+	groups, err := p.FindDuplicates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(groups) != 2 {
+		t.Fatalf("Expected 2 groups, got %d", len(groups))
+	}
+	for i, expected := range [][]string{{"note-MQ", "note-Ng"}, {"note-Mw", "note-Nw"}} {
+		if groups[i].SortField != "gato" || groups[i].Checksum != sortFieldChecksum("gato") {
+			t.Errorf("Unexpected group %d: %q %x", i, groups[i].SortField, groups[i].Checksum)
+		}
+		if d := diff.Interface(expected, noteIDs(groups[i].Notes)); d != nil {
+			t.Error(d)
+		}
+	}
+
+	p.Notes = append(p.Notes, &Note{ID: "note-Pw"})
+	_, err = p.FindDuplicates()
+	checkErr(t, "note 'note-Pw': note has no model", err)
+}
+
+func TestDuplicatesOf(t *testing.T) {
+	m := testDuplicateModel(0)
+	existing := []*Note{
+		testDuplicateNote("note-MQ", m, "gato", "cat"),
+		testDuplicateNote("note-Mg", m, "perro", "dog"),
+		testDuplicateNote("note-Mw", m, "gato", "cat (animal)"),
+	}
+	other, _ := m.Theme.NewModel("foo")
+	_ = other.AddField(TextField, "Front")
+	p := &Package{Notes: []*Note{
+		testDuplicateNote("note-NA", m, "<div>gato</div>", "kitty"),
+		testDuplicateNote("note-Mg", m, "perro", "dog"),
+		testDuplicateNote("note-NQ", m, "pez", "fish"),
+		testDuplicateNote("note-Ng", other, "gato", "cat"),
+	}}
+	result, err := p.DuplicatesOf(existing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != 1 {
+		t.Fatalf("Expected 1 duplicate, got %d", len(result))
+	}
+	if result[0].Note.ID != "note-NA" {
+		t.Errorf("Unexpected note: %s", result[0].Note.ID)
+	}
+	if d := diff.Interface([]string{"note-MQ", "note-Mw"}, noteIDs(result[0].Existing)); d != nil {
+		t.Error(d)
+	}
+
+	_, err = p.DuplicatesOf([]*Note{{ID: "note-Zm9v"}})
+	checkErr(t, "existing: note 'note-Zm9v': note has no model", err)
+}
@@ -0,0 +1,340 @@
+package fb
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// FilterOrder determines the order of the cards gathered into a filtered
+// deck, and so which cards are kept when the deck's limit is reached.
+type FilterOrder int
+
+// The valid filter orders.
+const (
+	// FilterOrderDue orders cards by due date, earliest first.
+	FilterOrderDue FilterOrder = iota
+	// FilterOrderRandom orders cards randomly.
+	FilterOrderRandom
+	// FilterOrderIntervalAsc orders cards by interval, shortest first.
+	FilterOrderIntervalAsc
+	// FilterOrderIntervalDesc orders cards by interval, longest first.
+	FilterOrderIntervalDesc
+	// FilterOrderLapses orders cards by lapse count, most first.
+	FilterOrderLapses
+	// FilterOrderAdded orders cards by creation time, oldest first.
+	FilterOrderAdded
+	// FilterOrderAddedDesc orders cards by creation time, newest first.
+	FilterOrderAddedDesc
+)
+
+func (o FilterOrder) valid() bool {
+	return o >= FilterOrderDue && o <= FilterOrderAddedDesc
+}
+
+// FilteredDeck represents a deck whose cards are gathered by a search query,
+// such as for cramming before an exam. Cards are moved into the deck when it
+// is rebuilt, and return to their home decks when it is emptied.
+type FilteredDeck struct {
+	ID          string    `json:"_id"`
+	Rev         string    `json:"_rev,omitempty"`
+	Created     time.Time `json:"created"`
+	Modified    time.Time `json:"modified"`
+	Imported    time.Time `json:"imported,omitempty"`
+	Name        string    `json:"name,omitempty"`
+	Description string    `json:"description,omitempty"`
+	// Query selects the cards of the deck. See SearchQuery for the syntax.
+	Query string      `json:"query"`
+	Order FilterOrder `json:"order"`
+	// Limit is the maximum number of cards gathered. Zero means no limit.
+	Limit int `json:"limit"`
+	// Reschedule indicates that cards answered in the deck are scheduled as
+	// usual. Otherwise, answers leave the cards' scheduling state unchanged.
+	Reschedule bool `json:"reschedule,omitempty"`
+	// Cards are the IDs of the cards in the deck, in study order.
+	Cards []string `json:"cards"`
+}
+
+// Validate validates that all of the data in the filtered deck appears valid
+// and self consistent. A nil return value means no errors were detected.
+func (fd *FilteredDeck) Validate() error {
+	return fd.ValidateAll().Err()
+}
+
+// ValidateAll validates the filtered deck as Validate does, but reports every
+// problem found, rather than only the first.
+func (fd *FilteredDeck) ValidateAll() *ValidationReport {
+	v := newReporter()
+	fd.validate(v)
+	return v.report
+}
+
+func (fd *FilteredDeck) validate(v *reporter) {
+	if fd.ID == "" {
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if err := validateDocID(fd.ID); err != nil {
+		v.error("_id", ProblemInvalidID, err)
+	} else if !strings.HasPrefix(fd.ID, "fdeck-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
+	}
+	if fd.Created.IsZero() {
+		v.errorf("created", ProblemRequired, "created time required")
+	}
+	if fd.Modified.IsZero() {
+		v.errorf("modified", ProblemRequired, "modified time required")
+	}
+	if _, err := ParseSearch(fd.Query); err != nil {
+		v.error("query", ProblemInvalidValue, errors.Wrap(err, "invalid query"))
+	}
+	if !fd.Order.valid() {
+		v.errorf("order", ProblemInvalidValue, "invalid filter order %d", fd.Order)
+	}
+	if fd.Limit < 0 {
+		v.errorf("limit", ProblemInvalidValue, "limit must not be negative")
+	}
+	seen := make(map[string]struct{}, len(fd.Cards))
+	for i, id := range fd.Cards {
+		if _, err := ParseCardID(id); err != nil {
+			v.atIndex("cards", i).error("", ProblemInvalidID, errors.Wrapf(err, "'%s'", id))
+			continue
+		}
+		if _, ok := seen[id]; ok {
+			v.atIndex("cards", i).errorf("", ProblemDuplicate, "card '%s' listed more than once", id)
+		}
+		seen[id] = struct{}{}
+	}
+}
+
+// NewFilteredDeck returns a new, empty FilteredDeck with the provided id and
+// query. Cards are gathered in due order, up to a limit of 100, and are
+// rescheduled when answered.
+func NewFilteredDeck(id, query string) (*FilteredDeck, error) {
+	fd := &FilteredDeck{
+		ID:         id,
+		Created:    now().UTC(),
+		Modified:   now().UTC(),
+		Query:      query,
+		Limit:      100,
+		Reschedule: true,
+		Cards:      []string{},
+	}
+	if err := fd.Validate(); err != nil {
+		return nil, err
+	}
+	return fd, nil
+}
+
+type filteredDeckAlias FilteredDeck
+
+// MarshalJSON implements the json.Marshaler interface for the FilteredDeck
+// type.
+func (fd *FilteredDeck) MarshalJSON() ([]byte, error) {
+	if err := fd.Validate(); err != nil {
+		return nil, err
+	}
+	doc := struct {
+		filteredDeckAlias
+		Type     string     `json:"type"`
+		Imported *time.Time `json:"imported,omitempty"`
+		Cards    []string   `json:"cards"`
+	}{
+		Type:              "filteredDeck",
+		filteredDeckAlias: filteredDeckAlias(*fd),
+		Cards:             fd.Cards,
+	}
+	if !fd.Imported.IsZero() {
+		doc.Imported = &fd.Imported
+	}
+	if doc.Cards == nil {
+		doc.Cards = []string{}
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for the
+// FilteredDeck type.
+func (fd *FilteredDeck) UnmarshalJSON(data []byte) error {
+	doc := &filteredDeckAlias{}
+	if err := json.Unmarshal(data, doc); err != nil {
+		return errors.Wrap(err, "failed to unmarshal FilteredDeck")
+	}
+	*fd = FilteredDeck(*doc)
+	return fd.Validate()
+}
+
+// SetRev sets the FilteredDeck's _rev attribute.
+func (fd *FilteredDeck) SetRev(rev string) { fd.Rev = rev }
+
+// DocID returns the FilteredDeck's _id attribute.
+func (fd *FilteredDeck) DocID() string { return fd.ID }
+
+// ImportedTime returns the time the FilteredDeck was imported, or nil.
+func (fd *FilteredDeck) ImportedTime() time.Time { return fd.Imported }
+
+// ModifiedTime returns the time the FilteredDeck was last modified.
+func (fd *FilteredDeck) ModifiedTime() time.Time { return fd.Modified }
+
+// MergeImport attempts to merge i into fd, returning true on success, or
+// false if no merge was necessary.
+func (fd *FilteredDeck) MergeImport(i interface{}) (bool, error) {
+	existing, ok := i.(*FilteredDeck)
+	if !ok {
+		return false, errors.Errorf("i is %T, not *fb.FilteredDeck", i)
+	}
+	if fd.ID != existing.ID {
+		return false, errors.New("IDs don't match")
+	}
+	if fd.Imported.IsZero() || existing.Imported.IsZero() {
+		return false, errors.New("not an import")
+	}
+	if !fd.Created.Equal(existing.Created) {
+		return false, errors.New("Created timestamps don't match")
+	}
+	fd.Rev = existing.Rev
+	// The cards gathered are local to the existing deck, whichever is newer
+	fd.Cards = existing.Cards
+	if fd.Modified.After(existing.Modified) {
+		// The new version is newer than the existing one, so update
+		return true, nil
+	}
+	// The new version is older, so we need to use the version we just read
+	fd.Modified = existing.Modified
+	fd.Imported = existing.Imported
+	fd.Name = existing.Name
+	fd.Description = existing.Description
+	fd.Query = existing.Query
+	fd.Order = existing.Order
+	fd.Limit = existing.Limit
+	fd.Reschedule = existing.Reschedule
+	return false, nil
+}
+
+// isFilteredDeckID returns true if id is the ID of a filtered deck.
+func isFilteredDeckID(id string) bool {
+	return strings.HasPrefix(id, "fdeck-")
+}
+
+// Rebuild empties the deck, then gathers the cards matching its query, in
+// its order and up to its limit. Suspended and buried cards, and those in
+// another filtered deck, are skipped. Each card gathered is moved into the
+// deck, and its previous deck is kept as its HomeDeck. cards should include
+// every card which may match, as well as those currently in the deck; lookup
+// returns the note and home deck of each card, for matching the query. The
+// cards which were modified are returned.
+func (fd *FilteredDeck) Rebuild(cards []*Card, lookup func(*Card) (*Note, *Deck)) ([]*Card, error) {
+	q, err := ParseSearch(fd.Query)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid query")
+	}
+	modified := fd.Empty(cards)
+	candidates := make([]*Card, 0, len(cards))
+	for _, c := range cards {
+		if c.Suspended || c.IsBuried() || c.HomeDeck != "" || isFilteredDeckID(c.Deck) {
+			continue
+		}
+		candidates = append(candidates, c)
+	}
+	matched := q.MatchCards(candidates, lookup)
+	fd.sortCards(matched)
+	if fd.Limit > 0 {
+		matched = limitCards(matched, fd.Limit)
+	}
+	released := make(map[*Card]bool, len(modified))
+	for _, c := range modified {
+		released[c] = true
+	}
+	fd.Cards = make([]string, len(matched))
+	for i, c := range matched {
+		c.HomeDeck = c.Deck
+		c.Deck = fd.ID
+		c.Modified = now().UTC()
+		fd.Cards[i] = c.ID
+		if !released[c] {
+			modified = append(modified, c)
+		}
+	}
+	fd.Modified = now().UTC()
+	return modified, nil
+}
+
+// Empty returns those of cards which are in the deck to their home decks,
+// and removes all cards from the deck. Cards without a home deck, which have
+// nowhere to return to, are left unchanged. The cards which were modified are
+// returned.
+func (fd *FilteredDeck) Empty(cards []*Card) []*Card {
+	var modified []*Card
+	for _, c := range cards {
+		if c.Deck != fd.ID || c.HomeDeck == "" {
+			continue
+		}
+		c.Deck = c.HomeDeck
+		c.HomeDeck = ""
+		c.Modified = now().UTC()
+		modified = append(modified, c)
+	}
+	fd.Cards = []string{}
+	fd.Modified = now().UTC()
+	return modified
+}
+
+// sortCards sorts cards by the deck's order, breaking ties by ID.
+func (fd *FilteredDeck) sortCards(cards []*Card) {
+	sort.Slice(cards, func(i, j int) bool {
+		return cards[i].ID < cards[j].ID
+	})
+	var less func(a, b *Card) bool
+	switch fd.Order {
+	case FilterOrderRandom:
+		shuffleCards(cards)
+		return
+	case FilterOrderIntervalAsc:
+		less = func(a, b *Card) bool { return a.Interval < b.Interval }
+	case FilterOrderIntervalDesc:
+		less = func(a, b *Card) bool { return a.Interval > b.Interval }
+	case FilterOrderLapses:
+		less = func(a, b *Card) bool { return a.LapseCount > b.LapseCount }
+	case FilterOrderAdded:
+		less = func(a, b *Card) bool { return a.Created.Before(b.Created) }
+	case FilterOrderAddedDesc:
+		less = func(a, b *Card) bool { return a.Created.After(b.Created) }
+	default:
+		less = func(a, b *Card) bool { return b.Due.After(a.Due) }
+	}
+	sort.SliceStable(cards, func(i, j int) bool {
+		return less(cards[i], cards[j])
+	})
+}
+
+// Scheduler returns the scheduler with which to answer cards in the deck,
+// given s, the scheduler of their home deck. If the deck does not reschedule
+// cards, answers are recorded, but leave the cards unchanged.
+func (fd *FilteredDeck) Scheduler(s Scheduler) Scheduler {
+	if fd.Reschedule {
+		return s
+	}
+	return previewScheduler{s}
+}
+
+// previewScheduler records reviews without rescheduling cards. The reviews
+// are of type ReviewTypeCram, and record the card's unchanged state.
+type previewScheduler struct {
+	Scheduler
+}
+
+func (s previewScheduler) Schedule(c *Card, ease ReviewEase, reviewed time.Time) (*Review, error) {
+	saved := *c
+	r, err := s.Scheduler.Schedule(c, ease, reviewed)
+	*c = saved
+	if err != nil {
+		return nil, err
+	}
+	r.Type = ReviewTypeCram
+	r.Interval = c.Interval
+	r.SRSFactor = c.EaseFactor
+	r.Leech = false
+	r.Suspended = false
+	return r, nil
+}
@@ -0,0 +1,299 @@
+package fb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestNewFilteredDeck(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		query    string
+		expected *FilteredDeck
+		err      string
+	}{
+		{
+			name: "no id",
+			err:  "id required",
+		},
+		{
+			name: "wrong doc type",
+			id:   "deck-Zm9v",
+			err:  "incorrect doc type",
+		},
+		{
+			name:  "invalid query",
+			id:    "fdeck-Zm9v",
+			query: "(is:due",
+			err:   "invalid query: missing ')'",
+		},
+		{
+			name:  "valid",
+			id:    "fdeck-Zm9v",
+			query: "deck:spanish is:due",
+			expected: &FilteredDeck{
+				ID:         "fdeck-Zm9v",
+				Created:    now(),
+				Modified:   now(),
+				Query:      "deck:spanish is:due",
+				Limit:      100,
+				Reschedule: true,
+				Cards:      []string{},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewFilteredDeck(test.id, test.query)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestFilteredDeckValidate(t *testing.T) {
+	valid := func(fn func(fd *FilteredDeck)) *FilteredDeck {
+		fd := &FilteredDeck{ID: "fdeck-Zm9v", Created: now(), Modified: now()}
+		fn(fd)
+		return fd
+	}
+	testValidation(t, []validationTest{
+		{
+			name: "no created time",
+			v:    valid(func(fd *FilteredDeck) { fd.Created = parseTime("0001-01-01T00:00:00Z") }),
+			err:  "created time required",
+		},
+		{
+			name: "no modified time",
+			v:    valid(func(fd *FilteredDeck) { fd.Modified = parseTime("0001-01-01T00:00:00Z") }),
+			err:  "modified time required",
+		},
+		{
+			name: "invalid order",
+			v:    valid(func(fd *FilteredDeck) { fd.Order = 12 }),
+			err:  "invalid filter order 12",
+		},
+		{
+			name: "negative limit",
+			v:    valid(func(fd *FilteredDeck) { fd.Limit = -1 }),
+			err:  "limit must not be negative",
+		},
+		{
+			name: "invalid card",
+			v:    valid(func(fd *FilteredDeck) { fd.Cards = []string{"foo"} }),
+			err:  "'foo': invalid ID type",
+		},
+		{
+			name: "duplicate card",
+			v:    valid(func(fd *FilteredDeck) { fd.Cards = []string{"card-foo.bar.0", "card-foo.bar.0"} }),
+			err:  "card 'card-foo.bar.0' listed more than once",
+		},
+		{
+			name: "valid",
+			v:    valid(func(fd *FilteredDeck) { fd.Cards = []string{"card-foo.bar.0"} }),
+		},
+	})
+}
+
+func TestFilteredDeckJSON(t *testing.T) {
+	fd := &FilteredDeck{
+		ID:       "fdeck-Zm9v",
+		Created:  now(),
+		Modified: now(),
+		Query:    "tag:verbs",
+		Order:    FilterOrderRandom,
+		Limit:    50,
+	}
+	expected := `{"_id":"fdeck-Zm9v","created":"2017-01-01T00:00:00Z","modified":"2017-01-01T00:00:00Z",
+		"query":"tag:verbs","order":1,"limit":50,"cards":[],"type":"filteredDeck"}`
+	data, err := json.Marshal(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.JSON([]byte(expected), data); d != nil {
+		t.Error(d)
+	}
+	result := &FilteredDeck{}
+	if err := json.Unmarshal([]byte(expected), result); err != nil {
+		t.Fatal(err)
+	}
+	fd.Cards = []string{}
+	if d := diff.Interface(fd, result); d != nil {
+		t.Error(d)
+	}
+	checkErr(t, "invalid query: unterminated quote",
+		json.Unmarshal([]byte(`{"_id":"fdeck-Zm9v","created":"2017-01-01T00:00:00Z","modified":"2017-01-01T00:00:00Z","query":"\""}`), result))
+}
+
+func filteredFixtures() ([]*Card, func(*Card) (*Note, *Deck)) {
+	spanish := &Deck{ID: "deck-AQ", Name: "Spanish"}
+	french := &Deck{ID: "deck-Ag", Name: "French"}
+	decks := map[string]*Deck{spanish.ID: spanish, french.ID: french}
+	cards := []*Card{
+		{ID: "card-foo.bar.0", Deck: "deck-AQ", Queue: QueueReview, Interval: 10 * Day, Due: parseDue("2017-01-05"), LapseCount: 1},
+		{ID: "card-foo.bar.1", Deck: "deck-AQ", Queue: QueueReview, Interval: 3 * Day, Due: parseDue("2016-12-30"), LapseCount: 3},
+		{ID: "card-foo.baz.0", Deck: "deck-AQ", Queue: QueueReview, Interval: 30 * Day, Due: parseDue("2017-01-02")},
+		{ID: "card-foo.qux.0", Deck: "deck-AQ", Queue: QueueReview, Suspended: true},
+		{ID: "card-foo.quux.0", Deck: "deck-AQ", Queue: QueueReview, BuriedUntil: parseDue("2017-01-02")},
+		{ID: "card-foo.corge.0", Deck: "fdeck-Ag", HomeDeck: "deck-AQ", Queue: QueueReview},
+		{ID: "card-foo.grault.0", Deck: "deck-Ag", Queue: QueueReview},
+	}
+	return cards, func(c *Card) (*Note, *Deck) {
+		return &Note{}, decks[c.Deck]
+	}
+}
+
+func filteredCardIDs(cards []*Card) []string {
+	ids := make([]string, len(cards))
+	for i, c := range cards {
+		ids[i] = c.ID
+	}
+	return ids
+}
+
+func TestFilteredDeckRebuild(t *testing.T) {
+	tests := []struct {
+		name     string
+		order    FilterOrder
+		limit    int
+		expected []string
+	}{
+		{
+			name:     "due",
+			expected: []string{"card-foo.bar.1", "card-foo.baz.0", "card-foo.bar.0"},
+		},
+		{
+			name:     "interval ascending",
+			order:    FilterOrderIntervalAsc,
+			expected: []string{"card-foo.bar.1", "card-foo.bar.0", "card-foo.baz.0"},
+		},
+		{
+			name:     "interval descending",
+			order:    FilterOrderIntervalDesc,
+			expected: []string{"card-foo.baz.0", "card-foo.bar.0", "card-foo.bar.1"},
+		},
+		{
+			name:     "lapses, limited",
+			order:    FilterOrderLapses,
+			limit:    2,
+			expected: []string{"card-foo.bar.1", "card-foo.bar.0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cards, lookup := filteredFixtures()
+			fd := &FilteredDeck{ID: "fdeck-AQ", Query: "deck:spanish", Order: test.order, Limit: test.limit}
+			modified, err := fd.Rebuild(cards, lookup)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := diff.Interface(test.expected, fd.Cards); d != nil {
+				t.Error(d)
+			}
+			if d := diff.Interface(test.expected, filteredCardIDs(modified)); d != nil {
+				t.Error(d)
+			}
+			for _, c := range modified {
+				if c.Deck != "fdeck-AQ" || c.HomeDeck != "deck-AQ" {
+					t.Errorf("Card %s not moved: deck %s, home deck %s", c.ID, c.Deck, c.HomeDeck)
+				}
+			}
+		})
+	}
+}
+
+func TestFilteredDeckRebuildAgain(t *testing.T) {
+	cards, lookup := filteredFixtures()
+	fd := &FilteredDeck{ID: "fdeck-AQ", Query: "deck:spanish"}
+	if _, err := fd.Rebuild(cards, lookup); err != nil {
+		t.Fatal(err)
+	}
+	fd.Query = "prop:ivl>5"
+	modified, err := fd.Rebuild(cards, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.Interface([]string{"card-foo.baz.0", "card-foo.bar.0"}, fd.Cards); d != nil {
+		t.Error(d)
+	}
+	if d := diff.Interface([]string{"card-foo.bar.0", "card-foo.bar.1", "card-foo.baz.0"}, filteredCardIDs(modified)); d != nil {
+		t.Error(d)
+	}
+	if c := cards[1]; c.Deck != "deck-AQ" || c.HomeDeck != "" {
+		t.Errorf("Card %s not returned: deck %s, home deck %s", c.ID, c.Deck, c.HomeDeck)
+	}
+	fd.Query = "("
+	_, err = fd.Rebuild(cards, lookup)
+	checkErr(t, "invalid query: expected search term", err)
+}
+
+func TestFilteredDeckEmpty(t *testing.T) {
+	cards, lookup := filteredFixtures()
+	fd := &FilteredDeck{ID: "fdeck-AQ", Query: "deck:spanish"}
+	if _, err := fd.Rebuild(cards, lookup); err != nil {
+		t.Fatal(err)
+	}
+	stray := &Card{ID: "card-foo.qux.0", Deck: "fdeck-AQ"}
+	modified := fd.Empty(append(cards, stray))
+	if d := diff.Interface([]string{"card-foo.bar.0", "card-foo.bar.1", "card-foo.baz.0"}, filteredCardIDs(modified)); d != nil {
+		t.Error(d)
+	}
+	for _, c := range modified {
+		if c.Deck != "deck-AQ" || c.HomeDeck != "" {
+			t.Errorf("Card %s not returned: deck %s, home deck %s", c.ID, c.Deck, c.HomeDeck)
+		}
+	}
+	if len(fd.Cards) != 0 {
+		t.Errorf("Deck not emptied: %v", fd.Cards)
+	}
+	if c := cards[5]; c.Deck != "fdeck-Ag" || c.HomeDeck != "deck-AQ" {
+		t.Errorf("Card in other filtered deck was modified")
+	}
+	if stray.Deck != "fdeck-AQ" {
+		t.Errorf("Card without home deck was moved to deck '%s'", stray.Deck)
+	}
+}
+
+func TestFilteredDeckScheduler(t *testing.T) {
+	sm2, err := GetScheduler(SchedulerSM2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := &FilteredDeck{Reschedule: true}
+	if s := fd.Scheduler(sm2); s != sm2 {
+		t.Errorf("Expected the home scheduler")
+	}
+	fd.Reschedule = false
+	c := &Card{ID: "card-foo.bar.0", Queue: QueueReview, Interval: 10 * Day, EaseFactor: 2.5, Due: parseDue("2017-01-01")}
+	expected := *c
+	r, err := fd.Scheduler(sm2).Schedule(c, ReviewEaseOK, now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.CardID != c.ID || r.Ease != ReviewEaseOK || r.Type != ReviewTypeCram {
+		t.Errorf("Unexpected review: %v", r)
+	}
+	if d := diff.Interface(&expected, c); d != nil {
+		t.Error(d)
+	}
+
+	leech := &SM2Scheduler{LeechThreshold: 1, LeechAction: LeechSuspend}
+	r, err = fd.Scheduler(leech).Schedule(c, ReviewEaseWrong, now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Leech || r.Suspended || r.Interval != 10*Day || r.SRSFactor != 2.5 {
+		t.Errorf("Review does not match the unchanged card: %v", r)
+	}
+	if d := diff.Interface(&expected, c); d != nil {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,165 @@
+package fb
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultFSRSWeights are the default FSRS v4.5 model parameters.
+var DefaultFSRSWeights = [17]float64{
+	0.4872, 1.4003, 3.7145, 13.8206, 5.1618, 1.2298, 0.8975, 0.031, 1.6474,
+	0.1367, 1.0461, 2.1072, 0.0793, 0.3246, 1.587, 0.2272, 2.8755,
+}
+
+// FSRS forgetting curve constants.
+const (
+	fsrsDecay  = -0.5
+	fsrsFactor = 19.0 / 81.0
+)
+
+// FSRSScheduler schedules cards according to the Free Spaced Repetition
+// Scheduler algorithm (FSRS v4.5), as described at
+// https://github.com/open-spaced-repetition/fsrs4anki/wiki/The-Algorithm
+//
+// The memory state of each card is stored in its Stability and Difficulty
+// fields.
+type FSRSScheduler struct {
+	// Weights are the model parameters.
+	Weights [17]float64
+	// RequestRetention is the desired probability of recalling a card when it
+	// comes due.
+	RequestRetention float64
+	// MaxInterval is the longest interval which will be scheduled.
+	MaxInterval Interval
+	// LeechThreshold is the number of lapses after which a card is flagged as
+	// a leech, and LeechAction is applied. Zero disables leech detection.
+	LeechThreshold int
+	LeechAction    LeechAction
+	// LearningSteps and RelearningSteps are the delays between the steps a new
+	// or forgotten card passes through before (re)graduating to the review
+	// queue. If nil, DefaultLearningSteps and DefaultRelearningSteps are used.
+	LearningSteps   []Interval
+	RelearningSteps []Interval
+}
+
+// NewFSRSScheduler returns a new FSRSScheduler using the default parameters.
+func NewFSRSScheduler() *FSRSScheduler {
+	return &FSRSScheduler{
+		Weights:          DefaultFSRSWeights,
+		RequestRetention: 0.9,
+		MaxInterval:      DefaultMaxInterval,
+	}
+}
+
+// Schedule updates the card's Stability, Difficulty, Due and Interval to
+// reflect an answer of the given ease at the reviewed time, and returns a
+// Review recording the event. The memory state is only updated by answers to
+// new and review cards; answers given during the (re)learning steps affect
+// only the card's queue.
+func (s *FSRSScheduler) Schedule(c *Card, ease ReviewEase, reviewed time.Time) (*Review, error) {
+	if !ease.valid() {
+		return nil, errors.Errorf("invalid ease %d", ease)
+	}
+	reviewed = reviewed.UTC()
+	r, err := newReview(c, ease, reviewed)
+	if err != nil {
+		return nil, err
+	}
+
+	grade := float64(ease)
+	prev := c.queue()
+	next, step, delay, err := prev.transition(ease, c.LearningStep,
+		stepsOrDefault(s.LearningSteps, DefaultLearningSteps),
+		stepsOrDefault(s.RelearningSteps, DefaultRelearningSteps))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case prev == QueueNew || c.Stability == 0:
+		c.Stability = float32(s.Weights[int(ease)-1])
+		c.Difficulty = float32(s.initDifficulty(grade))
+	case prev == QueueReview:
+		lastS, lastD := float64(c.Stability), float64(c.Difficulty)
+		var elapsed float64
+		if !c.LastReview.IsZero() && reviewed.After(c.LastReview) {
+			elapsed = reviewed.Sub(c.LastReview).Hours() / 24
+		}
+		retrievability := math.Pow(1+fsrsFactor*elapsed/lastS, fsrsDecay)
+		stability := s.recallStability(lastD, lastS, retrievability, ease)
+		if ease == ReviewEaseWrong {
+			stability = s.forgetStability(lastD, lastS, retrievability)
+		}
+		c.Stability = float32(stability)
+		c.Difficulty = float32(s.nextDifficulty(lastD, grade))
+	}
+
+	lapse(c, r, prev, ease, s.LeechThreshold, s.LeechAction)
+	c.Queue, c.LearningStep = next, step
+	if delay == 0 || prev == QueueReview {
+		// A lapse is given its post-lapse interval at once, as by SM-2, so
+		// that it is recorded while the card is relearned
+		c.Interval = s.interval(float64(c.Stability))
+	}
+	if delay > 0 {
+		c.Due = Due(reviewed).Add(delay)
+	} else {
+		c.Due = Due(reviewed).Add(c.Interval)
+	}
+	c.LastReview = reviewed
+	c.ReviewCount++
+	c.Modified = now().UTC()
+	r.Interval = c.Interval
+	return r, nil
+}
+
+func (s *FSRSScheduler) initDifficulty(grade float64) float64 {
+	return clampDifficulty(s.Weights[4] - (grade-3)*s.Weights[5])
+}
+
+func (s *FSRSScheduler) nextDifficulty(d, grade float64) float64 {
+	next := d - s.Weights[6]*(grade-3)
+	// Mean reversion towards the initial difficulty of a "good" answer
+	next = s.Weights[7]*s.initDifficulty(3) + (1-s.Weights[7])*next
+	return clampDifficulty(next)
+}
+
+func (s *FSRSScheduler) recallStability(d, stability, retrievability float64, ease ReviewEase) float64 {
+	w := s.Weights
+	modifier := 1.0
+	switch ease {
+	case ReviewEaseHard:
+		modifier = w[15]
+	case ReviewEaseEasy:
+		modifier = w[16]
+	}
+	return stability * (1 + math.Exp(w[8])*
+		(11-d)*
+		math.Pow(stability, -w[9])*
+		(math.Exp((1-retrievability)*w[10])-1)*
+		modifier)
+}
+
+func (s *FSRSScheduler) forgetStability(d, stability, retrievability float64) float64 {
+	w := s.Weights
+	return w[11] *
+		math.Pow(d, -w[12]) *
+		(math.Pow(stability+1, w[13]) - 1) *
+		math.Exp((1-retrievability)*w[14])
+}
+
+// interval returns the interval after which the probability of recall will
+// have fallen to the requested retention, rounded to whole days.
+func (s *FSRSScheduler) interval(stability float64) Interval {
+	days := math.Floor(stability/fsrsFactor*(math.Pow(s.RequestRetention, 1/fsrsDecay)-1) + 0.5)
+	ivl := Interval(math.Max(days, 1)) * Day
+	if s.MaxInterval > 0 && ivl > s.MaxInterval {
+		return s.MaxInterval
+	}
+	return ivl
+}
+
+func clampDifficulty(d float64) float64 {
+	return math.Min(math.Max(d, 1), 10)
+}
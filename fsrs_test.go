@@ -0,0 +1,197 @@
+package fb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestFSRSSchedule(t *testing.T) {
+	const cardID = "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"
+	tests := []struct {
+		name       string
+		card       *Card
+		ease       ReviewEase
+		reviewed   string
+		stability  float32
+		difficulty float32
+		queue      CardQueue
+		interval   Interval
+		due        string
+		err        string
+	}{
+		{
+			name: "invalid ease",
+			card: &Card{ID: cardID},
+			ease: 0,
+			err:  "invalid ease 0",
+		},
+		{
+			name: "invalid card",
+			card: &Card{},
+			ease: ReviewEaseOK,
+			err:  "card id required",
+		},
+		{
+			name: "invalid queue",
+			card: &Card{ID: cardID, Queue: 7},
+			ease: ReviewEaseOK,
+			err:  "card cannot move from queue 7 to 7",
+		},
+		{
+			name:       "new card, wrong",
+			card:       &Card{ID: cardID},
+			ease:       ReviewEaseWrong,
+			reviewed:   "2017-01-01T12:00:00Z",
+			stability:  0.4872,
+			difficulty: 7.6214,
+			queue:      QueueLearning,
+			due:        "2017-01-01 12:01:00",
+		},
+		{
+			name:       "new card, ok",
+			card:       &Card{ID: cardID},
+			ease:       ReviewEaseOK,
+			reviewed:   "2017-01-01T12:00:00Z",
+			stability:  3.7145,
+			difficulty: 5.1618,
+			queue:      QueueLearning,
+			due:        "2017-01-01 12:10:00",
+		},
+		{
+			name:       "new card, easy",
+			card:       &Card{ID: cardID},
+			ease:       ReviewEaseEasy,
+			reviewed:   "2017-01-01T12:00:00Z",
+			stability:  13.8206,
+			difficulty: 3.932,
+			queue:      QueueReview,
+			interval:   14 * Day,
+			due:        "2017-01-15",
+		},
+		{
+			name: "graduation",
+			card: &Card{ID: cardID, Queue: QueueLearning, LearningStep: 1, Stability: 3.7145, Difficulty: 5.1618,
+				LastReview: parseTime("2017-01-01T12:00:00Z"), ReviewCount: 1},
+			ease:       ReviewEaseOK,
+			reviewed:   "2017-01-01T12:10:00Z",
+			stability:  3.7145,
+			difficulty: 5.1618,
+			queue:      QueueReview,
+			interval:   4 * Day,
+			due:        "2017-01-05",
+		},
+		{
+			name: "review, ok",
+			card: &Card{ID: cardID, Queue: QueueReview, Interval: 4 * Day, Stability: 3.7145, Difficulty: 5.1618,
+				LastReview: parseTime("2017-01-01T12:00:00Z"), ReviewCount: 2},
+			ease:       ReviewEaseOK,
+			reviewed:   "2017-01-05T12:00:00Z",
+			stability:  14.8081,
+			difficulty: 5.1618,
+			queue:      QueueReview,
+			interval:   15 * Day,
+			due:        "2017-01-20",
+		},
+		{
+			name: "review, wrong",
+			card: &Card{ID: cardID, Queue: QueueReview, Interval: 4 * Day, Stability: 3.7145, Difficulty: 5.1618,
+				LastReview: parseTime("2017-01-01T12:00:00Z"), ReviewCount: 2},
+			ease:       ReviewEaseWrong,
+			reviewed:   "2017-01-05T12:00:00Z",
+			stability:  1.4332,
+			difficulty: 6.9012,
+			queue:      QueueRelearning,
+			interval:   Day,
+			due:        "2017-01-05 12:10:00",
+		},
+		{
+			name: "relearned",
+			card: &Card{ID: cardID, Queue: QueueRelearning, Interval: Day, Stability: 1.4332, Difficulty: 6.9012,
+				LastReview: parseTime("2017-01-05T12:00:00Z"), ReviewCount: 3},
+			ease:       ReviewEaseOK,
+			reviewed:   "2017-01-05T12:10:00Z",
+			stability:  1.4332,
+			difficulty: 6.9012,
+			queue:      QueueReview,
+			interval:   Day,
+			due:        "2017-01-06",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := NewFSRSScheduler()
+			reviewed := now()
+			if test.reviewed != "" {
+				reviewed = parseTime(test.reviewed)
+			}
+			count := test.card.ReviewCount
+			prevInterval := test.card.Interval
+			reviewType := test.card.queue().reviewType()
+			result, err := s.Schedule(test.card, test.ease, reviewed)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			expected := &Review{
+				CardID:           cardID,
+				Timestamp:        reviewed,
+				Ease:             test.ease,
+				Interval:         test.interval,
+				PreviousInterval: prevInterval,
+				Type:             reviewType,
+			}
+			if d := diff.Interface(expected, result); d != nil {
+				t.Error(d)
+			}
+			c := test.card
+			if math.Abs(float64(c.Stability-test.stability)) > 1e-4 {
+				t.Errorf("Unexpected stability: %v", c.Stability)
+			}
+			if math.Abs(float64(c.Difficulty-test.difficulty)) > 1e-4 {
+				t.Errorf("Unexpected difficulty: %v", c.Difficulty)
+			}
+			if c.Queue != test.queue {
+				t.Errorf("Unexpected queue: %s", c.Queue)
+			}
+			if c.Interval != test.interval {
+				t.Errorf("Unexpected interval: %s", c.Interval)
+			}
+			if due := c.Due.String(); due != test.due {
+				t.Errorf("Unexpected due date: %s", due)
+			}
+			if !c.LastReview.Equal(reviewed) {
+				t.Errorf("Unexpected last review: %v", c.LastReview)
+			}
+			if c.ReviewCount != count+1 {
+				t.Errorf("Unexpected review count: %d", c.ReviewCount)
+			}
+		})
+	}
+}
+
+func TestFSRSLeech(t *testing.T) {
+	s := NewFSRSScheduler()
+	s.LeechThreshold = 2
+	card := &Card{ID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Queue: QueueReview, Interval: 4 * Day,
+		Stability: 3.7145, Difficulty: 5.1618, LastReview: parseTime("2017-01-01T12:00:00Z"), LapseCount: 1}
+	r, err := s.Schedule(card, ReviewEaseWrong, parseTime("2017-01-05T12:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.LapseCount != 2 || !card.Leech || !card.Suspended {
+		t.Errorf("Unexpected card state: lapses=%d leech=%t suspended=%t", card.LapseCount, card.Leech, card.Suspended)
+	}
+	if !r.Leech || !r.Suspended {
+		t.Errorf("Leech not recorded in review")
+	}
+}
+
+func TestFSRSMaxInterval(t *testing.T) {
+	s := NewFSRSScheduler()
+	s.MaxInterval = 10 * Day
+	if ivl := s.interval(500); ivl != 10*Day {
+		t.Errorf("Unexpected interval: %s", ivl)
+	}
+}
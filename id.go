@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/pborman/uuid"
 	"github.com/pkg/errors"
 )
 
@@ -12,6 +13,8 @@ var validDocIDTypes = map[string]struct{}{
 	"note":  {},
 	"deck":  {},
 	"card":  {},
+	"dconf": {},
+	"fdeck": {},
 }
 
 func validateDocID(id string) error {
@@ -33,3 +36,36 @@ func validateDocID(id string) error {
 func EncodeDocID(docType string, id []byte) string {
 	return fmt.Sprintf("%s-%s", docType, b64encoder.EncodeToString(id))
 }
+
+// docIDNamespace is the UUID namespace in which each source namespace passed
+// to DeriveDocID is itself a name.
+var docIDNamespace = uuid.NewSHA1(uuid.NameSpace_URL, []byte("https://github.com/FlashbackSRS/flashback-model"))
+
+// DeriveDocID generates a deterministic DocID of the given type from a source
+// namespace, such as "anki", and a key identifying the document within that
+// source, such as an Anki note GUID. The ID is a name-based (version 5) UUID,
+// so importing the same source document again always yields the same ID. No
+// validation is done of the docType.
+func DeriveDocID(docType, namespace, key string) string {
+	ns := uuid.NewSHA1(docIDNamespace, []byte(namespace))
+	return EncodeDocID(docType, uuid.NewSHA1(ns, []byte(key)))
+}
+
+// NewCardID returns the ID of the card for the given template of a note, in
+// the format card-<bundle>.<note>.<template>, after validating the bundle
+// and note IDs.
+func NewCardID(bundle BundleID, note NoteID, templateID uint32) (CardID, error) {
+	if _, err := ParseBundleID(string(bundle)); err != nil {
+		return CardID{}, errors.Wrap(err, "invalid bundle ID")
+	}
+	if _, err := ParseNoteID(string(note)); err != nil {
+		return CardID{}, errors.Wrap(err, "invalid note ID")
+	}
+	return CardID{Bundle: bundle, Note: note, Template: templateID}, nil
+}
+
+// DeriveCardID returns the ID of the card for the given template of the note
+// whose ID is derived, as by DeriveDocID, from namespace and key.
+func DeriveCardID(bundle BundleID, namespace, key string, templateID uint32) (CardID, error) {
+	return NewCardID(bundle, NoteID(DeriveDocID("note", namespace, key)), templateID)
+}
@@ -1,6 +1,7 @@
 package fb
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -50,3 +51,92 @@ func TestEncodeDocID(t *testing.T) {
 		t.Errorf("Unexpected result: %s", result)
 	}
 }
+
+func TestDeriveDocID(t *testing.T) {
+	// The derivation must never change, or re-imports would duplicate notes
+	const expected = "note-U3iIly0nVhWm2ZhHmTpBaw"
+	id := DeriveDocID("note", "anki", "f]8Wd}[Wq0")
+	if id != expected {
+		t.Errorf("Unexpected result: %s", id)
+	}
+	if again := DeriveDocID("note", "anki", "f]8Wd}[Wq0"); again != id {
+		t.Errorf("Expected the same ID twice, got %s and %s", id, again)
+	}
+	for _, other := range []string{
+		DeriveDocID("note", "anki", "f]8Wd}[Wq1"),
+		DeriveDocID("note", "mnemosyne", "f]8Wd}[Wq0"),
+	} {
+		if other == id {
+			t.Errorf("Expected a distinct ID, got %s", other)
+		}
+	}
+}
+
+func TestNewCardID(t *testing.T) {
+	tests := []struct {
+		name     string
+		bundle   BundleID
+		note     NoteID
+		template uint32
+		expected string
+		err      string
+	}{
+		{
+			name:   "invalid bundle",
+			bundle: "foo",
+			note:   "note-Zm9v",
+			err:    "invalid bundle ID: invalid DBID format",
+		},
+		{
+			name:   "wrong bundle type",
+			bundle: "user-mjxwe",
+			note:   "note-Zm9v",
+			err:    "invalid bundle ID: incorrect doc type",
+		},
+		{
+			name:   "invalid note",
+			bundle: "bundle-mjxwe",
+			note:   "note",
+			err:    "invalid note ID: invalid DocID format",
+		},
+		{
+			name:   "wrong note type",
+			bundle: "bundle-mjxwe",
+			note:   "deck-Zm9v",
+			err:    "invalid note ID: incorrect doc type",
+		},
+		{
+			name:     "valid",
+			bundle:   "bundle-mjxwe",
+			note:     "note-Zm9v",
+			template: 2,
+			expected: "card-mjxwe.Zm9v.2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := NewCardID(test.bundle, test.note, test.template)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result.String() != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
+
+func TestDeriveCardID(t *testing.T) {
+	result, err := DeriveCardID("bundle-mjxwe", "anki", "f]8Wd}[Wq0", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	note := DeriveDocID("note", "anki", "f]8Wd}[Wq0")
+	if expected := "card-mjxwe." + strings.TrimPrefix(note, "note-") + ".1"; result.String() != expected {
+		t.Errorf("Unexpected result: %s", result)
+	}
+	if _, err := ParseCardID(result.String()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,252 @@
+package fb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// BundleID is the ID of a bundle, in the form bundle-<key>.
+type BundleID string
+
+// ParseBundleID parses and validates a bundle ID.
+func ParseBundleID(s string) (BundleID, error) {
+	if err := validateDBID(s); err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(s, "bundle-") {
+		return "", errors.New("incorrect doc type")
+	}
+	return BundleID(s), nil
+}
+
+func (id BundleID) String() string { return string(id) }
+
+// Key returns the ID without its bundle- prefix, as used in card IDs.
+func (id BundleID) Key() string { return strings.TrimPrefix(string(id), "bundle-") }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (id BundleID) MarshalText() ([]byte, error) {
+	return marshalID(ParseBundleID(string(id)))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (id *BundleID) UnmarshalText(text []byte) error {
+	parsed, err := ParseBundleID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// NoteID is the ID of a note, in the form note-<key>.
+type NoteID string
+
+// ParseNoteID parses and validates a note ID.
+func ParseNoteID(s string) (NoteID, error) {
+	if err := parseDocID(s, "note"); err != nil {
+		return "", err
+	}
+	return NoteID(s), nil
+}
+
+func (id NoteID) String() string { return string(id) }
+
+// Key returns the ID without its note- prefix, as used in card IDs.
+func (id NoteID) Key() string { return strings.TrimPrefix(string(id), "note-") }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (id NoteID) MarshalText() ([]byte, error) {
+	return marshalID(ParseNoteID(string(id)))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (id *NoteID) UnmarshalText(text []byte) error {
+	parsed, err := ParseNoteID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// ThemeID is the ID of a theme, in the form theme-<key>.
+type ThemeID string
+
+// ParseThemeID parses and validates a theme ID.
+func ParseThemeID(s string) (ThemeID, error) {
+	if err := parseDocID(s, "theme"); err != nil {
+		return "", err
+	}
+	return ThemeID(s), nil
+}
+
+func (id ThemeID) String() string { return string(id) }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (id ThemeID) MarshalText() ([]byte, error) {
+	return marshalID(ParseThemeID(string(id)))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (id *ThemeID) UnmarshalText(text []byte) error {
+	parsed, err := ParseThemeID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// DeckID is the ID of a deck, in the form deck-<key>.
+type DeckID string
+
+// ParseDeckID parses and validates a deck ID.
+func ParseDeckID(s string) (DeckID, error) {
+	if err := parseDocID(s, "deck"); err != nil {
+		return "", err
+	}
+	return DeckID(s), nil
+}
+
+func (id DeckID) String() string { return string(id) }
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (id DeckID) MarshalText() ([]byte, error) {
+	return marshalID(ParseDeckID(string(id)))
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (id *DeckID) UnmarshalText(text []byte) error {
+	parsed, err := ParseDeckID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// CardID is the compound ID of a card, in the form
+//
+//	card-<bundle>.<note>.<template>
+//
+// where bundle and note are the keys of the bundle and note IDs, and template
+// is the index of the card's template within the note's model.
+type CardID struct {
+	Bundle   BundleID
+	Note     NoteID
+	Template uint32
+}
+
+// ParseCardID parses a card ID. Only the format of the ID is checked; the
+// bundle and note keys are not validated.
+func ParseCardID(s string) (CardID, error) {
+	if !strings.HasPrefix(s, "card-") {
+		return CardID{}, errors.New("invalid ID type")
+	}
+	parts := strings.Split(strings.TrimPrefix(s, "card-"), ".")
+	if len(parts) != 3 {
+		return CardID{}, errors.New("invalid ID format")
+	}
+	template, err := strconv.ParseUint(parts[2], 10, 32)
+	if err != nil {
+		return CardID{}, errors.Wrap(err, "invalid TemplateID")
+	}
+	return CardID{
+		Bundle:   BundleID("bundle-" + parts[0]),
+		Note:     NoteID("note-" + parts[1]),
+		Template: uint32(template),
+	}, nil
+}
+
+func (id CardID) String() string {
+	return fmt.Sprintf("card-%s.%s.%d", id.Bundle.Key(), id.Note.Key(), id.Template)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (id CardID) MarshalText() ([]byte, error) {
+	if id.Bundle == "" || id.Note == "" {
+		return nil, errors.New("invalid ID format")
+	}
+	return []byte(id.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (id *CardID) UnmarshalText(text []byte) error {
+	parsed, err := ParseCardID(string(text))
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// ModelRef refers to a model by its theme and its ID within the theme, in
+// the form theme-<key>/<model>.
+type ModelRef struct {
+	Theme ThemeID
+	Model uint32
+}
+
+// ParseModelRef parses a model reference. Only the format of the reference
+// is checked; the theme ID is not validated.
+func ParseModelRef(s string) (ModelRef, error) {
+	if !strings.HasPrefix(s, themeIDPrefix) {
+		return ModelRef{}, errors.New("invalid theme ID type")
+	}
+	parts := strings.Split(strings.TrimPrefix(s, themeIDPrefix), "/")
+	if len(parts) != 2 {
+		return ModelRef{}, errors.New("invalid theme ID format")
+	}
+	model, err := strconv.ParseUint(parts[1], 10, 32)
+	if err != nil {
+		return ModelRef{}, errors.Wrap(err, "invalid Model index")
+	}
+	return ModelRef{
+		Theme: ThemeID(themeIDPrefix + parts[0]),
+		Model: uint32(model),
+	}, nil
+}
+
+func (ref ModelRef) String() string {
+	return fmt.Sprintf("%s/%d", ref.Theme, ref.Model)
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (ref ModelRef) MarshalText() ([]byte, error) {
+	if ref.Theme == "" {
+		return nil, errors.New("invalid theme ID type")
+	}
+	return []byte(ref.String()), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (ref *ModelRef) UnmarshalText(text []byte) error {
+	parsed, err := ParseModelRef(string(text))
+	if err != nil {
+		return err
+	}
+	*ref = parsed
+	return nil
+}
+
+// parseDocID validates a DocID of the given type.
+func parseDocID(s, docType string) error {
+	if err := validateDocID(s); err != nil {
+		return err
+	}
+	if !strings.HasPrefix(s, docType+"-") {
+		return errors.New("incorrect doc type")
+	}
+	return nil
+}
+
+func marshalID(id fmt.Stringer, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	return []byte(id.String()), nil
+}
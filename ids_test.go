@@ -0,0 +1,161 @@
+package fb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestParseDocIDs(t *testing.T) {
+	parsers := map[string]func(string) (interface{}, error){
+		"bundle": func(s string) (interface{}, error) { return ParseBundleID(s) },
+		"note":   func(s string) (interface{}, error) { return ParseNoteID(s) },
+		"theme":  func(s string) (interface{}, error) { return ParseThemeID(s) },
+		"deck":   func(s string) (interface{}, error) { return ParseDeckID(s) },
+		"card":   func(s string) (interface{}, error) { return ParseCardID(s) },
+	}
+	tests := []struct {
+		name     string
+		parser   string
+		input    string
+		expected interface{}
+		err      string
+	}{
+		{name: "bundle empty", parser: "bundle", err: "invalid DBID format"},
+		{name: "bundle wrong type", parser: "bundle", input: "user-mjxwe", err: "incorrect doc type"},
+		{name: "bundle invalid encoding", parser: "bundle", input: "bundle-MJXWE", err: "invalid DBID encoding"},
+		{name: "bundle valid", parser: "bundle", input: "bundle-mjxwe", expected: BundleID("bundle-mjxwe")},
+		{name: "note empty", parser: "note", err: "invalid DocID format"},
+		{name: "note wrong type", parser: "note", input: "card-Zm9v", err: "incorrect doc type"},
+		{name: "note valid", parser: "note", input: "note-Zm9v", expected: NoteID("note-Zm9v")},
+		{name: "theme wrong type", parser: "theme", input: "deck-Zm9v", err: "incorrect doc type"},
+		{name: "theme valid", parser: "theme", input: "theme-Zm9v", expected: ThemeID("theme-Zm9v")},
+		{name: "deck unsupported type", parser: "deck", input: "foo-Zm9v", err: "unsupported DocID type 'foo'"},
+		{name: "deck valid", parser: "deck", input: "deck-Zm9v", expected: DeckID("deck-Zm9v")},
+		{name: "card valid", parser: "card", input: "card-Zm9v.YmFy.4294967295", expected: CardID{Bundle: "bundle-Zm9v", Note: "note-YmFy", Template: 4294967295}},
+		{name: "card negative template", parser: "card", input: "card-Zm9v.YmFy.-1", err: `invalid TemplateID: strconv.ParseUint: parsing "-1": invalid syntax`},
+		{name: "card template too large", parser: "card", input: "card-Zm9v.YmFy.4294967296", err: `invalid TemplateID: strconv.ParseUint: parsing "4294967296": value out of range`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parsers[test.parser](test.input)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result != test.expected {
+				t.Errorf("Unexpected result: %v", result)
+			}
+		})
+	}
+}
+
+func TestIDKeys(t *testing.T) {
+	if key := BundleID("bundle-mjxwe").Key(); key != "mjxwe" {
+		t.Errorf("Unexpected bundle key: %s", key)
+	}
+	if key := NoteID("note-Zm9v").Key(); key != "Zm9v" {
+		t.Errorf("Unexpected note key: %s", key)
+	}
+}
+
+func TestCardIDString(t *testing.T) {
+	const input = "card-krsxg5baij2w4zdmmu.mViuXQThMLoh1G1Nlc4d_E8kR8o.3"
+	id, err := ParseCardID(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := CardID{Bundle: "bundle-krsxg5baij2w4zdmmu", Note: "note-mViuXQThMLoh1G1Nlc4d_E8kR8o", Template: 3}
+	if d := diff.Interface(expected, id); d != nil {
+		t.Error(d)
+	}
+	if id.String() != input {
+		t.Errorf("Unexpected string: %s", id)
+	}
+}
+
+func TestParseModelRef(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected ModelRef
+		err      string
+	}{
+		{
+			name: "empty",
+			err:  "invalid theme ID type",
+		},
+		{
+			name:  "negative model",
+			input: "theme-Zm9v/-1",
+			err:   `invalid Model index: strconv.ParseUint: parsing "-1": invalid syntax`,
+		},
+		{
+			name:  "model out of range",
+			input: "theme-Zm9v/4294967296",
+			err:   `invalid Model index: strconv.ParseUint: parsing "4294967296": value out of range`,
+		},
+		{
+			name:     "valid",
+			input:    "theme-Zm9v/2",
+			expected: ModelRef{Theme: "theme-Zm9v", Model: 2},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ParseModelRef(test.input)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result != test.expected {
+				t.Errorf("Unexpected result: %v", result)
+			}
+			if result.String() != test.input {
+				t.Errorf("Unexpected string: %s", result)
+			}
+		})
+	}
+}
+
+type typedIDs struct {
+	Bundle BundleID `json:"bundle"`
+	Note   NoteID   `json:"note"`
+	Theme  ThemeID  `json:"theme"`
+	Deck   DeckID   `json:"deck"`
+	Card   CardID   `json:"card"`
+	Model  ModelRef `json:"model"`
+}
+
+func TestTypedIDsJSON(t *testing.T) {
+	const valid = `{"bundle":"bundle-mjxwe", "note":"note-Zm9v", "theme":"theme-Zm9v", "deck":"deck-Zm9v", "card":"card-mjxwe.Zm9v.1", "model":"theme-Zm9v/0"}`
+	t.Run("round trip", func(t *testing.T) {
+		ids := &typedIDs{}
+		if err := json.Unmarshal([]byte(valid), ids); err != nil {
+			t.Fatal(err)
+		}
+		expected := &typedIDs{
+			Bundle: "bundle-mjxwe",
+			Note:   "note-Zm9v",
+			Theme:  "theme-Zm9v",
+			Deck:   "deck-Zm9v",
+			Card:   CardID{Bundle: "bundle-mjxwe", Note: "note-Zm9v", Template: 1},
+			Model:  ModelRef{Theme: "theme-Zm9v"},
+		}
+		if d := diff.Interface(expected, ids); d != nil {
+			t.Fatal(d)
+		}
+		if d := diff.AsJSON(json.RawMessage(valid), ids); d != nil {
+			t.Error(d)
+		}
+	})
+	t.Run("unmarshal wrong type", func(t *testing.T) {
+		err := json.Unmarshal([]byte(`{"note":"card-Zm9v"}`), &typedIDs{})
+		checkErr(t, "incorrect doc type", err)
+	})
+	t.Run("marshal invalid", func(t *testing.T) {
+		_, err := NoteID("deck-Zm9v").MarshalText()
+		checkErr(t, "incorrect doc type", err)
+	})
+}
@@ -0,0 +1,35 @@
+package fb
+
+// isLeech returns true if a card with the given number of lapses has just
+// become, or is again confirmed as, a leech. As with Anki, a card is first
+// flagged when its lapse count reaches the threshold, and again every half
+// threshold thereafter.
+func isLeech(lapses, threshold int) bool {
+	if threshold <= 0 || lapses < threshold {
+		return false
+	}
+	every := threshold / 2
+	if every < 1 {
+		every = 1
+	}
+	return (lapses-threshold)%every == 0
+}
+
+// lapse records a review of the given ease on a card in queue prev. If the
+// card was forgotten, its lapse count is incremented and, should it cross the
+// leech threshold, the leech action is applied to the card and noted in r.
+func lapse(c *Card, r *Review, prev CardQueue, ease ReviewEase, threshold int, action LeechAction) {
+	if prev != QueueReview || ease != ReviewEaseWrong {
+		return
+	}
+	c.LapseCount++
+	if !isLeech(c.LapseCount, threshold) {
+		return
+	}
+	c.Leech = true
+	r.Leech = true
+	if action == LeechSuspend {
+		c.Suspended = true
+		r.Suspended = true
+	}
+}
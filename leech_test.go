@@ -0,0 +1,28 @@
+package fb
+
+import "testing"
+
+func TestIsLeech(t *testing.T) {
+	tests := []struct {
+		name      string
+		lapses    int
+		threshold int
+		expected  bool
+	}{
+		{name: "disabled", lapses: 8, threshold: 0},
+		{name: "below threshold", lapses: 7, threshold: 8},
+		{name: "at threshold", lapses: 8, threshold: 8, expected: true},
+		{name: "between", lapses: 9, threshold: 8},
+		{name: "half threshold later", lapses: 12, threshold: 8, expected: true},
+		{name: "full threshold later", lapses: 16, threshold: 8, expected: true},
+		{name: "threshold of one", lapses: 3, threshold: 1, expected: true},
+		{name: "odd threshold", lapses: 5, threshold: 3, expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := isLeech(test.lapses, test.threshold); result != test.expected {
+				t.Errorf("Unexpected result: %t", result)
+			}
+		})
+	}
+}
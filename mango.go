@@ -0,0 +1,325 @@
+package fb
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// MangoSelector is a CouchDB Mango query selector, as used by the _find
+// endpoint, and by PouchDB's find plugin.
+type MangoSelector map[string]interface{}
+
+// MangoContext provides the documents needed to translate names used in a
+// search query into the IDs stored in cards and notes.
+type MangoContext struct {
+	// Decks are searched by path for deck: terms. They need not be linked
+	// to their parents, and are left unchanged.
+	Decks []*Deck
+	// Themes are searched for the models named by model: terms, and the
+	// fields named by field terms.
+	Themes []*Theme
+}
+
+// CardSelector translates the query to a selector of card documents, for use
+// with CouchDB or PouchDB. Terms which apply to notes, such as tag:, field and
+// text terms, cannot be used, as a selector matches only the fields of a
+// single document. Search notes with NoteSelector instead. Deck and model
+// names are resolved against ctx, which may be nil if the query names none.
+// Date-relative terms, such as is:due, are resolved against the current time.
+func (q *SearchQuery) CardSelector(ctx *MangoContext) (MangoSelector, error) {
+	return q.selector("card", ctx, (*mangoTranslator).cardTerm)
+}
+
+// NoteSelector translates the query to a selector of note documents, for use
+// with CouchDB or PouchDB. Terms which apply to cards, such as deck:, is: and
+// prop: terms, cannot be used. Model and field names are resolved against
+// ctx, which may be nil if the query names none.
+func (q *SearchQuery) NoteSelector(ctx *MangoContext) (MangoSelector, error) {
+	return q.selector("note", ctx, (*mangoTranslator).noteTerm)
+}
+
+type mangoTranslator struct {
+	ctx *MangoContext
+}
+
+func (q *SearchQuery) selector(docType string, ctx *MangoContext, term func(*mangoTranslator, *SearchTerm) (MangoSelector, error)) (MangoSelector, error) {
+	if ctx == nil {
+		ctx = &MangoContext{}
+	}
+	decks := copyDecks(ctx.Decks)
+	buildDeckTree(decks, newReporter())
+	mt := &mangoTranslator{ctx: &MangoContext{Decks: decks, Themes: ctx.Themes}}
+	sel := MangoSelector{"type": docType}
+	if q.Root == nil {
+		return sel, nil
+	}
+	root, err := mt.node(q.Root, term)
+	if err != nil {
+		return nil, err
+	}
+	return MangoSelector{"$and": []MangoSelector{sel, root}}, nil
+}
+
+func (mt *mangoTranslator) node(node SearchNode, term func(*mangoTranslator, *SearchTerm) (MangoSelector, error)) (MangoSelector, error) {
+	switch n := node.(type) {
+	case *SearchAnd:
+		return mt.nodes("$and", n.Nodes, term)
+	case *SearchOr:
+		return mt.nodes("$or", n.Nodes, term)
+	case *SearchNot:
+		sel, err := mt.node(n.Node, term)
+		if err != nil {
+			return nil, err
+		}
+		return MangoSelector{"$nor": []MangoSelector{sel}}, nil
+	case *SearchTerm:
+		return term(mt, n)
+	}
+	return nil, errors.Errorf("unknown search node %T", node)
+}
+
+func (mt *mangoTranslator) nodes(op string, nodes []SearchNode, term func(*mangoTranslator, *SearchTerm) (MangoSelector, error)) (MangoSelector, error) {
+	sels := make([]MangoSelector, len(nodes))
+	for i, n := range nodes {
+		sel, err := mt.node(n, term)
+		if err != nil {
+			return nil, err
+		}
+		sels[i] = sel
+	}
+	return MangoSelector{op: sels}, nil
+}
+
+func (mt *mangoTranslator) cardTerm(t *SearchTerm) (MangoSelector, error) {
+	switch t.Key {
+	case SearchDeck:
+		ids := []string{}
+		for _, d := range mt.ctx.Decks {
+			if t.pattern.MatchString(d.Path()) {
+				ids = append(ids, d.ID)
+			}
+		}
+		return MangoSelector{"deck": MangoSelector{"$in": ids}}, nil
+	case SearchModel:
+		refs := []string{}
+		for _, m := range mt.models(t) {
+			refs = append(refs, ModelRef{Theme: ThemeID(m.Theme.ID), Model: m.ID}.String())
+		}
+		return MangoSelector{"model": MangoSelector{"$in": refs}}, nil
+	case SearchIs:
+		return cardStateSelector(t.Value), nil
+	case SearchProp:
+		return cardPropSelector(t), nil
+	}
+	return nil, errors.Errorf("'%s' cannot be used in a card selector", t)
+}
+
+func (mt *mangoTranslator) noteTerm(t *SearchTerm) (MangoSelector, error) {
+	switch t.Key {
+	case SearchText:
+		return MangoSelector{"fieldValues": MangoSelector{"$elemMatch": MangoSelector{
+			"text": MangoSelector{"$regex": mangoRegex(t)},
+		}}}, nil
+	case SearchTag:
+		return MangoSelector{"tags": MangoSelector{"$elemMatch": MangoSelector{"$regex": mangoRegex(t)}}}, nil
+	case SearchModel:
+		sels := []MangoSelector{}
+		for _, m := range mt.models(t) {
+			sels = append(sels, MangoSelector{"theme": m.Theme.ID, "model": m.ID})
+		}
+		return MangoSelector{"$or": sels}, nil
+	case SearchDeck, SearchIs, SearchProp:
+		return nil, errors.Errorf("'%s' cannot be used in a note selector", t)
+	}
+	sels := []MangoSelector{}
+	for _, th := range mt.ctx.Themes {
+		for _, m := range th.Models {
+			for i, f := range m.Fields {
+				if strings.EqualFold(f.Name, t.Key) {
+					sels = append(sels, MangoSelector{
+						"theme": th.ID,
+						"model": m.ID,
+						"fieldValues." + strconv.Itoa(i) + ".text": MangoSelector{"$regex": mangoRegex(t)},
+					})
+				}
+			}
+		}
+	}
+	if len(sels) == 0 {
+		return nil, errors.Errorf("no model has a field named '%s'", t.Key)
+	}
+	return MangoSelector{"$or": sels}, nil
+}
+
+// mangoRegex returns the $regex value matching the text of a text, tag or
+// field term, as t.pattern does.
+func mangoRegex(t *SearchTerm) string {
+	switch t.Key {
+	case SearchText:
+		return mangoPattern(t.Value, false)
+	case SearchTag:
+		return mangoPattern(t.Value, true) + "|" + mangoPattern(t.Value+TagSeparator+"*", true)
+	}
+	return mangoPattern(t.Value, true)
+}
+
+// mangoPattern is as searchPattern, but returns a pattern without inline
+// flags, which JavaScript, as used by PouchDB, does not support. Letters are
+// instead matched in either case by character classes, and "*" matches any
+// run of characters, including newlines.
+func mangoPattern(value string, exact bool) string {
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		var buf bytes.Buffer
+		for _, r := range part {
+			lower, upper := unicode.ToLower(r), unicode.ToUpper(r)
+			// Characters outside the Basic Multilingual Plane are
+			// matched as pairs of code units by JavaScript, so cannot
+			// be placed in a class.
+			if lower == upper || lower > 0xFFFF || upper > 0xFFFF {
+				buf.WriteString(regexp.QuoteMeta(string(r)))
+				continue
+			}
+			buf.WriteString("[" + string(lower) + string(upper) + "]")
+		}
+		parts[i] = buf.String()
+	}
+	pattern := strings.Join(parts, `[\s\S]*`)
+	if exact {
+		pattern = "^" + pattern + "$"
+	}
+	return pattern
+}
+
+// models returns the models of the context whose names match the term.
+func (mt *mangoTranslator) models(t *SearchTerm) []*Model {
+	var models []*Model
+	for _, th := range mt.ctx.Themes {
+		for _, m := range th.Models {
+			if t.pattern.MatchString(m.Name) {
+				models = append(models, m)
+			}
+		}
+	}
+	return models
+}
+
+// Cards in the new queue have no stored state. Cards stored before the queue
+// was tracked are review cards if they have an interval of a day or more,
+// which is stored as a positive number. See Card.queue.
+var (
+	mangoNewCard = MangoSelector{
+		"state": MangoSelector{"$exists": false},
+		"$or": []MangoSelector{
+			{"interval": MangoSelector{"$exists": false}},
+			{"interval": MangoSelector{"$lte": 0}},
+		},
+	}
+	mangoLegacyCard = MangoSelector{"state": MangoSelector{"$exists": false}, "interval": MangoSelector{"$gt": 0}}
+)
+
+func cardStateSelector(state string) MangoSelector {
+	switch state {
+	case "due":
+		return MangoSelector{"$and": []MangoSelector{
+			{"$or": []MangoSelector{
+				{"state": MangoSelector{"$in": []string{QueueLearning.String(), QueueReview.String(), QueueRelearning.String()}}},
+				mangoLegacyCard,
+			}},
+			{"due": MangoSelector{"$lte": Now().String()}},
+			{"$nor": []MangoSelector{{"suspended": true}, mangoBuried()}},
+		}}
+	case "new":
+		return mangoNewCard
+	case "learn":
+		return MangoSelector{"state": MangoSelector{"$in": []string{QueueLearning.String(), QueueRelearning.String()}}}
+	case "review":
+		return MangoSelector{"$or": []MangoSelector{
+			{"state": QueueReview.String()},
+			mangoLegacyCard,
+		}}
+	case "suspended":
+		return MangoSelector{"suspended": true}
+	case "buried":
+		return mangoBuried()
+	}
+	return MangoSelector{"leech": true}
+}
+
+// mangoBuried matches cards which are currently buried. See Card.IsBuried.
+func mangoBuried() MangoSelector {
+	return MangoSelector{"buriedUntil": MangoSelector{"$gt": Today().String()}}
+}
+
+// The stored fields of the properties of prop: terms.
+var mangoProps = map[string]string{
+	"ivl":    "interval",
+	"ease":   "easeFactor",
+	"reps":   "reviewCount",
+	"lapses": "lapseCount",
+}
+
+var mangoOps = map[string]string{
+	"=":  "$eq",
+	"!=": "$ne",
+	"<":  "$lt",
+	"<=": "$lte",
+	">":  "$gt",
+	">=": "$gte",
+}
+
+func cardPropSelector(t *SearchTerm) MangoSelector {
+	if t.Prop == "due" {
+		return cardDueSelector(t.Op, int(t.Number))
+	}
+	field := mangoProps[t.Prop]
+	// Zero values are omitted from stored cards, and intervals of less than
+	// a day are stored as negative seconds, so only positive values are
+	// compared directly. A $gt operator replaces the lower bound, which it
+	// then implies, unless the comparison also holds for zero.
+	cond := MangoSelector{"$gt": 0}
+	cond[mangoOps[t.Op]] = t.Number
+	sel := MangoSelector{field: cond}
+	if !compareNumbers(0, t.Op, t.Number) {
+		return sel
+	}
+	return MangoSelector{"$or": []MangoSelector{
+		sel,
+		{field: MangoSelector{"$exists": false}},
+		{field: MangoSelector{"$lte": 0}},
+	}}
+}
+
+// cardDueSelector matches cards due the given number of days from today.
+// Due dates are stored as strings, which sort chronologically, and which
+// include a time for cards in learning, so each comparison is made against
+// the start of a day.
+func cardDueSelector(op string, days int) MangoSelector {
+	day := func(n int) string {
+		return Today().Add(Interval(n) * Day).String()
+	}
+	var due MangoSelector
+	switch op {
+	case "<":
+		due = MangoSelector{"due": MangoSelector{"$lt": day(days)}}
+	case "<=":
+		due = MangoSelector{"due": MangoSelector{"$lt": day(days + 1)}}
+	case ">":
+		due = MangoSelector{"due": MangoSelector{"$gte": day(days + 1)}}
+	case ">=":
+		due = MangoSelector{"due": MangoSelector{"$gte": day(days)}}
+	case "!=":
+		due = MangoSelector{"$or": []MangoSelector{
+			{"due": MangoSelector{"$lt": day(days)}},
+			{"due": MangoSelector{"$gte": day(days + 1)}},
+		}}
+	default:
+		due = MangoSelector{"due": MangoSelector{"$gte": day(days), "$lt": day(days + 1)}}
+	}
+	return MangoSelector{"$and": []MangoSelector{{"$nor": []MangoSelector{mangoNewCard}}, due}}
+}
@@ -0,0 +1,207 @@
+package fb
+
+import (
+	"encoding/json"
+	"regexp"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func mangoContext() *MangoContext {
+	th := &Theme{ID: "theme-VGVzdCBUaGVtZQ"}
+	th.Models = []*Model{
+		{Theme: th, ID: 0, Name: "Basic", Fields: []*Field{{Name: "Front"}, {Name: "Back"}}},
+		{Theme: th, ID: 1, Name: "Basic (reversed)", Fields: []*Field{{Name: "Back"}, {Name: "Front"}}},
+	}
+	return &MangoContext{
+		Decks: []*Deck{
+			{ID: "deck-AQ", Name: "Spanish"},
+			{ID: "deck-Ag", Name: "Verbs", ParentID: "deck-AQ"},
+			{ID: "deck-Aw", Name: "French"},
+		},
+		Themes: []*Theme{th},
+	}
+}
+
+func TestCardSelector(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+		err      string
+	}{
+		{query: "", expected: `{"type":"card"}`},
+		{
+			query:    "deck:spanish -deck:french",
+			expected: `{"$and":[{"type":"card"},{"$and":[{"deck":{"$in":["deck-AQ","deck-Ag"]}},{"$nor":[{"deck":{"$in":["deck-Aw"]}}]}]}]}`,
+		},
+		{
+			query:    "deck:*::verbs",
+			expected: `{"$and":[{"type":"card"},{"deck":{"$in":["deck-Ag"]}}]}`,
+		},
+		{
+			query:    "model:basic or deck:german",
+			expected: `{"$and":[{"type":"card"},{"$or":[{"model":{"$in":["theme-VGVzdCBUaGVtZQ/0"]}},{"deck":{"$in":[]}}]}]}`,
+		},
+		{
+			query:    "is:suspended",
+			expected: `{"$and":[{"type":"card"},{"suspended":true}]}`,
+		},
+		{
+			query:    "is:buried",
+			expected: `{"$and":[{"type":"card"},{"buriedUntil":{"$gt":"2017-01-01"}}]}`,
+		},
+		{
+			query:    "is:learn",
+			expected: `{"$and":[{"type":"card"},{"state":{"$in":["learning","relearning"]}}]}`,
+		},
+		{
+			query: "is:new",
+			expected: `{"$and":[{"type":"card"},{"state":{"$exists":false},"$or":[
+				{"interval":{"$exists":false}},{"interval":{"$lte":0}}]}]}`,
+		},
+		{
+			query: "is:due",
+			expected: `{"$and":[{"type":"card"},{"$and":[
+				{"$or":[{"state":{"$in":["learning","review","relearning"]}},{"state":{"$exists":false},"interval":{"$gt":0}}]},
+				{"due":{"$lte":"2017-01-01"}},
+				{"$nor":[{"suspended":true},{"buriedUntil":{"$gt":"2017-01-01"}}]}
+			]}]}`,
+		},
+		{
+			query:    "prop:ivl>30",
+			expected: `{"$and":[{"type":"card"},{"interval":{"$gt":30}}]}`,
+		},
+		{
+			query: "prop:lapses<2",
+			expected: `{"$and":[{"type":"card"},{"$or":[
+				{"lapseCount":{"$gt":0,"$lt":2}},{"lapseCount":{"$exists":false}},{"lapseCount":{"$lte":0}}]}]}`,
+		},
+		{
+			query: "prop:due=1",
+			expected: `{"$and":[{"type":"card"},{"$and":[
+				{"$nor":[{"state":{"$exists":false},"$or":[{"interval":{"$exists":false}},{"interval":{"$lte":0}}]}]},
+				{"due":{"$gte":"2017-01-02","$lt":"2017-01-03"}}]}]}`,
+		},
+		{
+			query: "prop:due!=-1",
+			expected: `{"$and":[{"type":"card"},{"$and":[
+				{"$nor":[{"state":{"$exists":false},"$or":[{"interval":{"$exists":false}},{"interval":{"$lte":0}}]}]},
+				{"$or":[{"due":{"$lt":"2016-12-31"}},{"due":{"$gte":"2017-01-01"}}]}]}]}`,
+		},
+		{query: "dog", err: "'dog' cannot be used in a card selector"},
+		{query: "is:new -tag:verbs", err: "'tag:verbs' cannot be used in a card selector"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := q.CardSelector(mangoContext())
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.AsJSON(json.RawMessage(test.expected), result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestNoteSelector(t *testing.T) {
+	tests := []struct {
+		query    string
+		ctx      *MangoContext
+		expected string
+		err      string
+	}{
+		{query: "", expected: `{"type":"note"}`},
+		{
+			query:    "dog",
+			expected: `{"$and":[{"type":"note"},{"fieldValues":{"$elemMatch":{"text":{"$regex":"[dD][oO][gG]"}}}}]}`,
+		},
+		{
+			query:    "tag:verbs",
+			expected: `{"$and":[{"type":"note"},{"tags":{"$elemMatch":{"$regex":"^[vV][eE][rR][bB][sS]$|^[vV][eE][rR][bB][sS]::[\\s\\S]*$"}}}]}`,
+		},
+		{
+			query:    "model:basic*",
+			expected: `{"$and":[{"type":"note"},{"$or":[{"theme":"theme-VGVzdCBUaGVtZQ","model":0},{"theme":"theme-VGVzdCBUaGVtZQ","model":1}]}]}`,
+		},
+		{
+			query: "front:dog",
+			expected: `{"$and":[{"type":"note"},{"$or":[
+				{"theme":"theme-VGVzdCBUaGVtZQ","model":0,"fieldValues.0.text":{"$regex":"^[dD][oO][gG]$"}},
+				{"theme":"theme-VGVzdCBUaGVtZQ","model":1,"fieldValues.1.text":{"$regex":"^[dD][oO][gG]$"}}]}]}`,
+		},
+		{query: "side:dog", err: "no model has a field named 'side'"},
+		{query: "front:dog", ctx: &MangoContext{}, err: "no model has a field named 'front'"},
+		{query: "dog or is:due", err: "'is:due' cannot be used in a note selector"},
+		{query: "deck:spanish", err: "'deck:spanish' cannot be used in a note selector"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := test.ctx
+			if ctx == nil {
+				ctx = mangoContext()
+			}
+			result, err := q.NoteSelector(ctx)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.AsJSON(json.RawMessage(test.expected), result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestMangoPattern(t *testing.T) {
+	tests := []struct {
+		query string
+		text  string
+	}{
+		{query: "Dog", text: "the DOG"},
+		{query: "d*g", text: "D\nG"},
+		{query: "niño", text: "NIÑO"},
+		{query: "a.b", text: "axb"},
+		{query: "tag:spanish", text: "Spanish::Nouns"},
+		{query: "front:el*", text: "El perro"},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			term := q.Root.(*SearchTerm)
+			re := regexp.MustCompile(mangoRegex(term))
+			if expected, result := term.pattern.MatchString(test.text), re.MatchString(test.text); result != expected {
+				t.Errorf("Expected %t, got %t for %s", expected, result, re)
+			}
+		})
+	}
+}
+
+func TestSelectorDecksUnchanged(t *testing.T) {
+	ctx := mangoContext()
+	q, err := ParseSearch("deck:spanish::verbs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.CardSelector(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range ctx.Decks {
+		if d.Parent != nil {
+			t.Errorf("Deck '%s' was linked to its parent", d.ID)
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package fb
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MergeConflict describes a field which was changed differently in both
+// versions of a three-way merge. The merged document holds the local value.
+// Values are JSON-encoded, and empty if the field is absent from that version.
+type MergeConflict struct {
+	// Path locates the field, in the form used by Problem.Path.
+	Path   string          `json:"path"`
+	Base   json.RawMessage `json:"base,omitempty"`
+	Local  json.RawMessage `json:"local,omitempty"`
+	Remote json.RawMessage `json:"remote,omitempty"`
+}
+
+// Merge3 merges the changes made to base in the bundle and in remote. See
+// merge3 for details.
+func (b *Bundle) Merge3(base, remote *Bundle) (*Bundle, []*MergeConflict, error) {
+	merged := &Bundle{}
+	conflicts, err := merge3(base, b, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// Merge3 merges the changes made to base in the card and in remote. See
+// merge3 for details.
+func (c *Card) Merge3(base, remote *Card) (*Card, []*MergeConflict, error) {
+	merged := &Card{}
+	conflicts, err := merge3(base, c, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// Merge3 merges the changes made to base in the deck and in remote. See
+// merge3 for details.
+func (d *Deck) Merge3(base, remote *Deck) (*Deck, []*MergeConflict, error) {
+	merged := &Deck{}
+	conflicts, err := merge3(base, d, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// Merge3 merges the changes made to base in the deck config and in remote.
+// See merge3 for details.
+func (dc *DeckConfig) Merge3(base, remote *DeckConfig) (*DeckConfig, []*MergeConflict, error) {
+	merged := &DeckConfig{}
+	conflicts, err := merge3(base, dc, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// Merge3 merges the changes made to base in the note and in remote. Each
+// field value and attachment is merged separately, so that edits to
+// different fields of the note do not conflict. The merged note is assigned
+// the model of the local note. See merge3 for details.
+func (n *Note) Merge3(base, remote *Note) (*Note, []*MergeConflict, error) {
+	merged := &Note{}
+	conflicts, err := merge3(base, n, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n.Model != nil {
+		if err := merged.SetModel(n.Model); err != nil {
+			return nil, nil, errors.Wrap(err, "merged note")
+		}
+	}
+	return merged, conflicts, nil
+}
+
+// Merge3 merges the changes made to base in the theme and in remote. Models
+// and attachments are merged separately. See merge3 for details.
+func (t *Theme) Merge3(base, remote *Theme) (*Theme, []*MergeConflict, error) {
+	merged := &Theme{}
+	conflicts, err := merge3(base, t, remote, merged)
+	if err != nil {
+		return nil, nil, err
+	}
+	return merged, conflicts, nil
+}
+
+// merge3 performs a field-level three-way merge of local and remote, two
+// versions of the document base, into merged. The documents are compared by
+// their JSON representations:
+//
+//   - A field changed in only one version takes the changed value.
+//   - Objects changed in both versions are merged key by key, and arrays of
+//     equal length element by element.
+//   - Sets of strings, such as tags, are merged as sets, so that additions
+//     and removals made in both versions are kept. Other arrays, such as card
+//     lists, are merged as whole values.
+//   - Any other field changed differently in both versions is a conflict. The
+//     merged document keeps the local value.
+//
+// The merged document takes the revision of the local document, and the later
+// of the two modification times.
+func merge3(base, local, remote, merged interface{}) ([]*MergeConflict, error) {
+	var docs [3]map[string]interface{}
+	for i, doc := range []interface{}{base, local, remote} {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if err := dec.Decode(&docs[i]); err != nil {
+			return nil, err
+		}
+	}
+	b, l, r := docs[0], docs[1], docs[2]
+	if !reflect.DeepEqual(b["_id"], l["_id"]) || !reflect.DeepEqual(b["_id"], r["_id"]) {
+		return nil, errors.New("IDs don't match")
+	}
+	rev, hasRev := l["_rev"]
+	modified := l["modified"]
+	if later(r["modified"], modified) {
+		modified = r["modified"]
+	}
+	for _, doc := range docs {
+		delete(doc, "_rev")
+		delete(doc, "modified")
+	}
+	m := &merger{}
+	result := m.merge("", b, l, r).(map[string]interface{})
+	if hasRev {
+		result["_rev"] = rev
+	}
+	result["modified"] = modified
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, merged); err != nil {
+		return nil, errors.Wrap(err, "merged document is invalid")
+	}
+	return m.conflicts, nil
+}
+
+// later returns true if a is a later timestamp than b.
+func later(a, b interface{}) bool {
+	as, _ := a.(string)
+	bs, _ := b.(string)
+	at, _ := time.Parse(time.RFC3339Nano, as)
+	bt, _ := time.Parse(time.RFC3339Nano, bs)
+	return at.After(bt)
+}
+
+// absent stands for a key missing from one version of an object.
+type absent struct{}
+
+// setPaths holds the paths of the arrays which are merged as sets. Other
+// arrays are ordered, or are not merely collections of distinct values.
+var setPaths = map[string]struct{}{
+	"tags": {},
+}
+
+type merger struct {
+	conflicts []*MergeConflict
+}
+
+func (m *merger) merge(path string, base, local, remote interface{}) interface{} {
+	switch {
+	case reflect.DeepEqual(local, remote):
+		return local
+	case reflect.DeepEqual(base, local):
+		return remote
+	case reflect.DeepEqual(base, remote):
+		return local
+	}
+	if lm, ok := local.(map[string]interface{}); ok {
+		if rm, ok := remote.(map[string]interface{}); ok {
+			bm, _ := base.(map[string]interface{})
+			return m.mergeObjects(path, bm, lm, rm)
+		}
+	}
+	if la, ok := local.([]interface{}); ok {
+		if ra, ok := remote.([]interface{}); ok {
+			ba, _ := base.([]interface{})
+			if _, isSet := setPaths[path]; isSet {
+				if ls, rs, bs, ok := stringSets(la, ra, ba); ok {
+					return mergeSets(bs, ls, rs)
+				}
+			}
+			if len(la) == len(ra) && len(la) == len(ba) {
+				result := make([]interface{}, len(la))
+				for i := range la {
+					result[i] = m.merge(path+"["+strconv.Itoa(i)+"]", ba[i], la[i], ra[i])
+				}
+				return result
+			}
+		}
+	}
+	m.conflicts = append(m.conflicts, &MergeConflict{
+		Path:   path,
+		Base:   rawValue(base),
+		Local:  rawValue(local),
+		Remote: rawValue(remote),
+	})
+	return local
+}
+
+func (m *merger) mergeObjects(path string, base, local, remote map[string]interface{}) map[string]interface{} {
+	keys := make(map[string]struct{})
+	for _, obj := range []map[string]interface{}{base, local, remote} {
+		for k := range obj {
+			keys[k] = struct{}{}
+		}
+	}
+	names := make([]string, 0, len(keys))
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	result := make(map[string]interface{}, len(names))
+	value := func(obj map[string]interface{}, k string) interface{} {
+		if v, ok := obj[k]; ok {
+			return v
+		}
+		return absent{}
+	}
+	for _, k := range names {
+		v := m.merge(joinPath(path, k), value(base, k), value(local, k), value(remote, k))
+		if _, ok := v.(absent); !ok {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+func rawValue(v interface{}) json.RawMessage {
+	if _, ok := v.(absent); ok {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
+
+// stringSets returns the arrays as sets, if they all hold only strings. A nil
+// base is treated as empty.
+func stringSets(local, remote, base []interface{}) (l, r, b map[string]struct{}, ok bool) {
+	sets := make([]map[string]struct{}, 3)
+	for i, a := range [][]interface{}{local, remote, base} {
+		sets[i] = make(map[string]struct{}, len(a))
+		for _, v := range a {
+			s, ok := v.(string)
+			if !ok {
+				return nil, nil, nil, false
+			}
+			sets[i][s] = struct{}{}
+		}
+	}
+	return sets[0], sets[1], sets[2], true
+}
+
+// mergeSets returns the elements of base, with the additions and removals of
+// both local and remote applied, in sorted order.
+func mergeSets(base, local, remote map[string]struct{}) []interface{} {
+	result := make([]string, 0, len(local)+len(remote))
+	for s := range base {
+		_, inLocal := local[s]
+		_, inRemote := remote[s]
+		if inLocal && inRemote {
+			result = append(result, s)
+		}
+	}
+	for _, added := range []map[string]struct{}{local, remote} {
+		for s := range added {
+			if _, ok := base[s]; ok {
+				continue
+			}
+			result = append(result, s)
+		}
+	}
+	sort.Strings(result)
+	merged := make([]interface{}, 0, len(result))
+	for i, s := range result {
+		if i > 0 && s == result[i-1] {
+			continue
+		}
+		merged = append(merged, s)
+	}
+	return merged
+}
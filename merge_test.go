@@ -0,0 +1,193 @@
+package fb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestCardMerge3(t *testing.T) {
+	const base = `{"_id":"card-YmFy.bmlsCg.0", "_rev":"1-a", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-10", "interval":10}`
+	tests := []struct {
+		name      string
+		base      string
+		local     string
+		remote    string
+		expected  string
+		conflicts string
+		err       string
+	}{
+		{
+			name:   "ID mismatch",
+			base:   base,
+			local:  base,
+			remote: `{"_id":"card-YmFy.bmlsCg.1", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "model":"theme-abcd/0"}`,
+			err:    "IDs don't match",
+		},
+		{
+			name:     "unchanged",
+			base:     base,
+			local:    base,
+			remote:   base,
+			expected: `{"_id":"card-YmFy.bmlsCg.0", "_rev":"1-a", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-10", "interval":10}`,
+		},
+		{
+			name:     "different fields changed",
+			base:     base,
+			local:    `{"_id":"card-YmFy.bmlsCg.0", "_rev":"2-b", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-03T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-10", "interval":10, "suspended":true}`,
+			remote:   `{"_id":"card-YmFy.bmlsCg.0", "_rev":"2-c", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-02T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-10", "interval":10, "deck":"deck-ZGVjaw"}`,
+			expected: `{"_id":"card-YmFy.bmlsCg.0", "_rev":"2-b", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-03T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-10", "interval":10, "suspended":true, "deck":"deck-ZGVjaw"}`,
+		},
+		{
+			name:      "conflict",
+			base:      base,
+			local:     `{"_id":"card-YmFy.bmlsCg.0", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-02T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-20", "interval":20}`,
+			remote:    `{"_id":"card-YmFy.bmlsCg.0", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-03T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-15", "interval":10}`,
+			expected:  `{"_id":"card-YmFy.bmlsCg.0", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-03T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-20", "interval":20}`,
+			conflicts: `[{"path":"due", "base":"2017-01-10", "local":"2017-01-20", "remote":"2017-01-15"}]`,
+		},
+		{
+			name:      "removed and changed",
+			base:      base,
+			local:     `{"_id":"card-YmFy.bmlsCg.0", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-02T00:00:00Z", "model":"theme-abcd/0", "interval":10}`,
+			remote:    `{"_id":"card-YmFy.bmlsCg.0", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-02T00:00:00Z", "model":"theme-abcd/0", "due":"2017-01-15", "interval":10}`,
+			expected:  `{"_id":"card-YmFy.bmlsCg.0", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-02T00:00:00Z", "model":"theme-abcd/0", "interval":10}`,
+			conflicts: `[{"path":"due", "base":"2017-01-10", "remote":"2017-01-15"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var base, local, remote Card
+			for _, x := range []struct {
+				src  string
+				card *Card
+			}{{test.base, &base}, {test.local, &local}, {test.remote, &remote}} {
+				if err := json.Unmarshal([]byte(x.src), x.card); err != nil {
+					t.Fatal(err)
+				}
+			}
+			result, conflicts, err := local.Merge3(&base, &remote)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.AsJSON(json.RawMessage(test.expected), result); d != nil {
+				t.Error(d)
+			}
+			if test.conflicts == "" {
+				test.conflicts = "null"
+			}
+			if d := diff.AsJSON(json.RawMessage(test.conflicts), conflicts); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestDeckMerge3(t *testing.T) {
+	deck := func(name string, cards ...string) *Deck {
+		d, _ := NewDeck("deck-ZGVjaw")
+		d.Name = name
+		for _, c := range cards {
+			d.AddCard(c)
+		}
+		return d
+	}
+	base := deck("Foo", "card-YmFy.bmlsCg.0", "card-YmFy.bmlsCg.1")
+	local := deck("Bar", "card-YmFy.bmlsCg.0", "card-YmFy.bmlsCg.1", "card-YmFy.bmlsCg.2")
+	remote := deck("Foo", "card-YmFy.bmlsCg.1", "card-YmFy.bmlsCg.3")
+	result, conflicts, err := local.Merge3(base, remote)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := deck("Bar", "card-YmFy.bmlsCg.0", "card-YmFy.bmlsCg.1", "card-YmFy.bmlsCg.2")
+	if d := diff.AsJSON(expected, result); d != nil {
+		t.Error(d)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "cards" {
+		t.Errorf("Unexpected conflicts: %v", conflicts)
+	}
+}
+
+func TestFilteredDeckMerge3(t *testing.T) {
+	deck := func(cards ...string) *FilteredDeck {
+		fd, _ := NewFilteredDeck("fdeck-ZGVjaw", "is:due")
+		fd.Cards = cards
+		return fd
+	}
+	base := deck("card-YmFy.bmlsCg.0", "card-YmFy.bmlsCg.1")
+	local := deck("card-YmFy.bmlsCg.1", "card-YmFy.bmlsCg.0")
+	remote := deck("card-YmFy.bmlsCg.2", "card-YmFy.bmlsCg.1", "card-YmFy.bmlsCg.0")
+	result := &FilteredDeck{}
+	conflicts, err := merge3(base, local, remote, result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The study order of the local version is kept
+	if d := diff.AsJSON(local, result); d != nil {
+		t.Error(d)
+	}
+	if len(conflicts) != 1 || conflicts[0].Path != "cards" {
+		t.Errorf("Unexpected conflicts: %v", conflicts)
+	}
+}
+
+func TestNoteMerge3(t *testing.T) {
+	theme, _ := NewTheme("theme-abcd")
+	model, _ := theme.NewModel("foo")
+	_ = model.AddField(TextField, "Front")
+	_ = model.AddField(TextField, "Back")
+	note := func(front, back string) *Note {
+		n, _ := NewNote("note-Zm9v", model)
+		n.FieldValues = []*FieldValue{{Text: front}, {Text: back}}
+		return n
+	}
+	base := note("front", "back")
+
+	t.Run("different fields", func(t *testing.T) {
+		result, conflicts, err := note("new front", "back").Merge3(base, note("front", "new back"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(note("new front", "new back"), result); d != nil {
+			t.Error(d)
+		}
+		if len(conflicts) != 0 {
+			t.Errorf("Unexpected conflicts: %v", conflicts)
+		}
+		if result.Model != model {
+			t.Errorf("Model not assigned")
+		}
+	})
+	t.Run("tags", func(t *testing.T) {
+		tagged := func(tags ...string) *Note {
+			n := note("front", "back")
+			n.AddTags(tags...)
+			return n
+		}
+		result, conflicts, err := tagged("foo", "bar", "baz").Merge3(tagged("foo", "bar"), tagged("bar", "qux"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(tagged("bar", "baz", "qux"), result); d != nil {
+			t.Error(d)
+		}
+		if len(conflicts) != 0 {
+			t.Errorf("Unexpected conflicts: %v", conflicts)
+		}
+	})
+	t.Run("same field", func(t *testing.T) {
+		result, conflicts, err := note("local front", "back").Merge3(base, note("remote front", "back"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(note("local front", "back"), result); d != nil {
+			t.Error(d)
+		}
+		expected := `[{"path":"fieldValues[0].text", "base":"front", "local":"local front", "remote":"remote front"}]`
+		if d := diff.AsJSON(json.RawMessage(expected), conflicts); d != nil {
+			t.Error(d)
+		}
+	})
+}
@@ -0,0 +1,161 @@
+package fb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// MigrationReport describes the changes made while upgrading a package from
+// an older format version.
+type MigrationReport struct {
+	// From is the version of the package as read.
+	From int
+	// To is the version the package was upgraded to, always CurrentVersion.
+	To int
+	// Changes holds a description of each change made, in order.
+	Changes []string
+}
+
+// Migrated returns true if the package was read from an older version.
+func (r *MigrationReport) Migrated() bool {
+	return r.From != r.To
+}
+
+// rawDoc is a JSON object, with its values left undecoded, so that a
+// migration may change some keys without disturbing the others.
+type rawDoc map[string]json.RawMessage
+
+// migration upgrades a raw package from one version to the next, returning a
+// description of each change made.
+type migration func(doc rawDoc) ([]string, error)
+
+// migrations holds the upgrade from each version to the next, keyed by the
+// version it upgrades from. There must be one for every version from
+// LowestVersion to CurrentVersion-1. As PackageReader upgrades packages one
+// document at a time, each must change only single documents, in a way also
+// made as those documents are decoded.
+var migrations = map[int]migration{
+	1: migrateV1,
+	2: migrateV2,
+}
+
+// Migrate reads the JSON-encoded package in data into p, first upgrading it
+// from an older format version if necessary, and returns a report of the
+// changes made in doing so.
+func (p *Package) Migrate(data []byte) (*MigrationReport, error) {
+	data, report, err := migratePackage(data)
+	if err != nil {
+		return nil, err
+	}
+	doc := &jsonPackage{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	*p = Package(doc.packageAlias)
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// migratePackage upgrades the JSON-encoded package in data to CurrentVersion.
+func migratePackage(data []byte) ([]byte, *MigrationReport, error) {
+	header := struct {
+		Version int `json:"version"`
+	}{}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, nil, err
+	}
+	if err := checkVersion(header.Version); err != nil {
+		return nil, nil, err
+	}
+	report := &MigrationReport{From: header.Version, To: CurrentVersion}
+	if !report.Migrated() {
+		return data, report, nil
+	}
+	var doc rawDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, nil, err
+	}
+	for v := header.Version; v < CurrentVersion; v++ {
+		changes, err := migrations[v](doc)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "migration from version %d", v)
+		}
+		report.Changes = append(report.Changes, changes...)
+	}
+	doc["version"] = json.RawMessage(strconv.Itoa(CurrentVersion))
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, report, nil
+}
+
+// checkVersion returns an error if packages of version v cannot be read.
+func checkVersion(v int) error {
+	if v < LowestVersion {
+		return errors.Errorf("package version %d < %d", v, LowestVersion)
+	}
+	if v > CurrentVersion {
+		return errors.Errorf("package version %d is newer than the supported version %d", v, CurrentVersion)
+	}
+	return nil
+}
+
+// migrateV1 upgrades a version 1 package. Version 1 packages were always read
+// as version 2 packages, without change, so there is nothing to change.
+func migrateV1(_ rawDoc) ([]string, error) {
+	return nil, nil
+}
+
+// migrateV2 upgrades a version 2 package, by moving the question and answer
+// HTML of each model template, formerly stored as theme attachments, into the
+// template definition itself. See Model.migrateTemplates.
+func migrateV2(doc rawDoc) ([]string, error) {
+	var themes []json.RawMessage
+	if err := unmarshalRaw(doc, "themes", &themes); err != nil {
+		return nil, err
+	}
+	var changes []string
+	for i, raw := range themes {
+		t := &Theme{}
+		themeChanges, err := t.unmarshal(raw)
+		if err != nil || len(themeChanges) == 0 {
+			// Invalid themes are left to be reported as the package is read.
+			continue
+		}
+		if themes[i], err = json.Marshal(t); err != nil {
+			return nil, err
+		}
+		for _, change := range themeChanges {
+			changes = append(changes, fmt.Sprintf("theme '%s': %s", t.ID, change))
+		}
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+	return changes, marshalRaw(doc, "themes", themes)
+}
+
+// unmarshalRaw decodes the value of key into v, if it exists.
+func unmarshalRaw(doc rawDoc, key string, v interface{}) error {
+	raw, ok := doc[key]
+	if !ok {
+		return nil
+	}
+	return errors.Wrapf(json.Unmarshal(raw, v), "invalid %s", key)
+}
+
+// marshalRaw replaces the value of key with the encoding of v.
+func marshalRaw(doc rawDoc, key string, v interface{}) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	doc[key] = raw
+	return nil
+}
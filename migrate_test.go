@@ -0,0 +1,117 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestPkgMigrate(t *testing.T) {
+	const theme = `"_id":"theme-abcd", "type":"theme", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "modelSequence":1, "files":[]`
+	tests := []struct {
+		name     string
+		input    string
+		expected *MigrationReport
+		check    func(*testing.T, *Package)
+		err      string
+	}{
+		{
+			name:  "invalid json",
+			input: "invalid json",
+			err:   "invalid character 'i' looking for beginning of value",
+		},
+		{
+			name:  "too old",
+			input: `{"version":0}`,
+			err:   "package version 0 < 1",
+		},
+		{
+			name:  "too new",
+			input: `{"version":4}`,
+			err:   "package version 4 is newer than the supported version 3",
+		},
+		{
+			name:     "current",
+			input:    `{"version":3, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z"}`,
+			expected: &MigrationReport{From: 3, To: 3},
+		},
+		{
+			name:     "version 1, nothing to change",
+			input:    `{"version":1, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "reviews":[{"cardID":"card-YmFy.bmlsCg.0", "timestamp":"2017-01-01T00:00:00Z"}]}`,
+			expected: &MigrationReport{From: 1, To: 3},
+		},
+		{
+			name: "legacy template without files",
+			input: `{"version":2, "themes":[{` + theme + `, "_attachments":{},
+				"models":[{"id":0, "modelType":"foo", "files":[], "templates":["Card 1"]}]}]}`,
+			expected: &MigrationReport{
+				From: 2,
+				To:   3,
+				Changes: []string{
+					"theme 'theme-abcd': model 0: template 'Card 1' question not found, left empty",
+					"theme 'theme-abcd': model 0: template 'Card 1' answer not found, left empty",
+				},
+			},
+			check: func(t *testing.T, p *Package) {
+				if d := diff.Interface([]*Template{{Name: "Card 1"}}, p.Themes[0].Models[0].Templates); d != nil {
+					t.Error(d)
+				}
+			},
+		},
+		{
+			name: "invalid theme",
+			input: `{"version":2, "themes":[{` + theme + `,
+				"models":[{"id":0, "modelType":"foo", "files":[], "templates":["Card 1"]}]}]}`,
+			err: "invalid theme: no attachments",
+		},
+		{
+			name: "legacy templates",
+			input: `{"version":2, "themes":[{` + theme + `,
+				"_attachments":{
+					"Card 1.question.html": {"content_type":"text/html", "data":"e3tGcm9udH19"},
+					"Card 1.answer.html": {"content_type":"text/html", "data":"e3tCYWNrfX0="},
+					"foo.png": {"content_type":"image/png", "data":"cG5n"}
+				},
+				"models":[{"id":0, "modelType":"foo", "files":["Card 1.answer.html", "Card 1.question.html", "foo.png"], "templates":["Card 1"]}]}]}`,
+			expected: &MigrationReport{
+				From:    2,
+				To:      3,
+				Changes: []string{"theme 'theme-abcd': model 0: moved template 'Card 1' into model"},
+			},
+			check: func(t *testing.T, p *Package) {
+				m := p.Themes[0].Models[0]
+				if d := diff.Interface([]*Template{{Name: "Card 1", Question: "{{Front}}", Answer: "{{Back}}"}}, m.Templates); d != nil {
+					t.Error(d)
+				}
+				if d := diff.Interface([]string{"foo.png"}, m.Files.FileList()); d != nil {
+					t.Error(d)
+				}
+				if d := diff.Interface([]string{"foo.png"}, p.Themes[0].Attachments.FileList()); d != nil {
+					t.Error(d)
+				}
+			},
+		},
+		{
+			name: "current templates in old version",
+			input: `{"version":2, "themes":[{` + theme + `, "_attachments":{},
+				"models":[{"id":0, "modelType":"foo", "files":[], "templates":[{"name":"Card 1", "question":"{{Front}}", "answer":"{{Back}}"}]}]}]}`,
+			expected: &MigrationReport{From: 2, To: 3},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := &Package{}
+			report, err := p.Migrate([]byte(test.input))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, report); d != nil {
+				t.Error(d)
+			}
+			if test.check != nil {
+				test.check(t, p)
+			}
+		})
+	}
+}
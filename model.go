@@ -1,8 +1,11 @@
 package fb
 
 import (
-	"errors"
+	"encoding/json"
+	"fmt"
 	"strconv"
+
+	"github.com/pkg/errors"
 )
 
 // Model represents a Flashback card Model
@@ -12,34 +15,162 @@ type Model struct {
 	Type        string `json:"modelType"`
 	Name        string `json:"name,omitempty"`
 	Description string `json:"description,omitempty"`
-	// Templates are analogous to anki Card definitions. This field just holds the name of each template.
-	Templates []string            `json:"templates"`
+	// Templates are analogous to anki Card definitions. Each template produces
+	// one card per note, except in cloze models.
+	Templates []*Template         `json:"templates"`
 	Fields    []*Field            `json:"fields"`
 	Files     *FileCollectionView `json:"files,omitempty"`
+	// SortField is the index of the field which identifies a note of the
+	// model, used to sort notes and to detect duplicates. See Note.SortField.
+	SortField int `json:"sortField,omitempty"`
+
+	// legacyTemplates is set when the templates were read from the old form,
+	// which held only their names. See migrateTemplates.
+	legacyTemplates bool
+}
+
+// Template defines the question and answer HTML of one card type of a model.
+type Template struct {
+	Name     string `json:"name"`
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	// BrowserQuestion and BrowserAnswer optionally override the question and
+	// answer when the card is displayed in a card list, rather than studied.
+	BrowserQuestion string `json:"browserQuestion,omitempty"`
+	BrowserAnswer   string `json:"browserAnswer,omitempty"`
+}
+
+// Validate validates that the template appears valid. A nil return value
+// means no errors were detected.
+func (t *Template) Validate() error {
+	v := newReporter()
+	t.validate(v)
+	return v.report.Err()
+}
+
+func (t *Template) validate(v *reporter) {
+	if t.Name == "" {
+		v.errorf("name", ProblemRequired, "name is required")
+	}
 }
 
 // Validate validates that all of the data in the theme appears valid and self
 // consistent. A nil return value means no errors were detected.
 func (m *Model) Validate() error {
+	v := newReporter()
+	m.validate(v)
+	return v.report.Err()
+}
+
+func (m *Model) validate(v *reporter) {
 	if m.Theme == nil {
-		return errors.New("theme is required")
+		v.errorf("", ProblemRequired, "theme is required")
 	}
 	if m.Type == "" {
-		return errors.New("type is required")
+		v.errorf("modelType", ProblemRequired, "type is required")
 	}
 	if m.Files == nil {
-		return errors.New("file list must not be nil")
+		v.errorf("files", ProblemRequired, "file list must not be nil")
+	}
+	if m.Theme != nil && m.Theme.Attachments == nil {
+		v.errorf("", ProblemInconsistent, "invalid theme")
+	}
+	if m.SortField < 0 || (m.SortField > 0 && m.SortField >= len(m.Fields)) {
+		v.errorf("sortField", ProblemInvalidValue, "sort field %d out of range", m.SortField)
+	}
+	names := make(map[string]struct{}, len(m.Templates))
+	for i, t := range m.Templates {
+		tv := v.atIndex("templates", i)
+		if t == nil {
+			tv.errorf("", ProblemRequired, "template %d is nil", i)
+			continue
+		}
+		t.validate(tv.wrap("invalid template %d", i))
+		if _, ok := names[t.Name]; ok && t.Name != "" {
+			tv.errorf("name", ProblemDuplicate, "duplicate template name '%s'", t.Name)
+		}
+		names[t.Name] = struct{}{}
+	}
+}
+
+type modelAlias Model
+
+// UnmarshalJSON implements the json.Unmarshaler interface for the Model type.
+// Templates may be in either the current form, or the old form of a list of
+// template names. The latter are migrated by the parent theme, once the model
+// files are available.
+func (m *Model) UnmarshalJSON(data []byte) error {
+	doc := struct {
+		*modelAlias
+		Templates []json.RawMessage `json:"templates"`
+	}{
+		modelAlias: (*modelAlias)(m),
 	}
-	if m.Theme.Attachments == nil {
-		return errors.New("invalid theme")
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	m.Templates = nil
+	if doc.Templates == nil {
+		return nil
+	}
+	m.Templates = make([]*Template, len(doc.Templates))
+	for i, raw := range doc.Templates {
+		var name string
+		if err := json.Unmarshal(raw, &name); err == nil {
+			m.Templates[i] = &Template{Name: name}
+			m.legacyTemplates = true
+			continue
+		}
+		t := &Template{}
+		if err := json.Unmarshal(raw, t); err != nil {
+			return errors.Wrapf(err, "invalid template %d", i)
+		}
+		m.Templates[i] = t
 	}
 	return nil
 }
 
+// migrateTemplates moves the question and answer HTML of templates read in the
+// old form, which was stored in model files, into the templates themselves,
+// and returns a description of each change made. Templates stored before the
+// HTML was kept in model files have no such files, and are left empty.
+func (m *Model) migrateTemplates() []string {
+	if !m.legacyTemplates {
+		return nil
+	}
+	var changes []string
+	for _, t := range m.Templates {
+		var moved bool
+		qFile, aFile := templateFiles(t.Name)
+		for _, f := range []struct {
+			name, side string
+			html       *string
+		}{
+			{qFile, "question", &t.Question},
+			{aFile, "answer", &t.Answer},
+		} {
+			att, ok := m.Files.GetFile(f.name)
+			if !ok {
+				changes = append(changes, fmt.Sprintf("template '%s' %s not found, left empty", t.Name, f.side))
+				continue
+			}
+			*f.html = string(att.Content)
+			_ = m.Files.RemoveFile(f.name)
+			moved = true
+		}
+		if moved {
+			changes = append(changes, fmt.Sprintf("moved template '%s' into model", t.Name))
+		}
+	}
+	m.legacyTemplates = false
+	return changes
+}
+
 const (
 	// AnkiStandardModel is a Basic Anki note
 	AnkiStandardModel = "anki-basic"
-	// AnkiClozeModel is an Anki Cloze note. Not yet implemented.
+	// AnkiClozeModel is an Anki Cloze note, which generates one card per cloze
+	// deletion. See ParseClozes.
 	AnkiClozeModel = "anki-cloze"
 )
 
@@ -56,7 +187,7 @@ func NewModel(t *Theme, modelType string) (*Model, error) {
 		Theme:     t,
 		ID:        t.NextModelSequence(),
 		Type:      modelType,
-		Templates: make([]string, 0, 1),
+		Templates: make([]*Template, 0, 1),
 		Fields:    make([]*Field, 0, 1),
 		Files:     t.Attachments.NewView(),
 	}, nil
@@ -76,6 +207,41 @@ func (m *Model) Identity() string {
 	return ""
 }
 
+// AddTemplate adds a template of the provided name, question and answer HTML
+// to the model, and returns it, so that optional settings may be changed.
+func (m *Model) AddTemplate(name, question, answer string) (*Template, error) {
+	if name == "" {
+		return nil, errors.New("template name is required")
+	}
+	if m.Template(name) != nil {
+		return nil, errors.Errorf("template '%s' already exists", name)
+	}
+	t := &Template{
+		Name:     name,
+		Question: question,
+		Answer:   answer,
+	}
+	m.Templates = append(m.Templates, t)
+	return t, nil
+}
+
+// Template returns the named template, or nil if it does not exist.
+func (m *Model) Template(name string) *Template {
+	for _, t := range m.Templates {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// templateFiles returns the names of the attachments which held the question
+// and answer HTML of the named template, before templates were stored in the
+// model itself.
+func templateFiles(name string) (question, answer string) {
+	return name + ".question.html", name + ".answer.html"
+}
+
 // AddField adds a field of the specified type and name to the Model.
 func (m *Model) AddField(fType FieldType, name string) error {
 	if fType > AnkiField {
@@ -38,7 +38,7 @@ func TestNewModel(t *testing.T) {
 				theme.ModelSequence = 1
 				model := &Model{
 					Type:      "foo",
-					Templates: []string{},
+					Templates: []*Template{},
 					Fields:    []*Field{},
 					Files:     theme.Attachments.NewView(),
 					Theme:     theme,
@@ -83,11 +83,48 @@ func TestModelValidate(t *testing.T) {
 			v:    &Model{Theme: &Theme{}, Type: "foo", Files: NewFileCollection().NewView()},
 			err:  "invalid theme",
 		},
+		{
+			name: "nil template",
+			v: func() *Model {
+				att := NewFileCollection()
+				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView(),
+					Templates: []*Template{nil}}
+			}(),
+			err: "template 0 is nil",
+		},
+		{
+			name: "invalid template",
+			v: func() *Model {
+				att := NewFileCollection()
+				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView(),
+					Templates: []*Template{{Question: "{{Front}}"}}}
+			}(),
+			err: "invalid template 0: name is required",
+		},
+		{
+			name: "sort field out of range",
+			v: func() *Model {
+				att := NewFileCollection()
+				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView(),
+					Fields: []*Field{{Name: "Front"}}, SortField: 1}
+			}(),
+			err: "sort field 1 out of range",
+		},
+		{
+			name: "duplicate template",
+			v: func() *Model {
+				att := NewFileCollection()
+				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView(),
+					Templates: []*Template{{Name: "Card 1"}, {Name: "Card 1"}}}
+			}(),
+			err: "duplicate template name 'Card 1'",
+		},
 		{
 			name: "valid",
 			v: func() *Model {
 				att := NewFileCollection()
-				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView()}
+				return &Model{Theme: &Theme{Attachments: att}, Type: "foo", Files: att.NewView(),
+					Templates: []*Template{{Name: "Card 1"}, {Name: "Card 2"}}}
 			}(),
 		},
 	}
@@ -242,3 +279,117 @@ func TestModelAddField(t *testing.T) {
 		})
 	}
 }
+
+func TestModelAddTemplate(t *testing.T) {
+	newModel := func() *Model {
+		th, _ := NewTheme("theme-Zm9v")
+		m, _ := th.NewModel("foo")
+		return m
+	}
+	tests := []struct {
+		name     string
+		model    *Model
+		tName    string
+		expected []*Template
+		err      string
+	}{
+		{
+			name:  "missing name",
+			model: newModel(),
+			err:   "template name is required",
+		},
+		{
+			name: "duplicate",
+			model: func() *Model {
+				m := newModel()
+				_, _ = m.AddTemplate("Card 1", "", "")
+				return m
+			}(),
+			tName: "Card 1",
+			err:   "template 'Card 1' already exists",
+		},
+		{
+			name:     "valid",
+			model:    newModel(),
+			tName:    "Card 1",
+			expected: []*Template{{Name: "Card 1", Question: "question", Answer: "answer"}},
+		},
+		{
+			name: "second",
+			model: func() *Model {
+				m := newModel()
+				_, _ = m.AddTemplate("Card 1", "question", "answer")
+				return m
+			}(),
+			tName: "Card 2",
+			expected: []*Template{
+				{Name: "Card 1", Question: "question", Answer: "answer"},
+				{Name: "Card 2", Question: "question", Answer: "answer"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := test.model.AddTemplate(test.tName, "question", "answer")
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, test.model.Templates); d != nil {
+				t.Error(d)
+			}
+			if tmpl != test.model.Template(test.tName) {
+				t.Errorf("Returned template is not the one stored in the model")
+			}
+		})
+	}
+}
+
+func TestModelUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []*Template
+		legacy   bool
+		err      string
+	}{
+		{
+			name:  "invalid template",
+			input: `{"id":0, "modelType":"foo", "templates":[1]}`,
+			err:   "invalid template 0: json: cannot unmarshal number into Go value of type fb.Template",
+		},
+		{
+			name:  "no templates",
+			input: `{"id":0, "modelType":"foo", "templates":null}`,
+		},
+		{
+			name:  "templates",
+			input: `{"id":0, "modelType":"foo", "templates":[{"name":"Card 1", "question":"{{Front}}", "answer":"{{Back}}", "browserQuestion":"{{text:Front}}"}]}`,
+			expected: []*Template{
+				{Name: "Card 1", Question: "{{Front}}", Answer: "{{Back}}", BrowserQuestion: "{{text:Front}}"},
+			},
+		},
+		{
+			name:     "legacy templates",
+			input:    `{"id":0, "modelType":"foo", "templates":["Card 1", "Card 2"]}`,
+			expected: []*Template{{Name: "Card 1"}, {Name: "Card 2"}},
+			legacy:   true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			m := &Model{}
+			err := m.UnmarshalJSON([]byte(test.input))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, m.Templates); d != nil {
+				t.Error(d)
+			}
+			if m.legacyTemplates != test.legacy {
+				t.Errorf("Unexpected legacy flag: %t", m.legacyTemplates)
+			}
+		})
+	}
+}
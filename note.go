@@ -8,14 +8,6 @@ import (
 	"github.com/pkg/errors"
 )
 
-/*
-type Note struct {
-    Tags           string           `db:"tags"` // List of the note's tags
-    UniqueField    string           `db:"sfld"` // The text of the first field, used for Anki's simplistic uniqueness checking
-    Checksum       int64            `db:"csum"` // Field checksum used for duplicate check. Integer representation of first 8 digits of sha1 hash of the first field
-}
-*/
-
 // Note represents a Flashback note.
 type Note struct {
 	ID          string          `json:"_id"`
@@ -27,7 +19,9 @@ type Note struct {
 	ModelID     uint32          `json:"model"`
 	FieldValues []*FieldValue   `json:"fieldValues"`
 	Attachments *FileCollection `json:"_attachments,omitempty"`
-	Model       *Model          `json:"-"`
+	// Tags holds the note's tags. It may be nil if the note has no tags.
+	Tags  *TagSet `json:"tags,omitempty"`
+	Model *Model  `json:"-"`
 	// Set to true by UnmarshalJSON, to skip certain validation checks
 	unmarshaling bool
 }
@@ -64,48 +58,68 @@ func (n *Note) validateModel(m *Model) error {
 // Validate validates that all of the data in the note  appears valid and self
 // consistent. A nil return value means no errors were detected.
 func (n *Note) Validate() error {
+	return n.ValidateAll().Err()
+}
+
+// ValidateAll validates the note as Validate does, but reports every problem
+// found, rather than only the first.
+func (n *Note) ValidateAll() *ValidationReport {
+	v := newReporter()
+	n.validate(v)
+	return v.report
+}
+
+func (n *Note) validate(v *reporter) {
 	if n.ID == "" {
-		return errors.New("id required")
-	}
-	if !strings.HasPrefix(n.ID, "note-") {
-		return errors.New("incorrect doc type")
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if !strings.HasPrefix(n.ID, "note-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
 	}
+	checkFields := !n.unmarshaling
 	if !n.unmarshaling {
 		if err := n.validateModel(n.Model); err != nil {
-			return err
+			code := ProblemInconsistent
+			if n.Model == nil {
+				code = ProblemRequired
+			}
+			v.error("model", code, err)
+			checkFields = false
 		}
 	}
 	if n.Created.IsZero() {
-		return errors.New("created time required")
+		v.errorf("created", ProblemRequired, "created time required")
 	}
 	if n.Modified.IsZero() {
-		return errors.New("modified time required")
+		v.errorf("modified", ProblemRequired, "modified time required")
 	}
 	if n.Attachments == nil {
-		return errors.New("attachments collection must not be nil")
+		v.errorf("_attachments", ProblemRequired, "attachments collection must not be nil")
 	}
 	for i, fv := range n.FieldValues {
-		if !n.unmarshaling {
+		if fv == nil {
+			continue
+		}
+		fvv := v.atIndex("fieldValues", i)
+		if checkFields {
 			switch n.Model.Fields[i].Type {
 			case TextField:
 				if fv.files != nil {
-					return errors.Errorf("text field %d must not have file list", i)
+					fvv.errorf("", ProblemInvalidValue, "text field %d must not have file list", i)
 				}
 			case AudioField:
 				if fv.Text != "" {
-					return errors.Errorf("audio field %d must not have text", i)
+					fvv.errorf("", ProblemInvalidValue, "audio field %d must not have text", i)
 				}
 			case ImageField:
 				if fv.Text != "" {
-					return errors.Errorf("image field %d must not have text", i)
+					fvv.errorf("", ProblemInvalidValue, "image field %d must not have text", i)
 				}
 			}
 		}
-		if fv != nil && fv.files != nil && !n.Attachments.hasMemberView(fv.files) {
-			return errors.Errorf("field %d file list must be member of attachments collection", i)
+		if fv.files != nil && n.Attachments != nil && !n.Attachments.hasMemberView(fv.files) {
+			fvv.errorf("", ProblemInconsistent, "field %d file list must be member of attachments collection", i)
 		}
 	}
-	return nil
 }
 
 // NewNote creates a new, empty note with the provided ID and Model.
@@ -140,6 +154,7 @@ func (n *Note) MarshalJSON() ([]byte, error) {
 		noteAlias
 		Type     string     `json:"type"`
 		Imported *time.Time `json:"imported,omitempty"`
+		Tags     *TagSet    `json:"tags,omitempty"`
 	}{
 		Type:      "note",
 		noteAlias: noteAlias(*n),
@@ -147,6 +162,9 @@ func (n *Note) MarshalJSON() ([]byte, error) {
 	if !n.Imported.IsZero() {
 		doc.Imported = &n.Imported
 	}
+	if n.Tags.Len() > 0 {
+		doc.Tags = n.Tags
+	}
 	return json.Marshal(doc)
 }
 
@@ -175,6 +193,25 @@ func (n *Note) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// mergeTags returns the union of the tag sets, or nil if both are empty.
+func mergeTags(a, b *TagSet) *TagSet {
+	if a.Len() == 0 && b.Len() == 0 {
+		return nil
+	}
+	return a.Union(b)
+}
+
+// AddTags adds the provided tags to the note. See TagSet.Add.
+func (n *Note) AddTags(tags ...string) {
+	if len(tags) == 0 {
+		return
+	}
+	if n.Tags == nil {
+		n.Tags = NewTagSet()
+	}
+	n.Tags.Add(tags...)
+}
+
 // GetFieldValue returns the requested FieldValue by index.
 func (n *Note) GetFieldValue(ord int) *FieldValue {
 	fv := n.FieldValues[ord]
@@ -273,16 +310,21 @@ func (n *Note) MergeImport(i interface{}) (bool, error) {
 		return false, errors.New("Created timestamps don't match")
 	}
 	n.Rev = existing.Rev
+	// Tags are never lost; those of both versions are kept
 	if n.Modified.After(existing.Modified) {
 		// The new version is newer than the existing one, so update
+		n.Tags = mergeTags(n.Tags, existing.Tags)
 		return true, nil
 	}
-	// The new version is older, so we need to use the version we just read
+	// The new version is older, so we need to use the version we just read,
+	// updating it only if the import adds any tags.
+	tags := mergeTags(existing.Tags, n.Tags)
+	n.Tags = tags
 	n.Modified = existing.Modified
 	n.Imported = existing.Imported
 	n.ModelID = existing.ModelID
 	n.FieldValues = existing.FieldValues
 	n.Attachments = existing.Attachments
 	n.Model = existing.Model
-	return false, nil
+	return tags.Len() > existing.Tags.Len(), nil
 }
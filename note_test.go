@@ -294,6 +294,26 @@ func TestNoteUnmarshalJSON(t *testing.T) {
 				}
 			}(),
 		},
+		{
+			name: "tags",
+			input: `{
+				"_id":          "note-Zm9v",
+				"created":      "2017-01-01T00:00:00Z",
+				"modified":     "2017-01-01T00:00:00Z",
+				"model":        3,
+				"theme":        "theme-Zm9v",
+				"tags":         ["Chapter :: 1", "chapter::1", " "]
+            }`,
+			expected: &Note{
+				ID:          "note-Zm9v",
+				Created:     now(),
+				Modified:    now(),
+				ModelID:     3,
+				ThemeID:     "theme-Zm9v",
+				Attachments: NewFileCollection(),
+				Tags:        NewTagSet("Chapter::1"),
+			},
+		},
 		{
 			name: "invalid file view",
 			input: `{
@@ -642,6 +662,72 @@ func TestNoteMergeImport(t *testing.T) {
 				Model:       &Model{ID: 2},
 			},
 		},
+		{
+			name: "new is newer, tags merged",
+			new: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-02-15T00:00:00Z"),
+				Tags:     NewTagSet("Chapter::1", "verbs"),
+			},
+			existing: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-01-01T01:01:01Z"),
+				Imported: parseTime("2017-01-20T00:00:00Z"),
+				Tags:     NewTagSet("chapter::1", "mine"),
+			},
+			expected: true,
+			expectedNote: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-02-15T00:00:00Z"),
+				Tags:     NewTagSet("Chapter::1", "mine", "verbs"),
+			},
+		},
+		{
+			name: "existing is newer, tags added",
+			new: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-01-01T01:01:01Z"),
+				Imported: parseTime("2017-02-15T00:00:00Z"),
+				Tags:     NewTagSet("verbs"),
+			},
+			existing: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-01-20T00:00:00Z"),
+				Tags:     NewTagSet("mine"),
+			},
+			expected: true,
+			expectedNote: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-01-20T00:00:00Z"),
+				Tags:     NewTagSet("mine", "verbs"),
+			},
+		},
+		{
+			name: "existing is newer, no new tags",
+			new: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-01-01T01:01:01Z"),
+				Imported: parseTime("2017-02-15T00:00:00Z"),
+				Tags:     NewTagSet("MINE"),
+			},
+			existing: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-01-20T00:00:00Z"),
+				Tags:     NewTagSet("mine"),
+			},
+			expected: false,
+			expectedNote: &Note{ID: "note-Zm9v",
+				Created:  parseTime("2017-01-01T01:01:01Z"),
+				Modified: parseTime("2017-02-01T01:01:01Z"),
+				Imported: parseTime("2017-01-20T00:00:00Z"),
+				Tags:     NewTagSet("mine"),
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -4,15 +4,14 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 type version int
 
 const (
-	// CurrentVersion represents the package format.
-	CurrentVersion = 2
+	// CurrentVersion represents the package format. Older versions are upgraded
+	// when read; see Package.Migrate.
+	CurrentVersion = 3
 	// LowestVersion is the lowest version we can compatibly read.
 	LowestVersion = 1
 )
@@ -21,14 +20,16 @@ const (
 // they can be easily transmitted or shared as a single file. It is intended to
 // be used via its json.Marshaler and json.Unmarshaler interfaces.
 type Package struct {
-	Created  time.Time `json:"created"`
-	Modified time.Time `json:"modified"`
-	Bundle   *Bundle   `json:"bundle,omitempty"`
-	Cards    []*Card   `json:"cards,omitempty"`
-	Notes    []*Note   `json:"notes,omitempty"`
-	Decks    []*Deck   `json:"decks,omitempty"`
-	Themes   []*Theme  `json:"themes,omitempty"`
-	Reviews  []*Review `json:"reviews,omitempty"`
+	Created       time.Time       `json:"created"`
+	Modified      time.Time       `json:"modified"`
+	Bundle        *Bundle         `json:"bundle,omitempty"`
+	Cards         []*Card         `json:"cards,omitempty"`
+	Notes         []*Note         `json:"notes,omitempty"`
+	Decks         []*Deck         `json:"decks,omitempty"`
+	FilteredDecks []*FilteredDeck `json:"filteredDecks,omitempty"`
+	DeckConfigs   []*DeckConfig   `json:"deckConfigs,omitempty"`
+	Themes        []*Theme        `json:"themes,omitempty"`
+	Reviews       []*Review       `json:"reviews,omitempty"`
 }
 
 type packageAlias Package
@@ -50,70 +51,132 @@ func (p *Package) MarshalJSON() ([]byte, error) {
 	return json.Marshal(doc)
 }
 
-// UnmarshalJSON satisfies the json.Unmarshaler interface.
+// UnmarshalJSON satisfies the json.Unmarshaler interface. Packages of an
+// older version are upgraded as they are read.
 func (p *Package) UnmarshalJSON(data []byte) error {
-	doc := &jsonPackage{}
-	if err := json.Unmarshal(data, &doc); err != nil {
-		return err
-	}
-	if doc.Version < LowestVersion {
-		return errors.Errorf("package version %d < %d", doc.Version, LowestVersion)
-	}
-	*p = Package(doc.packageAlias)
-	return p.Validate()
+	_, err := p.Migrate(data)
+	return err
 }
 
 // Validate does some basic sanity checking on the package.
 func (p *Package) Validate() error {
-	cardMap := map[string]*Card{}
-	for _, c := range p.Cards {
-		if err := c.Validate(); err != nil {
-			return errors.Wrapf(err, "card '%s' validation'", c.ID)
-		}
+	return p.ValidateAll().Err()
+}
+
+// ValidateAll validates the package as Validate does, but reports every
+// problem found, rather than only the first. This includes warnings for cards
+// whose notes, and reviews whose cards, are not in the package.
+func (p *Package) ValidateAll() *ValidationReport {
+	v := newReporter()
+	p.validate(v)
+	return v.report
+}
+
+func (p *Package) validate(v *reporter) {
+	if p.Bundle != nil {
+		p.Bundle.validate(v.at("bundle").wrap("bundle '%s' validation", p.Bundle.ID))
+	}
+
+	cardMap := make(map[string]*Card, len(p.Cards))
+	for i, c := range p.Cards {
+		c.validate(v.atIndex("cards", i).wrap("card '%s' validation'", c.ID))
 		cardMap[c.ID] = c
 	}
 
-	cards := make([]*Card, 0, len(cardMap))
+	configs := make(map[string]struct{}, len(p.DeckConfigs))
+	for i, dc := range p.DeckConfigs {
+		dc.validate(v.atIndex("deckConfigs", i).wrap("deck config '%s' validation", dc.ID))
+		configs[dc.ID] = struct{}{}
+	}
 
-	for _, d := range p.Decks {
-		if err := d.Validate(); err != nil {
-			return errors.Wrapf(err, "deck '%s' validation", d.ID)
+	decks := make(map[string]string, len(p.Cards))
+	for i, d := range p.Decks {
+		dv := v.atIndex("decks", i)
+		d.validate(dv.wrap("deck '%s' validation", d.ID))
+		if _, ok := configs[d.ConfigID]; d.ConfigID != "" && !ok {
+			dv.errorf("config", ProblemMissingReference, "deck config '%s' used by deck '%s' not found in package", d.ConfigID, d.ID)
 		}
-		for _, id := range d.Cards.All() {
-			c, ok := cardMap[id]
-			if !ok {
-				return fmt.Errorf("card '%s' listed in deck, but not found in package", id)
+		if d.Cards == nil {
+			continue
+		}
+		for j, id := range d.Cards.All() {
+			if _, ok := cardMap[id]; !ok {
+				dv.atIndex("cards", j).errorf("", ProblemMissingReference, "card '%s' listed in deck, but not found in package", id)
+				continue
+			}
+			if other, ok := decks[id]; ok {
+				dv.atIndex("cards", j).errorf("", ProblemDuplicate, "card '%s' listed in decks '%s' and '%s'", id, other, d.ID)
+				continue
 			}
-			cards = append(cards, c)
-			delete(cardMap, id)
+			decks[id] = d.ID
 		}
 	}
-	for id := range cardMap {
-		return fmt.Errorf("card '%s' found in package, but not in a deck", id)
+	// The tree is built on copies, so that validation leaves the decks
+	// unchanged
+	buildDeckTree(copyDecks(p.Decks), v)
+	for i, c := range p.Cards {
+		if _, ok := decks[c.ID]; !ok {
+			v.atIndex("cards", i).errorf("", ProblemOrphaned, "card '%s' found in package, but not in a deck", c.ID)
+		}
 	}
 
-	modelMap := make(map[string]*Model)
-	for _, t := range p.Themes {
-		if err := t.Validate(); err != nil {
-			return errors.Wrapf(err, "theme '%s' validation", t.ID)
+	filtered := make(map[string]string)
+	for i, fd := range p.FilteredDecks {
+		fv := v.atIndex("filteredDecks", i)
+		fd.validate(fv.wrap("filtered deck '%s' validation", fd.ID))
+		for j, id := range fd.Cards {
+			if _, ok := cardMap[id]; !ok {
+				fv.atIndex("cards", j).errorf("", ProblemMissingReference, "card '%s' listed in filtered deck, but not found in package", id)
+				continue
+			}
+			if other, ok := filtered[id]; ok {
+				fv.atIndex("cards", j).errorf("", ProblemDuplicate, "card '%s' listed in filtered decks '%s' and '%s'", id, other, fd.ID)
+				continue
+			}
+			filtered[id] = fd.ID
 		}
+	}
+
+	modelMap := make(map[string]*Model)
+	for i, t := range p.Themes {
+		t.validate(v.atIndex("themes", i).wrap("theme '%s' validation", t.ID))
 		for _, m := range t.Models {
-			modelMap[fmt.Sprintf("%s/%d", t.ID, m.ID)] = m
+			if m != nil {
+				modelMap[fmt.Sprintf("%s/%d", t.ID, m.ID)] = m
+			}
 		}
 	}
-	for _, n := range p.Notes {
+	notes := make(map[string]struct{}, len(p.Notes))
+	for i, n := range p.Notes {
+		nv := v.atIndex("notes", i)
 		n.unmarshaling = true
-		if err := n.Validate(); err != nil {
-			return errors.Wrapf(err, "note '%s' validation", n.ID)
-		}
+		n.validate(nv.wrap("note '%s' validation", n.ID))
 		n.unmarshaling = false
+		notes[n.ID] = struct{}{}
 		key := fmt.Sprintf("%s/%d", n.ThemeID, n.ModelID)
 		m, ok := modelMap[key]
 		if !ok {
-			return errors.Errorf("note '%s' has no matching model (%s)", n.ID, key)
+			nv.errorf("model", ProblemMissingReference, "note '%s' has no matching model (%s)", n.ID, key)
+			continue
 		}
 		n.Model = m
 	}
 
-	return nil
+	for i, c := range p.Cards {
+		// Invalid card IDs have been reported already
+		noteID, err := c.NoteID()
+		if err != nil {
+			continue
+		}
+		if _, ok := notes[string(noteID)]; !ok {
+			v.atIndex("cards", i).warnf("_id", ProblemMissingReference, "note '%s' of card '%s' not found in package", noteID, c.ID)
+		}
+	}
+	for i, r := range p.Reviews {
+		rv := v.atIndex("reviews", i)
+		r.validate(rv.wrap("review %d validation", i))
+		if _, ok := cardMap[r.CardID]; !ok && r.CardID != "" {
+			rv.warnf("cardID", ProblemMissingReference, "card '%s' of review not found in package", r.CardID)
+		}
+	}
 }
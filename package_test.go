@@ -57,6 +57,158 @@ func TestPkgValidate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "invalid deck config",
+			err:  "deck config '' validation: id required",
+			v: &Package{
+				DeckConfigs: []*DeckConfig{{}},
+			},
+		},
+		{
+			name: "deck config missing from package",
+			err:  "deck config 'dconf-Zm9v' used by deck 'deck-AQID' not found in package",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						ConfigID: "dconf-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "valid with deck config",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						ConfigID: "dconf-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+				DeckConfigs: []*DeckConfig{
+					{
+						ID:       "dconf-Zm9v",
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "parent deck missing from package",
+			err:  "parent deck 'deck-Zm9v' of deck 'deck-AQID' not found",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						ParentID: "deck-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "deck cycle",
+			err:  "deck 'deck-AQID' is its own ancestor",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						ParentID: "deck-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+					{
+						ID:       "deck-Zm9v",
+						ParentID: "deck-AQID",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "valid with nested decks",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						ParentID: "deck-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+					{
+						ID:       "deck-Zm9v",
+						Cards:    NewCardCollection(),
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "card missing from filtered deck",
+			err:  "card 'card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0' listed in filtered deck, but not found in package",
+			v: &Package{
+				FilteredDecks: []*FilteredDeck{
+					{
+						ID:       "fdeck-AQID",
+						Cards:    []string{"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"},
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
+		{
+			name: "card in two filtered decks",
+			err:  "card 'card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0' listed in filtered decks 'fdeck-AQID' and 'fdeck-Zm9v'",
+			v: &Package{
+				Decks: []*Deck{
+					{
+						ID:       "deck-AQID",
+						Cards:    &CardCollection{map[string]struct{}{"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0": {}}},
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+				FilteredDecks: []*FilteredDeck{
+					{
+						ID:       "fdeck-AQID",
+						Cards:    []string{"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"},
+						Created:  now(),
+						Modified: now(),
+					},
+					{
+						ID:       "fdeck-Zm9v",
+						Cards:    []string{"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"},
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+				Cards: []*Card{
+					{
+						ID:       "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0",
+						ModelID:  "theme-VGVzdCBUaGVtZQ/0",
+						Deck:     "fdeck-AQID",
+						HomeDeck: "deck-AQID",
+						Created:  now(),
+						Modified: now(),
+					},
+				},
+			},
+		},
 		{
 			name: "note without matching model",
 			err:  "note 'note-Zm9v' has no matching model (theme-Zm9v/3)",
@@ -77,6 +229,18 @@ func TestPkgValidate(t *testing.T) {
 	testValidation(t, tests)
 }
 
+func TestPkgValidateDecksUnchanged(t *testing.T) {
+	parent := &Deck{ID: "deck-Zm9v", Cards: NewCardCollection(), Created: now(), Modified: now()}
+	child := &Deck{ID: "deck-AQID", ParentID: "deck-Zm9v", Cards: NewCardCollection(), Created: now(), Modified: now()}
+	p := &Package{Decks: []*Deck{child, parent}}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if child.Parent != nil {
+		t.Errorf("Validate linked deck '%s' to its parent", child.ID)
+	}
+}
+
 func TestPkgMarshalJSON(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -90,12 +254,12 @@ func TestPkgMarshalJSON(t *testing.T) {
 				Created:  now(),
 				Modified: now(),
 			},
-			expected: `{"version":2, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z"}`,
+			expected: `{"version":3, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z"}`,
 		},
 		{
 			name: "invalid bundle",
 			pkg:  &Package{Bundle: &Bundle{}},
-			err:  "json: error calling MarshalJSON for type *fb.Bundle: id required",
+			err:  "bundle '' validation: id required",
 		},
 		{
 			name: "invalid card",
@@ -112,6 +276,11 @@ func TestPkgMarshalJSON(t *testing.T) {
 			pkg:  &Package{Decks: []*Deck{{}}},
 			err:  "deck '' validation: id required",
 		},
+		{
+			name: "invalid filtered deck",
+			pkg:  &Package{FilteredDecks: []*FilteredDeck{{}}},
+			err:  "filtered deck '' validation: id required",
+		},
 		{
 			name: "invalid theme",
 			pkg:  &Package{Themes: []*Theme{{}}},
@@ -120,7 +289,7 @@ func TestPkgMarshalJSON(t *testing.T) {
 		{
 			name: "invalid review",
 			pkg:  &Package{Reviews: []*Review{{}}},
-			err:  "json: error calling MarshalJSON for type *fb.Review: card id required",
+			err:  "review 0 validation: card id required",
 		},
 		{
 			name: "full package",
@@ -146,7 +315,7 @@ func TestPkgMarshalJSON(t *testing.T) {
 				}
 			}(),
 			expected: `{
-				"version": 2,
+				"version": 3,
 				"created": "2017-01-01T00:00:00Z",
 				"modified": "2017-01-01T00:00:00Z",
 				"bundle": {"_id":"bundle-mzxw6", "type":"bundle", "owner":"mjxwe", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z"},
@@ -0,0 +1,226 @@
+package fb
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// A zipped package holds the package JSON as its manifest, with the content
+// of every attachment moved to a separate archive entry, named for the
+// SHA-256 hash of the content. Identical attachments are stored only once.
+const (
+	zipManifest       = "package.json"
+	zipAttachmentsDir = "attachments/"
+	zipDigestPrefix   = "sha256-"
+)
+
+// attachmentStub replaces an attachment in the manifest of a zipped package.
+// It follows the form of CouchDB attachment stubs.
+type attachmentStub struct {
+	ContentType string `json:"content_type"`
+	Digest      string `json:"digest"`
+	Length      int    `json:"length"`
+	Stub        bool   `json:"stub"`
+}
+
+// WriteZip writes the package to w as a zip archive. See ReadPackageZip.
+func (p *Package) WriteZip(w io.Writer) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	var doc rawDoc
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	zw := zip.NewWriter(w)
+	written := make(map[string]struct{})
+	err = replaceAttachments(doc, func(name string, raw json.RawMessage) (interface{}, error) {
+		att := &Attachment{}
+		if err := json.Unmarshal(raw, att); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(att.Content)
+		hash := hex.EncodeToString(sum[:])
+		if _, ok := written[hash]; !ok {
+			if err := writeZipEntry(zw, zipAttachmentsDir+hash, att.ContentType, att.Content); err != nil {
+				return nil, err
+			}
+			written[hash] = struct{}{}
+		}
+		return &attachmentStub{
+			ContentType: att.ContentType,
+			Digest:      zipDigestPrefix + hash,
+			Length:      len(att.Content),
+			Stub:        true,
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	manifest, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := writeZipEntry(zw, zipManifest, BundleContentType, manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeZipEntry adds an entry to the archive, compressing it only if the
+// content type suggests that it is not already compressed.
+func writeZipEntry(zw *zip.Writer, name, ctype string, content []byte) error {
+	method := zip.Store
+	if compressible(ctype) {
+		method = zip.Deflate
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: method})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(content)
+	return errors.Wrapf(err, "failed to write %s", name)
+}
+
+func compressible(ctype string) bool {
+	ctype = strings.TrimSpace(strings.Split(ctype, ";")[0])
+	return strings.HasPrefix(ctype, "text/") ||
+		strings.HasSuffix(ctype, "/json") || strings.HasSuffix(ctype, "+json") ||
+		strings.HasSuffix(ctype, "/xml") || strings.HasSuffix(ctype, "+xml") ||
+		ctype == "application/javascript"
+}
+
+// ReadPackageZip reads a package, of the given size, from a zip archive
+// written by Package.WriteZip. Older package versions are upgraded, as by
+// Package.UnmarshalJSON.
+func ReadPackageZip(r io.ReaderAt, size int64) (*Package, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to open archive")
+	}
+	entries := newZipEntries(zr)
+	manifest, err := entries.read(zipManifest)
+	if err != nil {
+		return nil, err
+	}
+	var doc rawDoc
+	if err := json.Unmarshal(manifest, &doc); err != nil {
+		return nil, errors.Wrap(err, "invalid manifest")
+	}
+	err = replaceAttachments(doc, func(name string, raw json.RawMessage) (interface{}, error) {
+		stub := &attachmentStub{}
+		if err := json.Unmarshal(raw, stub); err != nil {
+			return nil, err
+		}
+		if !stub.Stub || !strings.HasPrefix(stub.Digest, zipDigestPrefix) {
+			return nil, errors.Errorf("attachment '%s' is not a stub", name)
+		}
+		hash := strings.TrimPrefix(stub.Digest, zipDigestPrefix)
+		content, err := entries.read(zipAttachmentsDir + hash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "attachment '%s'", name)
+		}
+		if sum := sha256.Sum256(content); hex.EncodeToString(sum[:]) != hash {
+			return nil, errors.Errorf("attachment '%s' does not match its digest", name)
+		}
+		return &Attachment{
+			ContentType: stub.ContentType,
+			Content:     content,
+		}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// replaceAttachments replaces each attachment of the package's themes and
+// notes with the value returned by fn.
+func replaceAttachments(doc rawDoc, fn func(name string, raw json.RawMessage) (interface{}, error)) error {
+	for _, key := range []string{"themes", "notes"} {
+		var docs []rawDoc
+		if err := unmarshalRaw(doc, key, &docs); err != nil {
+			return err
+		}
+		if docs == nil {
+			continue
+		}
+		for _, d := range docs {
+			var id string
+			if err := unmarshalRaw(d, "_id", &id); err != nil {
+				return err
+			}
+			var attachments rawDoc
+			if err := unmarshalRaw(d, "_attachments", &attachments); err != nil {
+				return err
+			}
+			if attachments == nil {
+				continue
+			}
+			names := make([]string, 0, len(attachments))
+			for name := range attachments {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				v, err := fn(name, attachments[name])
+				if err != nil {
+					return errors.Wrap(err, id)
+				}
+				if err := marshalRaw(attachments, name, v); err != nil {
+					return err
+				}
+			}
+			if err := marshalRaw(d, "_attachments", attachments); err != nil {
+				return err
+			}
+		}
+		if err := marshalRaw(doc, key, docs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipEntries indexes the entries of a zip archive by name.
+type zipEntries map[string]*zip.File
+
+func newZipEntries(zr *zip.Reader) zipEntries {
+	entries := make(zipEntries, len(zr.File))
+	for _, f := range zr.File {
+		entries[f.Name] = f
+	}
+	return entries
+}
+
+// read returns the content of the named entry.
+func (e zipEntries) read(name string) ([]byte, error) {
+	f, ok := e[name]
+	if !ok {
+		return nil, errors.Errorf("%s not found in archive", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to open %s", name)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	return data, errors.Wrapf(err, "failed to read %s", name)
+}
@@ -0,0 +1,164 @@
+package fb
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func testZipPackage() *Package {
+	p := testStreamPackage()
+	p.Themes[0].SetFile("style.css", "text/css", []byte(".card {}"))
+	p.Themes[0].SetFile("bg.png", "image/png", []byte("png"))
+	_ = p.Notes[0].Attachments.NewView().AddFile("same.png", "image/png", []byte("png"))
+	return p
+}
+
+func testZip(t *testing.T, entries map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	for name, content := range entries {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPackageWriteZip(t *testing.T) {
+	p := testZipPackage()
+	buf := &bytes.Buffer{}
+	if err := p.WriteZip(buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	methods := make(map[string]uint16)
+	names := make([]string, 0, len(zr.File))
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		methods[f.Name] = f.Method
+	}
+	sort.Strings(names)
+	t.Run("entries", func(t *testing.T) {
+		if len(names) != 3 || names[2] != zipManifest {
+			t.Fatalf("Unexpected entries: %v", names)
+		}
+		for _, name := range names[:2] {
+			if !strings.HasPrefix(name, zipAttachmentsDir) {
+				t.Errorf("Unexpected entry %s", name)
+			}
+		}
+		if methods[zipManifest] != zip.Deflate {
+			t.Errorf("Manifest should be compressed")
+		}
+	})
+	t.Run("manifest", func(t *testing.T) {
+		manifest, err := newZipEntries(zr).read(zipManifest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(manifest, []byte(`"data"`)) {
+			t.Errorf("Manifest contains attachment data")
+		}
+		var doc struct {
+			Themes []struct {
+				Attachments map[string]*attachmentStub `json:"_attachments"`
+			} `json:"themes"`
+		}
+		if err := json.Unmarshal(manifest, &doc); err != nil {
+			t.Fatal(err)
+		}
+		stub := doc.Themes[0].Attachments["bg.png"]
+		if stub == nil || !stub.Stub || stub.Length != 3 || stub.ContentType != "image/png" {
+			t.Fatalf("Unexpected stub: %v", stub)
+		}
+		entry := zipAttachmentsDir + strings.TrimPrefix(stub.Digest, zipDigestPrefix)
+		if m, ok := methods[entry]; !ok || m != zip.Store {
+			t.Errorf("Expected %s to be stored uncompressed", entry)
+		}
+	})
+}
+
+func TestReadPackageZip(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []byte
+		expected *Package
+		err      string
+	}{
+		{
+			name:  "not a zip",
+			input: []byte("foo"),
+			err:   "failed to open archive: zip: not a valid zip file",
+		},
+		{
+			name:  "no manifest",
+			input: testZip(t, map[string]string{"foo": "bar"}),
+			err:   "package.json not found in archive",
+		},
+		{
+			name:  "invalid manifest",
+			input: testZip(t, map[string]string{zipManifest: "foo"}),
+			err:   "invalid manifest: invalid character 'o' in literal false (expecting 'a')",
+		},
+		{
+			name: "not a stub",
+			input: testZip(t, map[string]string{zipManifest: `{"version":3, "notes":[{"_id":"note-Zm9v",
+				"_attachments":{"a.png":{"content_type":"image/png", "data":"cG5n"}}}]}`}),
+			err: "note-Zm9v: attachment 'a.png' is not a stub",
+		},
+		{
+			name: "missing attachment",
+			input: testZip(t, map[string]string{zipManifest: `{"version":3, "notes":[{"_id":"note-Zm9v",
+				"_attachments":{"a.png":{"content_type":"image/png", "digest":"sha256-abc", "length":3, "stub":true}}}]}`}),
+			err: "note-Zm9v: attachment 'a.png': attachments/abc not found in archive",
+		},
+		{
+			name: "digest mismatch",
+			input: testZip(t, map[string]string{
+				zipManifest: `{"version":3, "notes":[{"_id":"note-Zm9v",
+					"_attachments":{"a.png":{"content_type":"image/png", "digest":"sha256-abc", "length":3, "stub":true}}}]}`,
+				"attachments/abc": "png",
+			}),
+			err: "note-Zm9v: attachment 'a.png' does not match its digest",
+		},
+		{
+			name: "round trip",
+			input: func() []byte {
+				buf := &bytes.Buffer{}
+				if err := testZipPackage().WriteZip(buf); err != nil {
+					t.Fatal(err)
+				}
+				return buf.Bytes()
+			}(),
+			expected: testZipPackage(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := ReadPackageZip(bytes.NewReader(test.input), int64(len(test.input)))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.AsJSON(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
@@ -0,0 +1,164 @@
+package fb
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// CardQueue represents the study state of a card.
+type CardQueue int
+
+// The valid card queues.
+const (
+	// QueueNew holds cards which have never been studied.
+	QueueNew CardQueue = iota
+	// QueueLearning holds cards which are being stepped through the initial
+	// learning steps.
+	QueueLearning
+	// QueueReview holds cards which have graduated from learning, and are
+	// scheduled at intervals of one day or more.
+	QueueReview
+	// QueueRelearning holds review cards which were forgotten, and are being
+	// stepped through the relearning steps.
+	QueueRelearning
+)
+
+var queueNames = map[CardQueue]string{
+	QueueNew:        "new",
+	QueueLearning:   "learning",
+	QueueReview:     "review",
+	QueueRelearning: "relearning",
+}
+
+// The default learning steps, as used by the built-in schedulers.
+var (
+	DefaultLearningSteps   = []Interval{Minute, 10 * Minute}
+	DefaultRelearningSteps = []Interval{10 * Minute}
+)
+
+// queueTransitions lists the queues reachable from each queue by a single
+// answer.
+var queueTransitions = map[CardQueue][]CardQueue{
+	QueueNew:        {QueueLearning, QueueReview},
+	QueueLearning:   {QueueLearning, QueueReview},
+	QueueReview:     {QueueReview, QueueRelearning},
+	QueueRelearning: {QueueRelearning, QueueReview},
+}
+
+func (q CardQueue) String() string {
+	if name, ok := queueNames[q]; ok {
+		return name
+	}
+	return strconv.Itoa(int(q))
+}
+
+func (q CardQueue) valid() bool {
+	_, ok := queueNames[q]
+	return ok
+}
+
+// learning returns true if q is one of the learning queues.
+func (q CardQueue) learning() bool {
+	return q == QueueLearning || q == QueueRelearning
+}
+
+// CanTransition returns true if a card may move directly from q to next.
+func (q CardQueue) CanTransition(next CardQueue) bool {
+	for _, valid := range queueTransitions[q] {
+		if valid == next {
+			return true
+		}
+	}
+	return false
+}
+
+// queue returns the card's effective queue. Cards stored before the queue was
+// tracked are treated as review cards if they have been given an interval.
+func (c *Card) queue() CardQueue {
+	if c.Queue == QueueNew && c.Interval >= Day {
+		return QueueReview
+	}
+	return c.Queue
+}
+
+// reviewType returns the type of a review performed on a card in queue q.
+func (q CardQueue) reviewType() ReviewType {
+	switch q {
+	case QueueReview:
+		return ReviewTypeReview
+	case QueueRelearning:
+		return ReviewTypeRelearn
+	}
+	return ReviewTypeLearn
+}
+
+// answer returns the queue and learning step to which a card at the given
+// step of queue q moves, following an answer of the given ease. The returned
+// delay is the time until the card's next learning step. It is zero when the
+// card moves to the review queue, in which case the new interval is left for
+// the scheduler to calculate.
+func (q CardQueue) answer(ease ReviewEase, step int, learn, relearn []Interval) (next CardQueue, nextStep int, delay Interval) {
+	steps := learn
+	switch q {
+	case QueueReview:
+		if ease == ReviewEaseWrong && len(relearn) > 0 {
+			return QueueRelearning, 0, relearn[0]
+		}
+		return QueueReview, 0, 0
+	case QueueNew:
+		q, step = QueueLearning, 0
+	case QueueRelearning:
+		steps = relearn
+	}
+	if len(steps) == 0 {
+		return QueueReview, 0, 0
+	}
+	if step >= len(steps) {
+		step = len(steps) - 1
+	}
+	switch ease {
+	case ReviewEaseWrong:
+		return q, 0, steps[0]
+	case ReviewEaseHard:
+		return q, step, steps[step]
+	case ReviewEaseOK:
+		if step+1 < len(steps) {
+			return q, step + 1, steps[step+1]
+		}
+	}
+	return QueueReview, 0, 0
+}
+
+// transition is as answer, but returns an error if the resulting move from q
+// is not permitted.
+func (q CardQueue) transition(ease ReviewEase, step int, learn, relearn []Interval) (next CardQueue, nextStep int, delay Interval, err error) {
+	next, nextStep, delay = q.answer(ease, step, learn, relearn)
+	if !q.CanTransition(next) {
+		return 0, 0, 0, errors.Errorf("card cannot move from queue %s to %s", q, next)
+	}
+	return next, nextStep, delay, nil
+}
+
+// MarshalJSON implements the json.Marshaler interface for the CardQueue type.
+func (q CardQueue) MarshalJSON() ([]byte, error) {
+	if !q.valid() {
+		return nil, errors.Errorf("invalid queue %d", q)
+	}
+	return json.Marshal(queueNames[q])
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for the CardQueue
+// type.
+func (q *CardQueue) UnmarshalJSON(data []byte) error {
+	name := string(bytes.Trim(data, `"`))
+	for queue, queueName := range queueNames {
+		if name == queueName {
+			*q = queue
+			return nil
+		}
+	}
+	return errors.Errorf("unknown queue '%s'", name)
+}
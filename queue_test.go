@@ -0,0 +1,155 @@
+package fb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCardQueueString(t *testing.T) {
+	tests := map[CardQueue]string{
+		QueueNew:        "new",
+		QueueLearning:   "learning",
+		QueueReview:     "review",
+		QueueRelearning: "relearning",
+		CardQueue(9):    "9",
+	}
+	for q, expected := range tests {
+		if result := q.String(); result != expected {
+			t.Errorf("Unexpected result for %d: %s", q, result)
+		}
+	}
+}
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		from, to CardQueue
+		expected bool
+	}{
+		{QueueNew, QueueLearning, true},
+		{QueueNew, QueueReview, true},
+		{QueueNew, QueueRelearning, false},
+		{QueueLearning, QueueNew, false},
+		{QueueLearning, QueueReview, true},
+		{QueueReview, QueueRelearning, true},
+		{QueueReview, QueueLearning, false},
+		{QueueReview, QueueNew, false},
+		{QueueRelearning, QueueReview, true},
+		{QueueRelearning, QueueLearning, false},
+	}
+	for _, test := range tests {
+		if result := test.from.CanTransition(test.to); result != test.expected {
+			t.Errorf("Unexpected result for %s -> %s: %t", test.from, test.to, result)
+		}
+	}
+}
+
+func TestQueueAnswer(t *testing.T) {
+	learn := []Interval{Minute, 10 * Minute, Hour}
+	relearn := []Interval{10 * Minute}
+	tests := []struct {
+		name     string
+		queue    CardQueue
+		ease     ReviewEase
+		step     int
+		learn    []Interval
+		next     CardQueue
+		nextStep int
+		delay    Interval
+	}{
+		{name: "new, wrong", queue: QueueNew, ease: ReviewEaseWrong, learn: learn, next: QueueLearning, delay: Minute},
+		{name: "new, hard", queue: QueueNew, ease: ReviewEaseHard, learn: learn, next: QueueLearning, delay: Minute},
+		{name: "new, ok", queue: QueueNew, ease: ReviewEaseOK, learn: learn, next: QueueLearning, nextStep: 1, delay: 10 * Minute},
+		{name: "new, easy", queue: QueueNew, ease: ReviewEaseEasy, learn: learn, next: QueueReview},
+		{name: "new, no steps", queue: QueueNew, ease: ReviewEaseWrong, next: QueueReview},
+		{name: "learning, wrong", queue: QueueLearning, step: 2, ease: ReviewEaseWrong, learn: learn, next: QueueLearning, delay: Minute},
+		{name: "learning, hard", queue: QueueLearning, step: 1, ease: ReviewEaseHard, learn: learn, next: QueueLearning, nextStep: 1, delay: 10 * Minute},
+		{name: "learning, ok", queue: QueueLearning, step: 1, ease: ReviewEaseOK, learn: learn, next: QueueLearning, nextStep: 2, delay: Hour},
+		{name: "learning, graduate", queue: QueueLearning, step: 2, ease: ReviewEaseOK, learn: learn, next: QueueReview},
+		{name: "learning, step out of range", queue: QueueLearning, step: 5, ease: ReviewEaseHard, learn: learn, next: QueueLearning, nextStep: 2, delay: Hour},
+		{name: "review, ok", queue: QueueReview, ease: ReviewEaseOK, learn: learn, next: QueueReview},
+		{name: "review, wrong", queue: QueueReview, ease: ReviewEaseWrong, learn: learn, next: QueueRelearning, delay: 10 * Minute},
+		{name: "relearning, hard", queue: QueueRelearning, ease: ReviewEaseHard, learn: learn, next: QueueRelearning, delay: 10 * Minute},
+		{name: "relearning, ok", queue: QueueRelearning, ease: ReviewEaseOK, learn: learn, next: QueueReview},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := relearn
+			if test.learn == nil {
+				r = nil
+			}
+			next, step, delay := test.queue.answer(test.ease, test.step, test.learn, r)
+			if next != test.next || step != test.nextStep || delay != test.delay {
+				t.Errorf("Unexpected result: %s %d %s", next, step, delay)
+			}
+			if !test.queue.CanTransition(next) {
+				t.Errorf("Invalid transition %s -> %s", test.queue, next)
+			}
+		})
+	}
+}
+
+func TestCardQueueMarshalJSON(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		result, err := json.Marshal(QueueRelearning)
+		checkErr(t, nil, err)
+		if string(result) != `"relearning"` {
+			t.Errorf("Unexpected result: %s", result)
+		}
+	})
+	t.Run("invalid", func(t *testing.T) {
+		_, err := CardQueue(-1).MarshalJSON()
+		checkErr(t, "invalid queue -1", err)
+	})
+}
+
+func TestCardQueueUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected CardQueue
+		err      string
+	}{
+		{
+			name:  "unknown",
+			input: `"foo"`,
+			err:   "unknown queue 'foo'",
+		},
+		{
+			name:     "learning",
+			input:    `"learning"`,
+			expected: QueueLearning,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result CardQueue
+			err := result.UnmarshalJSON([]byte(test.input))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
+
+func TestCardEffectiveQueue(t *testing.T) {
+	tests := []struct {
+		name     string
+		card     *Card
+		expected CardQueue
+	}{
+		{name: "new", card: &Card{}, expected: QueueNew},
+		{name: "legacy review", card: &Card{Interval: 5 * Day}, expected: QueueReview},
+		{name: "relearning", card: &Card{Queue: QueueRelearning, Interval: 5 * Day}, expected: QueueRelearning},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := test.card.queue(); result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
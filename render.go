@@ -0,0 +1,271 @@
+package fb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// RenderedCard holds the HTML for both sides of a card, along with the CSS of
+// its theme. Any attachments referenced by the HTML or CSS are embedded as
+// data URIs.
+type RenderedCard struct {
+	Question string
+	Answer   string
+	CSS      string
+}
+
+// Render renders the card's question and answer from the note, which must
+// be the card's own note.
+func (c *Card) Render(n *Note) (*RenderedCard, error) {
+	id, err := c.CardID()
+	if err != nil {
+		return nil, err
+	}
+	if id.Note != NoteID(n.ID) {
+		return nil, errors.Errorf("card '%s' does not belong to note '%s'", c.ID, n.ID)
+	}
+	return n.Render(id.Template)
+}
+
+// Render renders the question and answer of the note's card with the given
+// template ID. Templates use Anki's syntax:
+//
+//	{{Field}}              The value of the named field
+//	{{#Field}}..{{/Field}} Included only if the field is not empty
+//	{{^Field}}..{{/Field}} Included only if the field is empty
+//	{{text:Field}}         The field value, with HTML removed
+//	{{cloze:Field}}        The field value, with the card's cloze hidden
+//	{{FrontSide}}          The rendered question, on the answer side
+//
+// Anki's built-in fields {{Tags}}, {{Type}} and {{Card}} give the note's tags
+// and the names of its model and template. As a note does not belong to a
+// deck, {{Deck}} and {{Subdeck}} are rendered empty.
+func (n *Note) Render(templateID uint32) (*RenderedCard, error) {
+	m := n.Model
+	if m == nil {
+		return nil, errors.New("model required")
+	}
+	ord := templateID
+	if m.Type == AnkiClozeModel {
+		// Cloze models have a single template, shared by all cards
+		ord = 0
+	}
+	if int(ord) >= len(m.Templates) {
+		return nil, errors.Errorf("template %d not found", templateID)
+	}
+	tmpl := m.Templates[ord]
+
+	r := &renderer{
+		fields: map[string]string{
+			"Tags":    strings.Join(n.Tags.All(), " "),
+			"Type":    m.Name,
+			"Card":    tmpl.Name,
+			"Deck":    "",
+			"Subdeck": "",
+		},
+		cloze: int(templateID) + 1,
+	}
+	for i, f := range m.Fields {
+		var text string
+		if i < len(n.FieldValues) && n.FieldValues[i] != nil {
+			text = n.FieldValues[i].Text
+		}
+		r.fields[f.Name] = text
+	}
+	question, err := r.render(tmpl.Question)
+	if err != nil {
+		return nil, errors.Wrap(err, "question")
+	}
+	r.frontSide = question
+	r.answer = true
+	answer, err := r.render(tmpl.Answer)
+	if err != nil {
+		return nil, errors.Wrap(err, "answer")
+	}
+
+	var sources []fileSource
+	if n.Attachments != nil {
+		sources = append(sources, n.Attachments)
+	}
+	sources = append(sources, m.Files)
+	var css []string
+	if t := m.Theme; t != nil && t.Files != nil {
+		sources = append(sources, t.Files)
+		names := t.Files.FileList()
+		sort.Strings(names)
+		for _, name := range names {
+			if att, _ := t.Files.GetFile(name); att.ContentType == "text/css" {
+				css = append(css, string(att.Content))
+			}
+		}
+	}
+	return &RenderedCard{
+		Question: embedFiles(question, sources),
+		Answer:   embedFiles(answer, sources),
+		CSS:      embedFiles(strings.Join(css, "\n"), sources),
+	}, nil
+}
+
+type renderer struct {
+	fields    map[string]string
+	cloze     int
+	answer    bool
+	frontSide string
+}
+
+func (r *renderer) render(tmpl string) (string, error) {
+	var out bytes.Buffer
+	for {
+		start := strings.Index(tmpl, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(tmpl[start:], "}}")
+		if end < 0 {
+			break
+		}
+		out.WriteString(tmpl[:start])
+		tag := strings.TrimSpace(tmpl[start+2 : start+end])
+		tmpl = tmpl[start+end+2:]
+		if tag == "" {
+			continue
+		}
+		switch tag[0] {
+		case '#', '^':
+			name := strings.TrimSpace(tag[1:])
+			closing := "{{/" + name + "}}"
+			i := strings.Index(tmpl, closing)
+			if i < 0 {
+				return "", errors.Errorf("unclosed section '%s'", name)
+			}
+			inner := tmpl[:i]
+			tmpl = tmpl[i+len(closing):]
+			value, err := r.field(name)
+			if err != nil {
+				return "", err
+			}
+			if (strings.TrimSpace(value) != "") != (tag[0] == '#') {
+				continue
+			}
+			text, err := r.render(inner)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(text)
+		case '/':
+			return "", errors.Errorf("unexpected '{{%s}}'", tag)
+		default:
+			text, err := r.substitute(tag)
+			if err != nil {
+				return "", err
+			}
+			out.WriteString(text)
+		}
+	}
+	out.WriteString(tmpl)
+	return out.String(), nil
+}
+
+func (r *renderer) field(name string) (string, error) {
+	if name == "FrontSide" {
+		return r.frontSide, nil
+	}
+	value, ok := r.fields[name]
+	if !ok {
+		return "", errors.Errorf("unknown field '%s'", name)
+	}
+	return value, nil
+}
+
+// substitute returns the value of the tag, which is a field name optionally
+// preceded by filters, such as "text:Front". Filters are applied from right
+// to left. Unrecognized filters are ignored.
+func (r *renderer) substitute(tag string) (string, error) {
+	parts := strings.Split(tag, ":")
+	value, err := r.field(parts[len(parts)-1])
+	if err != nil {
+		return "", err
+	}
+	for i := len(parts) - 2; i >= 0; i-- {
+		switch parts[i] {
+		case "text":
+			value = stripHTML(value)
+		case "cloze":
+			value = r.renderCloze(value)
+		}
+	}
+	return value, nil
+}
+
+// renderCloze hides the card's cloze deletion on the question side, and
+// highlights it on the answer side. Other clozes are shown as plain text.
+func (r *renderer) renderCloze(text string) string {
+	return clozeRE.ReplaceAllStringFunc(text, func(match string) string {
+		c := ParseClozes(match)
+		if len(c) == 0 {
+			return match
+		}
+		if c[0].Index != r.cloze {
+			return c[0].Text
+		}
+		if r.answer {
+			return `<span class="cloze">` + c[0].Text + `</span>`
+		}
+		hint := "..."
+		if c[0].Hint != "" {
+			hint = c[0].Hint
+		}
+		return `<span class="cloze">[` + hint + `]</span>`
+	})
+}
+
+var htmlTagRE = regexp.MustCompile(`<[^>]*>`)
+
+func stripHTML(s string) string {
+	return html.UnescapeString(htmlTagRE.ReplaceAllString(s, ""))
+}
+
+// fileSource is satisfied by both FileCollection and FileCollectionView.
+type fileSource interface {
+	GetFile(name string) (*Attachment, bool)
+}
+
+var fileRefRE = regexp.MustCompile(`(\ssrc=)(?:"([^"]*)"|'([^']*)'|([^"'\s>]+))|url\((?:"([^"]*)"|'([^']*)'|([^"')]*))\)|\[sound:([^\]]+)\]`)
+
+// embedFiles replaces references to attachments found in sources, by src
+// attributes, CSS url() values, and Anki [sound:...] tags, with data URIs.
+func embedFiles(text string, sources []fileSource) string {
+	lookup := func(name string) (string, bool) {
+		name = html.UnescapeString(name)
+		for _, src := range sources {
+			if att, ok := src.GetFile(name); ok {
+				return "data:" + att.ContentType + ";base64," + base64.StdEncoding.EncodeToString(att.Content), true
+			}
+		}
+		return "", false
+	}
+	return fileRefRE.ReplaceAllStringFunc(text, func(match string) string {
+		m := fileRefRE.FindStringSubmatch(match)
+		switch {
+		case m[8] != "":
+			if uri, ok := lookup(m[8]); ok {
+				return `<audio controls src="` + uri + `"></audio>`
+			}
+		case m[1] != "":
+			if uri, ok := lookup(m[2] + m[3] + m[4]); ok {
+				return m[1] + `"` + uri + `"`
+			}
+		default:
+			if uri, ok := lookup(m[5] + m[6] + m[7]); ok {
+				return `url("` + uri + `")`
+			}
+		}
+		return match
+	})
+}
@@ -0,0 +1,161 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func testRenderNote(t *testing.T, modelType, question, answer string, values ...string) *Note {
+	th, err := NewTheme("theme-Zm9v")
+	if err != nil {
+		t.Fatal(err)
+	}
+	th.SetFile("b.css", "text/css", []byte(`.card { background: url("_bg.png"); }`))
+	th.SetFile("a.css", "text/css", []byte(".cloze { color: blue; }"))
+	th.SetFile("_bg.png", "image/png", []byte("png"))
+	m, err := th.NewModel(modelType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Front", "Back", "Extra"} {
+		if err := m.AddField(AnkiField, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := m.AddTemplate("Card 1", question, answer); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.AddTemplate("Card 2", "{{Back}}", "{{Front}}"); err != nil {
+		t.Fatal(err)
+	}
+	n, err := NewNote("note-YmFy", m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		fv := n.GetFieldValue(i)
+		fv.Text = v
+		if i == 0 {
+			if err := fv.AddFile("a.mp3", "audio/mpeg", []byte("mp3")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return n
+}
+
+func TestNoteRender(t *testing.T) {
+	tests := []struct {
+		name       string
+		note       *Note
+		templateID uint32
+		expected   *RenderedCard
+		err        string
+	}{
+		{
+			name: "no model",
+			note: &Note{},
+			err:  "model required",
+		},
+		{
+			name:       "template not found",
+			note:       testRenderNote(t, AnkiStandardModel, "", "", "foo", "bar"),
+			templateID: 2,
+			err:        "template 2 not found",
+		},
+		{
+			name: "unknown field",
+			note: testRenderNote(t, AnkiStandardModel, "{{Foo}}", "", "foo", "bar"),
+			err:  "question: unknown field 'Foo'",
+		},
+		{
+			name: "built-in fields",
+			note: func() *Note {
+				n := testRenderNote(t, AnkiStandardModel, "{{Front}} [{{Tags}}]{{^Deck}} {{Card}}{{/Deck}}", "{{Type}}", "foo")
+				n.Model.Name = "Basic"
+				n.AddTags("verbs", "Spanish")
+				return n
+			}(),
+			expected: &RenderedCard{
+				Question: `foo [Spanish verbs] Card 1`,
+				Answer:   "Basic",
+				CSS:      ".cloze { color: blue; }\n.card { background: url(\"data:image/png;base64,cG5n\"); }",
+			},
+		},
+		{
+			name: "unclosed section",
+			note: testRenderNote(t, AnkiStandardModel, "", "{{#Back}}foo", "foo", "bar"),
+			err:  "answer: unclosed section 'Back'",
+		},
+		{
+			name: "unexpected close",
+			note: testRenderNote(t, AnkiStandardModel, "{{/Back}}", "", "foo", "bar"),
+			err:  "question: unexpected '{{/Back}}'",
+		},
+		{
+			name: "basic",
+			note: testRenderNote(t, AnkiStandardModel,
+				"{{Front}}{{#Extra}} ({{Extra}}){{/Extra}}{{^Extra}}!{{/Extra}}",
+				"{{FrontSide}}<hr id=answer>{{text:Back}}",
+				"uno [sound:a.mp3]", "<b>one</b> &amp; only"),
+			expected: &RenderedCard{
+				Question: `uno <audio controls src="data:audio/mpeg;base64,bXAz"></audio>!`,
+				Answer:   `uno <audio controls src="data:audio/mpeg;base64,bXAz"></audio>!<hr id=answer>one & only`,
+				CSS:      ".cloze { color: blue; }\n.card { background: url(\"data:image/png;base64,cG5n\"); }",
+			},
+		},
+		{
+			name:       "second template",
+			note:       testRenderNote(t, AnkiStandardModel, "", "", `<img src="a.mp3">`, "one", "extra"),
+			templateID: 1,
+			expected: &RenderedCard{
+				Question: "one",
+				Answer:   `<img src="data:audio/mpeg;base64,bXAz">`,
+				CSS:      ".cloze { color: blue; }\n.card { background: url(\"data:image/png;base64,cG5n\"); }",
+			},
+		},
+		{
+			name: "cloze",
+			note: testRenderNote(t, AnkiClozeModel, "{{cloze:Front}}", "{{cloze:Front}}<br>{{Back}}",
+				"{{c1::Canberra}} is the capital of {{c2::Australia::country}}", "trivia"),
+			templateID: 1,
+			expected: &RenderedCard{
+				Question: `Canberra is the capital of <span class="cloze">[country]</span>`,
+				Answer:   `Canberra is the capital of <span class="cloze">Australia</span><br>trivia`,
+				CSS:      ".cloze { color: blue; }\n.card { background: url(\"data:image/png;base64,cG5n\"); }",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.note.Render(test.templateID)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestCardRender(t *testing.T) {
+	n := testRenderNote(t, AnkiStandardModel, "{{Front}}", "{{Back}}", "foo", "bar")
+	t.Run("wrong note", func(t *testing.T) {
+		c := &Card{ID: "card-krsxg5baij2w4zdmmu.Zm9v.0"}
+		_, err := c.Render(n)
+		checkErr(t, "card 'card-krsxg5baij2w4zdmmu.Zm9v.0' does not belong to note 'note-YmFy'", err)
+	})
+	t.Run("success", func(t *testing.T) {
+		c := &Card{ID: "card-krsxg5baij2w4zdmmu.YmFy.1"}
+		result, err := c.Render(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.Question != "bar" || result.Answer != "foo" {
+			t.Errorf("Unexpected result: %v", result)
+		}
+	})
+}
@@ -2,7 +2,6 @@ package fb
 
 import (
 	"encoding/json"
-	"errors"
 	"time"
 )
 
@@ -10,66 +9,124 @@ import (
 type Review struct {
 	CardID    string    `json:"cardID"`
 	Timestamp time.Time `json:"timestamp"`
-	// Ease             ReviewEase     `json:"ease"`
-	// Interval         *time.Duration `json:"interval"`
-	// PreviousInterval *time.Duration `json:"previousInterval"`
-	// SRSFactor        float32        `json:"srsFactor"`
-	// ReviewTime       *time.Duration `json:"reviewTime"`
-	// Type             ReviewType     `json:"reviewType"`
+	// Ease is the answer given. It is zero for reviews recorded before the
+	// ease was tracked.
+	Ease ReviewEase `json:"ease,omitempty"`
+	// Interval is the interval scheduled as a result of this review.
+	Interval Interval `json:"interval,omitempty"`
+	// PreviousInterval is the card's interval prior to this review.
+	PreviousInterval Interval `json:"previousInterval,omitempty"`
+	// SRSFactor is the card's ease factor as a result of this review.
+	SRSFactor float32 `json:"srsFactor,omitempty"`
+	// ReviewTime is the time taken to answer the card. It is stored with
+	// millisecond precision.
+	ReviewTime time.Duration `json:"reviewTime,omitempty"`
+	Type       ReviewType    `json:"reviewType,omitempty"`
+	// Leech is true if this review caused the card to be flagged as a leech.
+	Leech bool `json:"leech,omitempty"`
+	// Suspended is true if this review caused the card to be suspended, as
+	// the leech action.
+	Suspended bool `json:"suspended,omitempty"`
 }
 
 // Validate validates that all of the data in the review appears valid and self
 // consistent. A nil return value means no errors were detected.
 func (r *Review) Validate() error {
+	return r.ValidateAll().Err()
+}
+
+// ValidateAll validates the review as Validate does, but reports every
+// problem found, rather than only the first.
+func (r *Review) ValidateAll() *ValidationReport {
+	v := newReporter()
+	r.validate(v)
+	return v.report
+}
+
+func (r *Review) validate(v *reporter) {
 	if r.CardID == "" {
-		return errors.New("card id required")
-	}
-	if _, _, _, err := parseCardID(r.CardID); err != nil {
-		return err
+		v.errorf("cardID", ProblemRequired, "card id required")
+	} else if _, err := ParseCardID(r.CardID); err != nil {
+		v.error("cardID", ProblemInvalidID, err)
 	}
 	if r.Timestamp.IsZero() {
-		return errors.New("timestamp required")
+		v.errorf("timestamp", ProblemRequired, "timestamp required")
+	}
+	if r.Ease != 0 && !r.Ease.valid() {
+		v.errorf("ease", ProblemInvalidValue, "invalid ease %d", r.Ease)
+	}
+	if r.Type < 0 || r.Type > ReviewTypeCram {
+		v.errorf("reviewType", ProblemInvalidValue, "invalid review type %d", r.Type)
+	}
+	if r.Interval < 0 {
+		v.errorf("interval", ProblemInvalidValue, "intervals must not be negative")
+	}
+	if r.PreviousInterval < 0 {
+		v.errorf("previousInterval", ProblemInvalidValue, "intervals must not be negative")
+	}
+	if r.ReviewTime < 0 {
+		v.errorf("reviewTime", ProblemInvalidValue, "review time must not be negative")
 	}
-	return nil
 }
 
 type reviewAlias Review
 
+type jsonReview struct {
+	reviewAlias
+	ReviewTime int64 `json:"reviewTime,omitempty"`
+}
+
 // MarshalJSON satisfies the json.Marshaler interface.
 func (r *Review) MarshalJSON() ([]byte, error) {
 	if err := r.Validate(); err != nil {
 		return nil, err
 	}
-	return json.Marshal(reviewAlias(*r))
+	doc := jsonReview{
+		reviewAlias: reviewAlias(*r),
+		ReviewTime:  int64(r.ReviewTime / time.Millisecond),
+	}
+	return json.Marshal(doc)
 }
 
-// UnmarshalJSON satisfies the json.Unmarshaler interface.
+// UnmarshalJSON satisfies the json.Unmarshaler interface. Version 1 reviews,
+// which record only the card ID and timestamp, are read with the remaining
+// fields left empty.
 func (r *Review) UnmarshalJSON(data []byte) error {
-	doc := &reviewAlias{}
+	doc := &jsonReview{}
 	if err := json.Unmarshal(data, &doc); err != nil {
 		return err
 	}
-	*r = Review(*doc)
+	*r = Review(doc.reviewAlias)
+	r.ReviewTime = time.Duration(doc.ReviewTime) * time.Millisecond
 	return r.Validate()
 }
 
-// type ReviewEase int
-//
-// const (
-// 	ReviewEaseWrong ReviewEase = 1
-// 	ReviewEaseHard  ReviewEase = 2
-// 	ReviewEaseOK    ReviewEase = 3
-// 	ReviewEaseEasy  ReviewEase = 4
-// )
-//
-// type urReviewType int
-//
-// const (
-// 	ReviewTypeLearn ReviewType = iota
-// 	ReviewTypeReview
-// 	ReviewTypeRelearn
-// 	ReviewTypeCram
-// )
+// ReviewEase represents the ease with which a card was answered.
+type ReviewEase int
+
+// The valid answers to a card review, from worst to best.
+const (
+	ReviewEaseWrong ReviewEase = 1
+	ReviewEaseHard  ReviewEase = 2
+	ReviewEaseOK    ReviewEase = 3
+	ReviewEaseEasy  ReviewEase = 4
+)
+
+func (e ReviewEase) valid() bool {
+	return e >= ReviewEaseWrong && e <= ReviewEaseEasy
+}
+
+// ReviewType represents the type of a review.
+type ReviewType int
+
+// The valid review types. The zero value is used for reviews recorded before
+// the review type was tracked.
+const (
+	ReviewTypeLearn ReviewType = iota + 1
+	ReviewTypeReview
+	ReviewTypeRelearn
+	ReviewTypeCram
+)
 
 // NewReview returns a new, empty Review for the provided Card.
 func NewReview(cardID string) (*Review, error) {
@@ -2,6 +2,7 @@ package fb
 
 import (
 	"testing"
+	"time"
 
 	"github.com/flimzy/diff"
 )
@@ -57,6 +58,33 @@ func TestReviewMarshalJSON(t *testing.T) {
 			review:   &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now()},
 			expected: `{"cardID":"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", "timestamp":"2017-01-01T00:00:00Z"}`,
 		},
+		{
+			name: "all fields",
+			review: &Review{
+				CardID:           "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0",
+				Timestamp:        now(),
+				Ease:             ReviewEaseHard,
+				Interval:         10 * Day,
+				PreviousInterval: 10 * Minute,
+				SRSFactor:        2.5,
+				ReviewTime:       3500 * time.Millisecond,
+				Type:             ReviewTypeRelearn,
+				Leech:            true,
+				Suspended:        true,
+			},
+			expected: `{
+				"cardID":           "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0",
+				"timestamp":        "2017-01-01T00:00:00Z",
+				"ease":             2,
+				"interval":         10,
+				"previousInterval": -600,
+				"srsFactor":        2.5,
+				"reviewTime":       3500,
+				"reviewType":       3,
+				"leech":            true,
+				"suspended":        true
+			}`,
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -94,6 +122,34 @@ func TestReviewUnmarshalJSON(t *testing.T) {
 			input:    `{"cardID":"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", "timestamp":"2017-01-01T00:00:00Z"}`,
 			expected: &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now()},
 		},
+		{
+			name:  "invalid ease",
+			input: `{"cardID":"card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", "timestamp":"2017-01-01T00:00:00Z", "ease":5}`,
+			err:   "invalid ease 5",
+		},
+		{
+			name: "all fields",
+			input: `{
+				"cardID":           "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0",
+				"timestamp":        "2017-01-01T00:00:00Z",
+				"ease":             2,
+				"interval":         10,
+				"previousInterval": -600,
+				"srsFactor":        2.5,
+				"reviewTime":       3500,
+				"reviewType":       3
+			}`,
+			expected: &Review{
+				CardID:           "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0",
+				Timestamp:        now(),
+				Ease:             ReviewEaseHard,
+				Interval:         10 * Day,
+				PreviousInterval: 10 * Minute,
+				SRSFactor:        2.5,
+				ReviewTime:       3500 * time.Millisecond,
+				Type:             ReviewTypeRelearn,
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -132,10 +188,35 @@ func TestReviewValidate(t *testing.T) {
 			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"},
 			err:  "timestamp required",
 		},
+		{
+			name: "invalid ease",
+			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now(), Ease: -1},
+			err:  "invalid ease -1",
+		},
+		{
+			name: "invalid review type",
+			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now(), Type: 5},
+			err:  "invalid review type 5",
+		},
+		{
+			name: "negative interval",
+			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now(), PreviousInterval: -Day},
+			err:  "intervals must not be negative",
+		},
+		{
+			name: "negative review time",
+			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now(), ReviewTime: -time.Second},
+			err:  "review time must not be negative",
+		},
 		{
 			name: "valid",
 			v:    &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now()},
 		},
+		{
+			name: "valid with all fields",
+			v: &Review{CardID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Timestamp: now(),
+				Ease: ReviewEaseEasy, Interval: Day, SRSFactor: 2.5, ReviewTime: time.Second, Type: ReviewTypeCram},
+		},
 	}
 	testValidation(t, tests)
 }
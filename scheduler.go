@@ -0,0 +1,93 @@
+package fb
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Scheduler is implemented by spaced repetition algorithms, to calculate the
+// new scheduling state of a card following a review.
+type Scheduler interface {
+	// Schedule updates c to reflect an answer of the given ease at the
+	// reviewed time, and returns a Review recording the event.
+	Schedule(c *Card, ease ReviewEase, reviewed time.Time) (*Review, error)
+}
+
+// Names of the built-in schedulers.
+const (
+	SchedulerSM2  = "sm2"
+	SchedulerFSRS = "fsrs"
+)
+
+var (
+	schedulersMU sync.RWMutex
+	schedulers   = make(map[string]Scheduler)
+)
+
+func init() {
+	RegisterScheduler(SchedulerSM2, &SM2Scheduler{})
+	RegisterScheduler(SchedulerFSRS, NewFSRSScheduler())
+}
+
+// RegisterScheduler makes a scheduler available by the provided name. If
+// RegisterScheduler is called twice with the same name, or if s is nil, it
+// panics.
+func RegisterScheduler(name string, s Scheduler) {
+	schedulersMU.Lock()
+	defer schedulersMU.Unlock()
+	if s == nil {
+		panic("fb: RegisterScheduler scheduler is nil")
+	}
+	if _, dup := schedulers[name]; dup {
+		panic("fb: RegisterScheduler called twice for scheduler " + name)
+	}
+	schedulers[name] = s
+}
+
+// GetScheduler returns the scheduler registered with the provided name.
+func GetScheduler(name string) (Scheduler, error) {
+	schedulersMU.RLock()
+	defer schedulersMU.RUnlock()
+	s, ok := schedulers[name]
+	if !ok {
+		return nil, errors.Errorf("unknown scheduler '%s'", name)
+	}
+	return s, nil
+}
+
+// Schedulers returns a sorted list of the names of the registered schedulers.
+func Schedulers() []string {
+	schedulersMU.RLock()
+	defer schedulersMU.RUnlock()
+	names := make([]string, 0, len(schedulers))
+	for name := range schedulers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newReview returns a new Review of c, answered with the given ease at the
+// reviewed time, recording the card's state prior to being rescheduled.
+func newReview(c *Card, ease ReviewEase, reviewed time.Time) (*Review, error) {
+	r, err := NewReview(c.ID)
+	if err != nil {
+		return nil, err
+	}
+	r.Timestamp = reviewed
+	r.Ease = ease
+	r.PreviousInterval = c.Interval
+	r.Type = c.queue().reviewType()
+	return r, nil
+}
+
+// stepsOrDefault returns steps, or def if steps is nil.
+func stepsOrDefault(steps, def []Interval) []Interval {
+	if steps == nil {
+		return def
+	}
+	return steps
+}
@@ -0,0 +1,80 @@
+package fb
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flimzy/diff"
+)
+
+type testScheduler struct{}
+
+var _ Scheduler = &testScheduler{}
+
+func (s *testScheduler) Schedule(_ *Card, _ ReviewEase, _ time.Time) (*Review, error) {
+	return nil, nil
+}
+
+func TestGetScheduler(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected Scheduler
+		err      string
+	}{
+		{
+			name: "unknown",
+			err:  "unknown scheduler 'unknown'",
+		},
+		{
+			name:     SchedulerSM2,
+			expected: &SM2Scheduler{},
+		},
+		{
+			name:     SchedulerFSRS,
+			expected: NewFSRSScheduler(),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := GetScheduler(test.name)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestRegisterScheduler(t *testing.T) {
+	t.Run("nil", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != "fb: RegisterScheduler scheduler is nil" {
+				t.Errorf("Unexpected panic: %v", r)
+			}
+		}()
+		RegisterScheduler("nil", nil)
+	})
+	t.Run("duplicate", func(t *testing.T) {
+		defer func() {
+			if r := recover(); r != "fb: RegisterScheduler called twice for scheduler sm2" {
+				t.Errorf("Unexpected panic: %v", r)
+			}
+		}()
+		RegisterScheduler(SchedulerSM2, &testScheduler{})
+	})
+	t.Run("valid", func(t *testing.T) {
+		RegisterScheduler("test", &testScheduler{})
+		defer func() {
+			schedulersMU.Lock()
+			delete(schedulers, "test")
+			schedulersMU.Unlock()
+		}()
+		expected := []string{"fsrs", "sm2", "test"}
+		if d := diff.Interface(expected, Schedulers()); d != nil {
+			t.Error(d)
+		}
+	})
+}
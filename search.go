@@ -0,0 +1,576 @@
+package fb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+// SearchQuery is a parsed search query, in the style of the Anki browser.
+//
+// A query is a list of terms, all of which must match. Terms may be combined
+// with "or", negated with a leading "-", and grouped with parentheses. Values
+// containing spaces may be quoted, and "*" matches any run of characters.
+// Text is matched case-insensitively. The supported terms are:
+//
+//	dog           notes with a field containing "dog"
+//	front:dog     notes whose Front field is exactly "dog"
+//	deck:spanish  cards in the top-level deck named "spanish", or its child
+//	              decks; deck:*::verbs matches child decks named "verbs"
+//	tag:verbs     notes tagged "verbs", or any tag beneath it
+//	model:basic   notes and cards of the model named "basic"
+//	is:due        review and learning cards which are due, and not suspended
+//	              or buried; also is:new, is:learn, is:review, is:suspended,
+//	              is:buried and is:leech
+//	prop:ivl>30   cards with an interval of more than 30 days; also due (days
+//	              from today), ease, reps and lapses, with any of the
+//	              operators =, !=, <, <=, > and >=
+type SearchQuery struct {
+	// Root is the root of the parsed query, or nil if the query is empty and
+	// matches everything.
+	Root SearchNode
+}
+
+// SearchNode is a node of a parsed search query: one of *SearchAnd,
+// *SearchOr, *SearchNot or *SearchTerm.
+type SearchNode interface {
+	String() string
+	match(item *SearchItem) bool
+}
+
+// SearchAnd matches if all of its nodes match.
+type SearchAnd struct {
+	Nodes []SearchNode
+}
+
+// SearchOr matches if any of its nodes match.
+type SearchOr struct {
+	Nodes []SearchNode
+}
+
+// SearchNot matches if its node does not match.
+type SearchNot struct {
+	Node SearchNode
+}
+
+// The keys of search terms which are not field names.
+const (
+	SearchText  = ""
+	SearchDeck  = "deck"
+	SearchTag   = "tag"
+	SearchModel = "model"
+	SearchIs    = "is"
+	SearchProp  = "prop"
+)
+
+// SearchTerm is a single term of a query.
+type SearchTerm struct {
+	// Key is one of the Search* constants, or otherwise the name of the
+	// field to be matched.
+	Key   string
+	Value string
+	// Prop, Op and Number hold the parsed value of a prop: term.
+	Prop   string
+	Op     string
+	Number float64
+
+	pattern *regexp.Regexp
+}
+
+// SearchItem is a card or note to be matched against a query, along with its
+// related documents. For a card, the note should be given, with its model set,
+// as well as the deck, linked to its ancestors, so that all terms may be
+// matched. When searching notes only, Card and Deck are nil, and card terms
+// never match.
+type SearchItem struct {
+	Card *Card
+	Note *Note
+	Deck *Deck
+}
+
+// The values recognized by is: terms.
+var searchStates = map[string]struct{}{
+	"due": {}, "new": {}, "learn": {}, "review": {}, "suspended": {}, "buried": {}, "leech": {},
+}
+
+// The properties recognized by prop: terms.
+var searchProps = map[string]struct{}{
+	"ivl": {}, "due": {}, "ease": {}, "reps": {}, "lapses": {},
+}
+
+// The operators of prop: terms, longest first.
+var searchOps = []string{"<=", ">=", "!=", "=", "<", ">"}
+
+// ParseSearch parses a search query. See SearchQuery for the syntax.
+func ParseSearch(query string) (*SearchQuery, error) {
+	tokens, err := lexSearch(query)
+	if err != nil {
+		return nil, err
+	}
+	p := &searchParser{tokens: tokens}
+	if len(tokens) == 0 {
+		return &SearchQuery{}, nil
+	}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.New("unexpected ')'")
+	}
+	return &SearchQuery{Root: root}, nil
+}
+
+// Match returns true if the item matches the query.
+func (q *SearchQuery) Match(item *SearchItem) bool {
+	if q.Root == nil {
+		return true
+	}
+	return q.Root.match(item)
+}
+
+// MatchCards returns the cards which match the query, in their original
+// order. lookup returns the note and deck of each card.
+func (q *SearchQuery) MatchCards(cards []*Card, lookup func(*Card) (*Note, *Deck)) []*Card {
+	var result []*Card
+	for _, c := range cards {
+		n, d := lookup(c)
+		if q.Match(&SearchItem{Card: c, Note: n, Deck: d}) {
+			result = append(result, c)
+		}
+	}
+	return result
+}
+
+// MatchNotes returns the notes which match the query, in their original
+// order. Terms which apply only to cards never match.
+func (q *SearchQuery) MatchNotes(notes []*Note) []*Note {
+	var result []*Note
+	for _, n := range notes {
+		if q.Match(&SearchItem{Note: n}) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+func (q *SearchQuery) String() string {
+	if q.Root == nil {
+		return ""
+	}
+	return q.Root.String()
+}
+
+func (a *SearchAnd) String() string { return joinNodes(a.Nodes, " ") }
+
+func (a *SearchAnd) match(item *SearchItem) bool {
+	for _, n := range a.Nodes {
+		if !n.match(item) {
+			return false
+		}
+	}
+	return true
+}
+
+func (o *SearchOr) String() string { return joinNodes(o.Nodes, " or ") }
+
+func (o *SearchOr) match(item *SearchItem) bool {
+	for _, n := range o.Nodes {
+		if n.match(item) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *SearchNot) String() string { return "-" + n.Node.String() }
+
+func (n *SearchNot) match(item *SearchItem) bool { return !n.Node.match(item) }
+
+func joinNodes(nodes []SearchNode, sep string) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return "(" + strings.Join(parts, sep) + ")"
+}
+
+func (t *SearchTerm) String() string {
+	value := t.Value
+	if value == "" || strings.IndexFunc(value, func(r rune) bool {
+		return unicode.IsSpace(r) || strings.ContainsRune(`"():`, r)
+	}) >= 0 {
+		value = strconv.Quote(value)
+	}
+	if t.Key == SearchText {
+		return value
+	}
+	return t.Key + ":" + value
+}
+
+func (t *SearchTerm) match(item *SearchItem) bool {
+	switch t.Key {
+	case SearchText:
+		if item.Note == nil {
+			return false
+		}
+		for _, fv := range item.Note.FieldValues {
+			if fv != nil && t.pattern.MatchString(fv.Text) {
+				return true
+			}
+		}
+		return false
+	case SearchDeck:
+		return item.Deck != nil && t.pattern.MatchString(item.Deck.Path())
+	case SearchTag:
+		if item.Note == nil {
+			return false
+		}
+		for _, tag := range item.Note.Tags.All() {
+			if t.pattern.MatchString(tag) {
+				return true
+			}
+		}
+		return false
+	case SearchModel:
+		return item.Note != nil && item.Note.Model != nil && t.pattern.MatchString(item.Note.Model.Name)
+	case SearchIs:
+		return item.Card != nil && matchState(item.Card, t.Value)
+	case SearchProp:
+		return item.Card != nil && t.matchProp(item.Card)
+	}
+	if item.Note == nil || item.Note.Model == nil {
+		return false
+	}
+	for i, f := range item.Note.Model.Fields {
+		if !strings.EqualFold(f.Name, t.Key) || i >= len(item.Note.FieldValues) {
+			continue
+		}
+		text := ""
+		if fv := item.Note.FieldValues[i]; fv != nil {
+			text = fv.Text
+		}
+		if t.pattern.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchState(c *Card, state string) bool {
+	switch state {
+	case "due":
+		return c.queue() != QueueNew && !c.Due.After(Now()) && !c.Suspended && !c.IsBuried()
+	case "new":
+		return c.queue() == QueueNew
+	case "learn":
+		return c.queue().learning()
+	case "review":
+		return c.queue() == QueueReview
+	case "suspended":
+		return c.Suspended
+	case "buried":
+		return c.IsBuried()
+	case "leech":
+		return c.Leech
+	}
+	return false
+}
+
+func (t *SearchTerm) matchProp(c *Card) bool {
+	var value float64
+	switch t.Prop {
+	case "ivl":
+		value = float64(c.Interval.Days())
+	case "due":
+		if c.Due.IsZero() || c.queue() == QueueNew {
+			return false
+		}
+		value = float64(dueDays(c.Due))
+	case "ease":
+		value = float64(c.EaseFactor)
+	case "reps":
+		value = float64(c.ReviewCount)
+	case "lapses":
+		value = float64(c.LapseCount)
+	}
+	return compareNumbers(value, t.Op, t.Number)
+}
+
+// dueDays returns the number of days from today until d, which is negative
+// if d is in the past.
+func dueDays(d Due) int {
+	day := time.Time(On(time.Time(d)))
+	return int(day.Sub(time.Time(Today())) / time.Duration(Day))
+}
+
+func compareNumbers(a float64, op string, b float64) bool {
+	switch op {
+	case "=":
+		return a == b
+	case "!=":
+		return a != b
+	case "<":
+		return a < b
+	case "<=":
+		return a <= b
+	case ">":
+		return a > b
+	case ">=":
+		return a >= b
+	}
+	return false
+}
+
+// searchPattern compiles a search value to a case-insensitive regular
+// expression source, in which "*" matches any run of characters. If exact is
+// false, the pattern matches anywhere in the text.
+func searchPattern(value string, exact bool) string {
+	parts := strings.Split(value, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	pattern := strings.Join(parts, ".*")
+	if exact {
+		pattern = "^" + pattern + "$"
+	}
+	return "(?is)" + pattern
+}
+
+// searchToken is a token of a search query. Words hold the raw text of a
+// term, with any quotes.
+type searchToken struct {
+	kind byte // One of '(', ')', '-', 'w'
+	word string
+}
+
+func lexSearch(query string) ([]searchToken, error) {
+	var tokens []searchToken
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case r == '(' || r == ')':
+			tokens = append(tokens, searchToken{kind: byte(r)})
+			i++
+			continue
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			tokens = append(tokens, searchToken{kind: '-'})
+			i++
+			continue
+		}
+		start := i
+		quoted := false
+		for ; i < len(runes); i++ {
+			r := runes[i]
+			if quoted {
+				if r == '\\' {
+					i++
+				} else if r == '"' {
+					quoted = false
+				}
+				continue
+			}
+			if r == '"' {
+				quoted = true
+			} else if unicode.IsSpace(r) || r == '(' || r == ')' {
+				break
+			}
+		}
+		if quoted {
+			return nil, errors.New("unterminated quote")
+		}
+		tokens = append(tokens, searchToken{kind: 'w', word: string(runes[start:i])})
+	}
+	return tokens, nil
+}
+
+type searchParser struct {
+	tokens []searchToken
+	pos    int
+}
+
+func (p *searchParser) peek() *searchToken {
+	if p.pos < len(p.tokens) {
+		return &p.tokens[p.pos]
+	}
+	return nil
+}
+
+// keyword returns true if the next token is the unquoted keyword.
+func (p *searchParser) keyword(kw string) bool {
+	t := p.peek()
+	return t != nil && t.kind == 'w' && strings.EqualFold(t.word, kw)
+}
+
+func (p *searchParser) parseOr() (SearchNode, error) {
+	node, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	nodes := []SearchNode{node}
+	for p.keyword("or") {
+		p.pos++
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	if len(nodes) == 1 {
+		return nodes[0], nil
+	}
+	return &SearchOr{Nodes: nodes}, nil
+}
+
+func (p *searchParser) parseAnd() (SearchNode, error) {
+	var nodes []SearchNode
+	for {
+		if p.keyword("and") && len(nodes) > 0 {
+			p.pos++
+		}
+		t := p.peek()
+		if t == nil || t.kind == ')' || p.keyword("or") {
+			break
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	switch len(nodes) {
+	case 0:
+		return nil, errors.New("expected search term")
+	case 1:
+		return nodes[0], nil
+	}
+	return &SearchAnd{Nodes: nodes}, nil
+}
+
+func (p *searchParser) parseUnary() (SearchNode, error) {
+	t := p.peek()
+	p.pos++
+	switch t.kind {
+	case '-':
+		if t := p.peek(); t == nil || t.kind == ')' {
+			return nil, errors.New("expected search term after '-'")
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &SearchNot{Node: node}, nil
+	case '(':
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.peek(); t == nil || t.kind != ')' {
+			return nil, errors.New("missing ')'")
+		}
+		p.pos++
+		return node, nil
+	}
+	return parseSearchTerm(t.word)
+}
+
+// parseSearchTerm parses a single term, such as deck:"my deck".
+func parseSearchTerm(word string) (*SearchTerm, error) {
+	key, value := "", word
+	if i := unquotedIndex(word, ':'); i >= 0 {
+		key, value = strings.ToLower(unquoteSearch(word[:i])), word[i+1:]
+	}
+	term := &SearchTerm{Key: key, Value: unquoteSearch(value)}
+	switch term.Key {
+	case SearchText:
+		if term.Value == "" {
+			return nil, errors.New("expected search term")
+		}
+		term.pattern = regexp.MustCompile(searchPattern(term.Value, false))
+	case SearchDeck:
+		// Child decks have paths of the form parent::child
+		term.pattern = regexp.MustCompile(searchPattern(term.Value, true) + "|" + searchPattern(term.Value+DeckSeparator+"*", true))
+	case SearchTag:
+		term.pattern = regexp.MustCompile(searchPattern(term.Value, true) + "|" + searchPattern(term.Value+TagSeparator+"*", true))
+	case SearchIs:
+		term.Value = strings.ToLower(term.Value)
+		if _, ok := searchStates[term.Value]; !ok {
+			return nil, errors.Errorf("unknown search state 'is:%s'", term.Value)
+		}
+	case SearchProp:
+		if err := term.parseProp(); err != nil {
+			return nil, err
+		}
+	default:
+		term.pattern = regexp.MustCompile(searchPattern(term.Value, true))
+	}
+	return term, nil
+}
+
+func (t *SearchTerm) parseProp() error {
+	for _, op := range searchOps {
+		i := strings.Index(t.Value, op)
+		if i < 0 {
+			continue
+		}
+		t.Prop, t.Op = strings.ToLower(t.Value[:i]), op
+		if _, ok := searchProps[t.Prop]; !ok {
+			return errors.Errorf("unknown search property '%s'", t.Prop)
+		}
+		num, err := strconv.ParseFloat(t.Value[i+len(op):], 64)
+		if err != nil {
+			return errors.Errorf("invalid value for search property '%s'", t.Prop)
+		}
+		t.Number = num
+		return nil
+	}
+	return errors.Errorf("invalid search property '%s'", t.Value)
+}
+
+// unquotedIndex returns the index of the first r in s which is not within
+// quotes, or -1.
+func unquotedIndex(s string, r rune) int {
+	quoted, escaped := false, false
+	for i, c := range s {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		case c == r && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+// unquoteSearch removes the quotes from s, and unescapes any quoted
+// characters.
+func unquoteSearch(s string) string {
+	var buf []rune
+	quoted, escaped := false, false
+	for _, c := range s {
+		switch {
+		case escaped:
+			buf = append(buf, c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"':
+			quoted = !quoted
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
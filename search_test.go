@@ -0,0 +1,197 @@
+package fb
+
+import (
+	"testing"
+)
+
+func TestParseSearch(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+		err      string
+	}{
+		{name: "empty", query: "  ", expected: ""},
+		{name: "text", query: "dog", expected: "dog"},
+		{name: "implicit and", query: "dog cat", expected: "(dog cat)"},
+		{name: "explicit and", query: "dog AND cat", expected: "(dog cat)"},
+		{name: "or", query: "dog or cat mouse", expected: "(dog or (cat mouse))"},
+		{name: "group", query: "(dog or cat) mouse", expected: "((dog or cat) mouse)"},
+		{name: "not", query: "-deck:spanish -(a b)", expected: "(-deck:spanish -(a b))"},
+		{name: "quoted", query: `deck:"my deck" "tag":"a b" "a:b"`, expected: `(deck:"my deck" tag:"a b" "a:b")`},
+		{name: "escaped quote", query: `"say \"hi\""`, expected: `"say \"hi\""`},
+		{name: "field", query: "Front:dog", expected: "front:dog"},
+		{name: "state", query: "is:DUE", expected: "is:due"},
+		{name: "prop", query: "prop:ivl>=30", expected: "prop:ivl>=30"},
+		{name: "dash in word", query: "well-known", expected: "well-known"},
+		{name: "unexpected paren", query: "dog)", err: "unexpected ')'"},
+		{name: "missing paren", query: "(dog", err: "missing ')'"},
+		{name: "empty group", query: "()", err: "expected search term"},
+		{name: "trailing or", query: "dog or", err: "expected search term"},
+		{name: "empty text", query: `""`, err: "expected search term"},
+		{name: "dangling dash", query: "(dog -)", err: "expected search term after '-'"},
+		{name: "unterminated", query: `"dog`, err: "unterminated quote"},
+		{name: "unknown state", query: "is:hungry", err: "unknown search state 'is:hungry'"},
+		{name: "unknown prop", query: "prop:foo>1", err: "unknown search property 'foo'"},
+		{name: "invalid prop value", query: "prop:ivl>x", err: "invalid value for search property 'ivl'"},
+		{name: "invalid prop", query: "prop:ivl", err: "invalid search property 'ivl'"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if result := q.String(); result != test.expected {
+				t.Errorf("Unexpected result: %s", result)
+			}
+		})
+	}
+}
+
+func searchFixtures() (*Card, *Note, *Deck) {
+	model := &Model{
+		Name:   "Basic",
+		Fields: []*Field{{Name: "Front"}, {Name: "Back"}},
+	}
+	n := &Note{
+		ID:          "note-Zm9v",
+		Model:       model,
+		FieldValues: []*FieldValue{{Text: "The big dog"}, {Text: "el perro grande"}},
+		Tags:        NewTagSet("Spanish::Nouns", "animals"),
+	}
+	d := &Deck{ID: "deck-AQ", Name: "Vocab"}
+	d.SetParent(&Deck{ID: "deck-Ag", Name: "Spanish"})
+	c := &Card{
+		ID:          "card-krsxg5baij2w4zdmmu.VGVzdCBOb3Rl.0",
+		Queue:       QueueReview,
+		Due:         parseDue("2016-12-30"),
+		Interval:    45 * Day,
+		EaseFactor:  2.5,
+		ReviewCount: 10,
+		LapseCount:  1,
+	}
+	return c, n, d
+}
+
+func TestSearchMatch(t *testing.T) {
+	tests := []struct {
+		query    string
+		card     func(*Card)
+		expected bool
+	}{
+		{query: "", expected: true},
+		{query: "dog", expected: true},
+		{query: "DOG perro", expected: true},
+		{query: "cat"},
+		{query: "cat or perro", expected: true},
+		{query: "-cat", expected: true},
+		{query: "d*g", expected: true},
+		{query: `"big dog"`, expected: true},
+		{query: "front:dog"},
+		{query: "front:*dog", expected: true},
+		{query: "back:el*", expected: true},
+		{query: "side:*"},
+		{query: "deck:spanish", expected: true},
+		{query: "deck:spanish::vocab", expected: true},
+		{query: "deck:span"},
+		{query: "deck:span*", expected: true},
+		{query: "deck:vocab"},
+		{query: "deck:*::vocab", expected: true},
+		{query: "tag:spanish", expected: true},
+		{query: "tag:nouns"},
+		{query: "tag:*::nouns", expected: true},
+		{query: "model:basic", expected: true},
+		{query: "model:cloze"},
+		{query: "is:due", expected: true},
+		{query: "is:review", expected: true},
+		{query: "is:new"},
+		{query: "is:learn"},
+		{query: "is:suspended"},
+		{query: "is:buried"},
+		{query: "is:leech"},
+		{query: "is:due", card: func(c *Card) { c.Suspended = true }},
+		{query: "is:due", card: func(c *Card) { c.BuriedUntil = parseDue("2017-01-02") }},
+		{query: "is:due", card: func(c *Card) { c.Due = parseDue("2017-01-02") }},
+		{query: "is:buried", card: func(c *Card) { c.BuriedUntil = parseDue("2017-01-02") }, expected: true},
+		{query: "is:leech", card: func(c *Card) { c.Leech = true }, expected: true},
+		{query: "is:new", card: func(c *Card) { *c = Card{} }, expected: true},
+		{query: "is:review", card: func(c *Card) { c.Queue = QueueNew }, expected: true},
+		{query: "is:learn", card: func(c *Card) { c.Queue = QueueRelearning }, expected: true},
+		{query: "prop:ivl>30", expected: true},
+		{query: "prop:ivl<=30"},
+		{query: "prop:due=-2", expected: true},
+		{query: "prop:due<0", expected: true},
+		{query: "prop:due>=0"},
+		{query: "prop:due<0", card: func(c *Card) { c.Queue = QueueNew; c.Interval = 0 }},
+		{query: "prop:ease=2.5", expected: true},
+		{query: "prop:reps!=10"},
+		{query: "prop:lapses<2", expected: true},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c, n, d := searchFixtures()
+			if test.card != nil {
+				test.card(c)
+			}
+			if result := q.Match(&SearchItem{Card: c, Note: n, Deck: d}); result != test.expected {
+				t.Errorf("Unexpected result: %t", result)
+			}
+		})
+	}
+}
+
+func TestSearchMatchNotes(t *testing.T) {
+	_, n, _ := searchFixtures()
+	other := &Note{ID: "note-YmFy", FieldValues: []*FieldValue{{Text: "cat"}}}
+	notes := []*Note{n, other}
+	tests := []struct {
+		query    string
+		expected []*Note
+	}{
+		{query: "dog", expected: []*Note{n}},
+		{query: "-dog", expected: []*Note{other}},
+		{query: "is:new"},
+		{query: "-deck:spanish", expected: notes},
+	}
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			q, err := ParseSearch(test.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := q.MatchNotes(notes)
+			if len(result) != len(test.expected) {
+				t.Fatalf("Expected %d notes, got %d", len(test.expected), len(result))
+			}
+			for i, n := range result {
+				if n != test.expected[i] {
+					t.Errorf("Unexpected note %s at %d", n.ID, i)
+				}
+			}
+		})
+	}
+}
+
+func TestSearchMatchCards(t *testing.T) {
+	c, n, d := searchFixtures()
+	other := &Card{ID: "card-krsxg5baij2w4zdmmu.YmFy.0"}
+	q, err := ParseSearch("deck:spanish is:review")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := q.MatchCards([]*Card{c, other}, func(card *Card) (*Note, *Deck) {
+		if card == c {
+			return n, d
+		}
+		return nil, nil
+	})
+	if len(result) != 1 || result[0] != c {
+		t.Errorf("Unexpected result: %v", result)
+	}
+}
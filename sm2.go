@@ -0,0 +1,166 @@
+package fb
+
+import (
+	"math"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultEaseFactor is the ease factor assigned to a card which has never
+	// been reviewed.
+	DefaultEaseFactor float32 = 2.5
+	// MinEaseFactor is the lowest ease factor the SM-2 algorithm will assign.
+	MinEaseFactor float32 = 1.3
+	// DefaultMaxInterval is the longest interval scheduled when no maximum
+	// is set, of about 100 years.
+	DefaultMaxInterval = 36500 * Day
+)
+
+// sm2Quality maps answer eases to SM-2 response qualities (0-5). Anything
+// below 3 is considered a failure to recall the card.
+var sm2Quality = map[ReviewEase]int{
+	ReviewEaseWrong: 2,
+	ReviewEaseHard:  3,
+	ReviewEaseOK:    4,
+	ReviewEaseEasy:  5,
+}
+
+// SM2Scheduler schedules cards according to the SuperMemo-2 algorithm, as
+// described at https://www.supermemo.com/english/ol/sm2.htm
+//
+// New and forgotten cards are first stepped through the learning or relearning
+// steps, before the SM-2 algorithm is applied to review cards.
+type SM2Scheduler struct {
+	// LearningSteps and RelearningSteps are the delays between the steps a new
+	// or forgotten card passes through before (re)graduating to the review
+	// queue. If nil, DefaultLearningSteps and DefaultRelearningSteps are used.
+	LearningSteps   []Interval
+	RelearningSteps []Interval
+	// GraduatingInterval is the interval given to a card when it graduates
+	// from the learning queue. If zero, one day is used.
+	GraduatingInterval Interval
+	// EasyInterval is the interval given to a card answered as easy while
+	// learning. If zero, four days is used.
+	EasyInterval Interval
+	// InitialEase is the ease factor given to new cards. If zero, the
+	// DefaultEaseFactor is used.
+	InitialEase float32
+	// MaxInterval is the longest interval which will be scheduled. If zero,
+	// DefaultMaxInterval is used.
+	MaxInterval Interval
+	// LeechThreshold is the number of lapses after which a card is flagged as
+	// a leech, and LeechAction is applied. Zero disables leech detection.
+	LeechThreshold int
+	LeechAction    LeechAction
+}
+
+// Schedule updates the card's Due, Interval and EaseFactor to reflect an answer
+// of the given ease at the reviewed time, and returns a Review recording the
+// event.
+func (s *SM2Scheduler) Schedule(c *Card, ease ReviewEase, reviewed time.Time) (*Review, error) {
+	quality, ok := sm2Quality[ease]
+	if !ok {
+		return nil, errors.Errorf("invalid ease %d", ease)
+	}
+	reviewed = reviewed.UTC()
+	r, err := newReview(c, ease, reviewed)
+	if err != nil {
+		return nil, err
+	}
+
+	factor := c.EaseFactor
+	if factor == 0 {
+		factor = DefaultEaseFactor
+		if s.InitialEase > 0 {
+			factor = s.InitialEase
+		}
+	}
+	maxInterval := s.MaxInterval
+	if maxInterval <= 0 {
+		maxInterval = DefaultMaxInterval
+	}
+	prev := c.queue()
+	next, step, delay, err := prev.transition(ease, c.LearningStep,
+		stepsOrDefault(s.LearningSteps, DefaultLearningSteps),
+		stepsOrDefault(s.RelearningSteps, DefaultRelearningSteps))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case prev == QueueReview:
+		c.Interval = sm2Interval(c.Interval, factor, quality, maxInterval)
+		c.EaseFactor = sm2EaseFactor(factor, quality)
+	case next == QueueReview && prev != QueueRelearning:
+		c.Interval = s.graduatingInterval(ease)
+		c.EaseFactor = factor
+	default:
+		c.EaseFactor = factor
+	}
+	if c.Interval > maxInterval {
+		c.Interval = maxInterval
+	}
+	lapse(c, r, prev, ease, s.LeechThreshold, s.LeechAction)
+	c.Queue, c.LearningStep = next, step
+	if delay > 0 {
+		c.Due = Due(reviewed).Add(delay)
+	} else {
+		c.Due = Due(reviewed).Add(c.Interval)
+	}
+	c.LastReview = reviewed
+	c.ReviewCount++
+	c.Modified = now().UTC()
+	r.Interval = c.Interval
+	r.SRSFactor = c.EaseFactor
+	return r, nil
+}
+
+func (s *SM2Scheduler) graduatingInterval(ease ReviewEase) Interval {
+	if ease == ReviewEaseEasy {
+		if s.EasyInterval > 0 {
+			return s.EasyInterval
+		}
+		return 4 * Day
+	}
+	if s.GraduatingInterval > 0 {
+		return s.GraduatingInterval
+	}
+	return Day
+}
+
+// sm2Interval calculates the next interval, given the previous interval. As
+// the card itself does not track the number of successive correct answers,
+// the first two repetitions are identified by their resulting intervals of one
+// and six days respectively. The result is limited to max, before it can
+// overflow.
+func sm2Interval(prev Interval, factor float32, quality int, max Interval) Interval {
+	if quality < 3 {
+		return Day
+	}
+	switch days := prev.Days(); {
+	case days == 0:
+		return Day
+	case days == 1:
+		return 6 * Day
+	default:
+		ivl := math.Ceil(float64(days) * float64(factor))
+		if ivl >= float64(max/Day) {
+			return max
+		}
+		return Interval(ivl) * Day
+	}
+}
+
+// sm2EaseFactor calculates the new ease factor following a response of the
+// given quality. The result is rounded to three decimal places, to avoid
+// accumulating floating point noise.
+func sm2EaseFactor(factor float32, quality int) float32 {
+	q := float64(5 - quality)
+	ef := float64(factor) + (0.1 - q*(0.08+q*0.02))
+	ef = math.Floor(ef*1000+0.5) / 1000
+	if ef < float64(MinEaseFactor) {
+		return MinEaseFactor
+	}
+	return float32(ef)
+}
@@ -0,0 +1,540 @@
+package fb
+
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestSM2Schedule(t *testing.T) {
+	const cardID = "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0"
+	tests := []struct {
+		name         string
+		scheduler    *SM2Scheduler
+		card         *Card
+		ease         ReviewEase
+		reviewed     string
+		expectedCard *Card
+		expected     *Review
+		err          string
+	}{
+		{
+			name: "invalid ease",
+			card: &Card{ID: cardID},
+			ease: 7,
+			err:  "invalid ease 7",
+		},
+		{
+			name: "invalid card",
+			card: &Card{},
+			ease: ReviewEaseOK,
+			err:  "card id required",
+		},
+		{
+			name: "invalid queue",
+			card: &Card{ID: cardID, Queue: 7},
+			ease: ReviewEaseOK,
+			err:  "card cannot move from queue 7 to 7",
+		},
+		{
+			name:     "new card",
+			card:     &Card{ID: cardID},
+			ease:     ReviewEaseOK,
+			reviewed: "2017-01-01T12:00:00Z",
+			expectedCard: &Card{
+				ID:           cardID,
+				Modified:     now(),
+				LastReview:   parseTime("2017-01-01T12:00:00Z"),
+				Queue:        QueueLearning,
+				LearningStep: 1,
+				Due:          parseDue("2017-01-01 12:10:00"),
+				EaseFactor:   2.5,
+				ReviewCount:  1,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:00:00Z"),
+				Ease:      ReviewEaseOK,
+				SRSFactor: 2.5,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:     "new card, easy",
+			card:     &Card{ID: cardID},
+			ease:     ReviewEaseEasy,
+			reviewed: "2017-01-01T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-01T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-05"),
+				Interval:    4 * Day,
+				EaseFactor:  2.5,
+				ReviewCount: 1,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:00:00Z"),
+				Ease:      ReviewEaseEasy,
+				Interval:  4 * Day,
+				SRSFactor: 2.5,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:     "learning, wrong",
+			card:     &Card{ID: cardID, Queue: QueueLearning, LearningStep: 1, EaseFactor: 2.5, ReviewCount: 1},
+			ease:     ReviewEaseWrong,
+			reviewed: "2017-01-01T12:10:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-01T12:10:00Z"),
+				Queue:       QueueLearning,
+				Due:         parseDue("2017-01-01 12:11:00"),
+				EaseFactor:  2.5,
+				ReviewCount: 2,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:10:00Z"),
+				Ease:      ReviewEaseWrong,
+				SRSFactor: 2.5,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:     "graduation",
+			card:     &Card{ID: cardID, Queue: QueueLearning, LearningStep: 1, EaseFactor: 2.5, ReviewCount: 1},
+			ease:     ReviewEaseOK,
+			reviewed: "2017-01-01T12:10:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-01T12:10:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-02"),
+				Interval:    Day,
+				EaseFactor:  2.5,
+				ReviewCount: 2,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:10:00Z"),
+				Ease:      ReviewEaseOK,
+				Interval:  Day,
+				SRSFactor: 2.5,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:      "custom graduating interval",
+			scheduler: &SM2Scheduler{LearningSteps: []Interval{}, GraduatingInterval: 3 * Day},
+			card:      &Card{ID: cardID},
+			ease:      ReviewEaseOK,
+			reviewed:  "2017-01-01T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-01T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-04"),
+				Interval:    3 * Day,
+				EaseFactor:  2.5,
+				ReviewCount: 1,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:00:00Z"),
+				Ease:      ReviewEaseOK,
+				Interval:  3 * Day,
+				SRSFactor: 2.5,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:      "custom initial ease",
+			scheduler: &SM2Scheduler{InitialEase: 2.3},
+			card:      &Card{ID: cardID},
+			ease:      ReviewEaseEasy,
+			reviewed:  "2017-01-01T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-01T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-05"),
+				Interval:    4 * Day,
+				EaseFactor:  2.3,
+				ReviewCount: 1,
+			},
+			expected: &Review{
+				CardID:    cardID,
+				Timestamp: parseTime("2017-01-01T12:00:00Z"),
+				Ease:      ReviewEaseEasy,
+				Interval:  4 * Day,
+				SRSFactor: 2.3,
+				Type:      ReviewTypeLearn,
+			},
+		},
+		{
+			name:      "max interval",
+			scheduler: &SM2Scheduler{MaxInterval: 30 * Day},
+			card:      &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 4},
+			ease:      ReviewEaseOK,
+			reviewed:  "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-02-22"),
+				Interval:    30 * Day,
+				EaseFactor:  2.5,
+				ReviewCount: 5,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseOK,
+				Interval:         30 * Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.5,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "second repetition",
+			card:     &Card{ID: cardID, Queue: QueueReview, Interval: Day, EaseFactor: 2.5, ReviewCount: 2},
+			ease:     ReviewEaseOK,
+			reviewed: "2017-01-02T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-02T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-08"),
+				Interval:    6 * Day,
+				EaseFactor:  2.5,
+				ReviewCount: 3,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-02T12:00:00Z"),
+				Ease:             ReviewEaseOK,
+				Interval:         6 * Day,
+				PreviousInterval: Day,
+				SRSFactor:        2.5,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "easy",
+			card:     &Card{ID: cardID, Queue: QueueReview, Interval: 6 * Day, EaseFactor: 2.5, ReviewCount: 3},
+			ease:     ReviewEaseEasy,
+			reviewed: "2017-01-08T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-08T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-23"),
+				Interval:    15 * Day,
+				EaseFactor:  2.6,
+				ReviewCount: 4,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-08T12:00:00Z"),
+				Ease:             ReviewEaseEasy,
+				Interval:         15 * Day,
+				PreviousInterval: 6 * Day,
+				SRSFactor:        2.6,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "hard",
+			card:     &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 4},
+			ease:     ReviewEaseHard,
+			reviewed: "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-03-02"),
+				Interval:    38 * Day,
+				EaseFactor:  2.36,
+				ReviewCount: 5,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseHard,
+				Interval:         38 * Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.36,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "legacy card without queue",
+			card:     &Card{ID: cardID, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 4},
+			ease:     ReviewEaseHard,
+			reviewed: "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-03-02"),
+				Interval:    38 * Day,
+				EaseFactor:  2.36,
+				ReviewCount: 5,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseHard,
+				Interval:         38 * Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.36,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "wrong",
+			card:     &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 4},
+			ease:     ReviewEaseWrong,
+			reviewed: "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueRelearning,
+				Due:         parseDue("2017-01-23 12:10:00"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 5,
+				LapseCount:  1,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:      "wrong without relearning steps",
+			scheduler: &SM2Scheduler{RelearningSteps: []Interval{}},
+			card:      &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 4},
+			ease:      ReviewEaseWrong,
+			reviewed:  "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-24"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 5,
+				LapseCount:  1,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeReview,
+			},
+		},
+		{
+			name:     "relearned",
+			card:     &Card{ID: cardID, Queue: QueueRelearning, Interval: Day, EaseFactor: 2.18, ReviewCount: 5},
+			ease:     ReviewEaseOK,
+			reviewed: "2017-01-23T12:10:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:10:00Z"),
+				Queue:       QueueReview,
+				Due:         parseDue("2017-01-24"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 6,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:10:00Z"),
+				Ease:             ReviewEaseOK,
+				Interval:         Day,
+				PreviousInterval: Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeRelearn,
+			},
+		},
+		{
+			name:      "leech suspended",
+			scheduler: &SM2Scheduler{LeechThreshold: 4},
+			card:      &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 10, LapseCount: 3},
+			ease:      ReviewEaseWrong,
+			reviewed:  "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueRelearning,
+				Suspended:   true,
+				Due:         parseDue("2017-01-23 12:10:00"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 11,
+				LapseCount:  4,
+				Leech:       true,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeReview,
+				Leech:            true,
+				Suspended:        true,
+			},
+		},
+		{
+			name:      "leech tagged",
+			scheduler: &SM2Scheduler{LeechThreshold: 4, LeechAction: LeechTagOnly},
+			card:      &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 2.5, ReviewCount: 10, LapseCount: 3},
+			ease:      ReviewEaseWrong,
+			reviewed:  "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueRelearning,
+				Due:         parseDue("2017-01-23 12:10:00"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 11,
+				LapseCount:  4,
+				Leech:       true,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeReview,
+				Leech:            true,
+			},
+		},
+		{
+			name:      "relearning failure is not a lapse",
+			scheduler: &SM2Scheduler{LeechThreshold: 1},
+			card:      &Card{ID: cardID, Queue: QueueRelearning, Interval: Day, EaseFactor: 2.18, ReviewCount: 5, LapseCount: 1},
+			ease:      ReviewEaseWrong,
+			reviewed:  "2017-01-23T12:10:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:10:00Z"),
+				Queue:       QueueRelearning,
+				Due:         parseDue("2017-01-23 12:20:00"),
+				Interval:    Day,
+				EaseFactor:  2.18,
+				ReviewCount: 6,
+				LapseCount:  1,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:10:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: Day,
+				SRSFactor:        2.18,
+				Type:             ReviewTypeRelearn,
+			},
+		},
+		{
+			name:     "minimum ease factor",
+			card:     &Card{ID: cardID, Queue: QueueReview, Interval: 15 * Day, EaseFactor: 1.4, ReviewCount: 4},
+			ease:     ReviewEaseWrong,
+			reviewed: "2017-01-23T12:00:00Z",
+			expectedCard: &Card{
+				ID:          cardID,
+				Modified:    now(),
+				LastReview:  parseTime("2017-01-23T12:00:00Z"),
+				Queue:       QueueRelearning,
+				Due:         parseDue("2017-01-23 12:10:00"),
+				Interval:    Day,
+				EaseFactor:  MinEaseFactor,
+				ReviewCount: 5,
+				LapseCount:  1,
+			},
+			expected: &Review{
+				CardID:           cardID,
+				Timestamp:        parseTime("2017-01-23T12:00:00Z"),
+				Ease:             ReviewEaseWrong,
+				Interval:         Day,
+				PreviousInterval: 15 * Day,
+				SRSFactor:        MinEaseFactor,
+				Type:             ReviewTypeReview,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.scheduler
+			if s == nil {
+				s = &SM2Scheduler{}
+			}
+			var reviewed = now()
+			if test.reviewed != "" {
+				reviewed = parseTime(test.reviewed)
+			}
+			result, err := s.Schedule(test.card, test.ease, reviewed)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+			if d := diff.Interface(test.expectedCard, test.card); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestSM2ScheduleMaxInterval(t *testing.T) {
+	s := &SM2Scheduler{}
+	c := &Card{ID: "card-abcde.mViuXQThMLoh1G1Nlc4d_E8kR8o.0", Queue: QueueReview, Interval: 4 * Day, EaseFactor: 2.5, Due: parseDue("2017-01-01")}
+	for i := 0; i < 30; i++ {
+		prev := c.Interval
+		if _, err := s.Schedule(c, ReviewEaseEasy, c.Due.Time()); err != nil {
+			t.Fatal(err)
+		}
+		if c.Interval < prev {
+			t.Fatalf("Interval decreased from %s to %s after %d reviews", prev, c.Interval, i+1)
+		}
+	}
+	if c.Interval != DefaultMaxInterval {
+		t.Errorf("Unexpected interval %s", c.Interval)
+	}
+}
@@ -0,0 +1,503 @@
+package fb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// packageSections lists the keys of a package which hold documents, in the
+// order in which a PackageWriter writes them. Themes precede notes, so that a
+// reader can assign each note its model as it is read.
+var packageSections = []string{"bundle", "themes", "deckConfigs", "decks", "filteredDecks", "notes", "cards", "reviews"}
+
+func sectionIndex(section string) int {
+	for i, s := range packageSections {
+		if s == section {
+			return i
+		}
+	}
+	return -1
+}
+
+// docSection returns the package key under which doc is stored.
+func docSection(doc interface{}) (string, error) {
+	switch doc.(type) {
+	case *Bundle:
+		return "bundle", nil
+	case *Theme:
+		return "themes", nil
+	case *DeckConfig:
+		return "deckConfigs", nil
+	case *Deck:
+		return "decks", nil
+	case *FilteredDeck:
+		return "filteredDecks", nil
+	case *Note:
+		return "notes", nil
+	case *Card:
+		return "cards", nil
+	case *Review:
+		return "reviews", nil
+	}
+	return "", errors.Errorf("%T is not a package document", doc)
+}
+
+// packageCheck performs the cross-document checks of Package.Validate, one
+// document at a time. Only IDs, and the models of themes, are retained.
+type packageCheck struct {
+	models map[string]*Model
+	// configs holds the deck configs seen, and configRefs the first deck to
+	// refer to each deck config.
+	configs    map[string]struct{}
+	configRefs map[string]string
+	// decks holds the ID and parent ID of each deck, and cardDecks the deck
+	// listing each card.
+	decks     []*Deck
+	cardDecks map[string]string
+	// deckCards holds cards listed in a deck, but not yet seen, and cards
+	// those seen, but not yet listed in a deck.
+	deckCards map[string]struct{}
+	cards     map[string]struct{}
+	// filtered holds the filtered deck listing each card, and cardIDs every
+	// card seen, against which the filtered decks are checked.
+	filtered map[string]string
+	cardIDs  map[string]struct{}
+	// notes holds the model key of notes read before their theme.
+	notes map[string]string
+}
+
+func newPackageCheck() *packageCheck {
+	return &packageCheck{
+		models:     make(map[string]*Model),
+		configs:    make(map[string]struct{}),
+		configRefs: make(map[string]string),
+		cardDecks:  make(map[string]string),
+		deckCards:  make(map[string]struct{}),
+		cards:      make(map[string]struct{}),
+		filtered:   make(map[string]string),
+		cardIDs:    make(map[string]struct{}),
+		notes:      make(map[string]string),
+	}
+}
+
+// add checks doc against the documents added so far. Any checks which depend
+// on documents not yet added are deferred until finish is called.
+func (pc *packageCheck) add(doc interface{}) error {
+	switch d := doc.(type) {
+	case *Theme:
+		for _, m := range d.Models {
+			pc.models[fmt.Sprintf("%s/%d", d.ID, m.ID)] = m
+		}
+	case *DeckConfig:
+		pc.configs[d.ID] = struct{}{}
+	case *Deck:
+		if _, ok := pc.configRefs[d.ConfigID]; d.ConfigID != "" && !ok {
+			pc.configRefs[d.ConfigID] = d.ID
+		}
+		pc.decks = append(pc.decks, &Deck{ID: d.ID, ParentID: d.ParentID})
+		if d.Cards == nil {
+			return nil
+		}
+		for _, id := range d.Cards.All() {
+			if other, ok := pc.cardDecks[id]; ok {
+				return errors.Errorf("card '%s' listed in decks '%s' and '%s'", id, other, d.ID)
+			}
+			pc.cardDecks[id] = d.ID
+			if _, ok := pc.cards[id]; ok {
+				delete(pc.cards, id)
+				continue
+			}
+			pc.deckCards[id] = struct{}{}
+		}
+	case *FilteredDeck:
+		for _, id := range d.Cards {
+			if other, ok := pc.filtered[id]; ok {
+				return errors.Errorf("card '%s' listed in filtered decks '%s' and '%s'", id, other, d.ID)
+			}
+			pc.filtered[id] = d.ID
+		}
+	case *Note:
+		key := fmt.Sprintf("%s/%d", d.ThemeID, d.ModelID)
+		if m, ok := pc.models[key]; ok {
+			d.Model = m
+			return nil
+		}
+		pc.notes[d.ID] = key
+	case *Card:
+		pc.cardIDs[d.ID] = struct{}{}
+		if _, ok := pc.deckCards[d.ID]; ok {
+			delete(pc.deckCards, d.ID)
+			return nil
+		}
+		pc.cards[d.ID] = struct{}{}
+	}
+	return nil
+}
+
+// finish performs the deferred checks, once all documents have been added.
+func (pc *packageCheck) finish() error {
+	for _, id := range sortedKeys(pc.configRefs) {
+		if _, ok := pc.configs[id]; !ok {
+			return errors.Errorf("deck config '%s' used by deck '%s' not found in package", id, pc.configRefs[id])
+		}
+	}
+	if ids := sortedSet(pc.deckCards); len(ids) > 0 {
+		return errors.Errorf("card '%s' listed in deck, but not found in package", ids[0])
+	}
+	v := newReporter()
+	buildDeckTree(pc.decks, v)
+	if err := v.report.Err(); err != nil {
+		return err
+	}
+	if ids := sortedSet(pc.cards); len(ids) > 0 {
+		return errors.Errorf("card '%s' found in package, but not in a deck", ids[0])
+	}
+	for _, id := range sortedKeys(pc.filtered) {
+		if _, ok := pc.cardIDs[id]; !ok {
+			return errors.Errorf("card '%s' listed in filtered deck, but not found in package", id)
+		}
+	}
+	for _, id := range sortedKeys(pc.notes) {
+		if _, ok := pc.models[pc.notes[id]]; !ok {
+			return errors.Errorf("note '%s' has no matching model (%s)", id, pc.notes[id])
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSet(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// PackageWriter writes a package one document at a time, so that the whole
+// package need never be held in memory. Documents must be written grouped by
+// type, in the order: bundle, themes, deck configs, decks, filtered decks,
+// notes, cards and reviews. Any type may be omitted.
+type PackageWriter struct {
+	w       io.Writer
+	check   *packageCheck
+	section int
+	count   int
+	err     error
+}
+
+// NewPackageWriter writes the package header to w, and returns a
+// PackageWriter to which the package documents may be written. Close must be
+// called once all documents have been written.
+func NewPackageWriter(w io.Writer, created, modified time.Time) (*PackageWriter, error) {
+	header, err := json.Marshal(struct {
+		Version  int       `json:"version"`
+		Created  time.Time `json:"created"`
+		Modified time.Time `json:"modified"`
+	}{
+		Version:  CurrentVersion,
+		Created:  created,
+		Modified: modified,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Drop the closing brace, to be written by Close
+	if _, err := w.Write(header[:len(header)-1]); err != nil {
+		return nil, err
+	}
+	return &PackageWriter{
+		w:       w,
+		check:   newPackageCheck(),
+		section: -1,
+	}, nil
+}
+
+// Write validates doc, which must be one of *Bundle, *Theme, *DeckConfig,
+// *Deck, *FilteredDeck, *Note, *Card or *Review, and writes it to the
+// package. Once Write has returned an error, all further writes fail.
+func (pw *PackageWriter) Write(doc interface{}) error {
+	if pw.err != nil {
+		return pw.err
+	}
+	pw.err = pw.write(doc)
+	return pw.err
+}
+
+func (pw *PackageWriter) write(doc interface{}) error {
+	if pw.check == nil {
+		return errors.New("package writer closed")
+	}
+	section, err := docSection(doc)
+	if err != nil {
+		return err
+	}
+	idx := sectionIndex(section)
+	switch {
+	case idx < pw.section:
+		return errors.Errorf("%s must be written before %s", section, packageSections[pw.section])
+	case idx == pw.section && section == "bundle":
+		return errors.New("bundle already written")
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return errors.Wrapf(err, "%s %d", section, pw.count)
+	}
+	if err := pw.check.add(doc); err != nil {
+		return err
+	}
+	var prefix string
+	if idx > pw.section {
+		prefix = pw.closeSection() + `,"` + section + `":`
+		if section != "bundle" {
+			prefix += "["
+		}
+		pw.section = idx
+		pw.count = 0
+	} else {
+		prefix = ","
+	}
+	if _, err := io.WriteString(pw.w, prefix); err != nil {
+		return err
+	}
+	if _, err := pw.w.Write(data); err != nil {
+		return err
+	}
+	pw.count++
+	return nil
+}
+
+// closeSection returns the text needed to end the current section.
+func (pw *PackageWriter) closeSection() string {
+	if pw.section > 0 {
+		return "]"
+	}
+	return ""
+}
+
+// Close completes the package, and returns an error if the cross-document
+// checks of Package.Validate fail. It does not close the underlying writer.
+func (pw *PackageWriter) Close() error {
+	if pw.err != nil {
+		return pw.err
+	}
+	if pw.check == nil {
+		return errors.New("package writer closed")
+	}
+	if _, err := io.WriteString(pw.w, pw.closeSection()+"}"); err != nil {
+		pw.err = err
+		return err
+	}
+	pw.err = pw.check.finish()
+	pw.check = nil
+	return pw.err
+}
+
+// PackageReader reads a package one document at a time, as written by
+// PackageWriter or Package.MarshalJSON, so that the whole package need never
+// be held in memory. Only the themes, which hold the models needed by notes,
+// are retained between documents. Packages of older format versions are
+// upgraded as they are read, as by Package.Migrate.
+type PackageReader struct {
+	dec      *json.Decoder
+	check    *packageCheck
+	section  string
+	version  int
+	created  time.Time
+	modified time.Time
+	changes  []string
+	err      error
+}
+
+// NewPackageReader returns a PackageReader reading the package from r.
+func NewPackageReader(r io.Reader) (*PackageReader, error) {
+	dec := json.NewDecoder(r)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	if tok != json.Delim('{') {
+		return nil, errors.New("package must be a JSON object")
+	}
+	return &PackageReader{
+		dec:   dec,
+		check: newPackageCheck(),
+	}, nil
+}
+
+// Next returns the next document of the package, which is one of *Bundle,
+// *Theme, *DeckConfig, *Deck, *FilteredDeck, *Note, *Card or *Review. Each is validated as
+// it is read. Notes are assigned their model, if their theme has already
+// been read. Once all documents have been read, and the cross-document checks
+// of Package.Validate have passed, Next returns io.EOF.
+func (pr *PackageReader) Next() (interface{}, error) {
+	if pr.err != nil {
+		return nil, pr.err
+	}
+	doc, err := pr.next()
+	if err != nil {
+		pr.err = err
+		return nil, err
+	}
+	if err := pr.check.add(doc); err != nil {
+		pr.err = err
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (pr *PackageReader) next() (interface{}, error) {
+	for {
+		if pr.section != "" {
+			if pr.dec.More() {
+				return pr.decode(pr.section)
+			}
+			if _, err := pr.dec.Token(); err != nil {
+				return nil, err
+			}
+			pr.section = ""
+		}
+		if !pr.dec.More() {
+			return nil, pr.finish()
+		}
+		tok, err := pr.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		switch key {
+		case "version":
+			if err := pr.dec.Decode(&pr.version); err != nil {
+				return nil, err
+			}
+			if err := checkVersion(pr.version); err != nil {
+				return nil, err
+			}
+		case "created":
+			if err := pr.dec.Decode(&pr.created); err != nil {
+				return nil, err
+			}
+		case "modified":
+			if err := pr.dec.Decode(&pr.modified); err != nil {
+				return nil, err
+			}
+		case "bundle":
+			return pr.decode(key)
+		default:
+			if sectionIndex(key) < 0 {
+				// Unknown keys are ignored, as by json.Unmarshal
+				var skip json.RawMessage
+				if err := pr.dec.Decode(&skip); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			tok, err := pr.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			switch tok {
+			case nil:
+			case json.Delim('['):
+				pr.section = key
+			default:
+				return nil, errors.Errorf("%s must be an array", key)
+			}
+		}
+	}
+}
+
+func (pr *PackageReader) decode(section string) (interface{}, error) {
+	var doc interface{}
+	switch section {
+	case "bundle":
+		doc = &Bundle{}
+	case "themes":
+		return pr.decodeTheme()
+	case "deckConfigs":
+		doc = &DeckConfig{}
+	case "decks":
+		doc = &Deck{}
+	case "filteredDecks":
+		doc = &FilteredDeck{}
+	case "notes":
+		doc = &Note{}
+	case "cards":
+		doc = &Card{}
+	case "reviews":
+		doc = &Review{}
+	}
+	if err := pr.dec.Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// decodeTheme decodes the next theme, recording the changes made in
+// migrating it from an older form. See migrateV2.
+func (pr *PackageReader) decodeTheme() (interface{}, error) {
+	var raw json.RawMessage
+	if err := pr.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	t := &Theme{}
+	changes, err := t.unmarshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		pr.changes = append(pr.changes, fmt.Sprintf("theme '%s': %s", t.ID, change))
+	}
+	return t, nil
+}
+
+func (pr *PackageReader) finish() error {
+	if _, err := pr.dec.Token(); err != nil {
+		return err
+	}
+	if err := checkVersion(pr.version); err != nil {
+		return err
+	}
+	if err := pr.check.finish(); err != nil {
+		return err
+	}
+	return io.EOF
+}
+
+// Version returns the format version of the package. As the version may
+// follow the documents in the package, it is only certain to be known once
+// Next has returned io.EOF.
+func (pr *PackageReader) Version() int { return pr.version }
+
+// Migration returns a report of the changes made in upgrading the package
+// from an older format version. Like Version, it is only certain to be
+// complete once Next has returned io.EOF.
+func (pr *PackageReader) Migration() *MigrationReport {
+	report := &MigrationReport{From: pr.version, To: CurrentVersion}
+	if report.Migrated() {
+		report.Changes = pr.changes
+	}
+	return report
+}
+
+// Created returns the package creation time. Like Version, it is only certain
+// to be known once Next has returned io.EOF.
+func (pr *PackageReader) Created() time.Time { return pr.created }
+
+// Modified returns the package modification time. Like Version, it is only
+// certain to be known once Next has returned io.EOF.
+func (pr *PackageReader) Modified() time.Time { return pr.modified }
@@ -0,0 +1,399 @@
+package fb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func testStreamPackage() *Package {
+	theme, _ := NewTheme("theme-abcd")
+	model, _ := theme.NewModel("foo")
+	_, _ = model.AddTemplate("Card 1", "{{Front}}", "{{Back}}")
+	dconf, _ := NewDeckConfig("dconf-ZGNvbmY")
+	deck, _ := NewDeck("deck-ZGVjaw")
+	deck.ConfigID = dconf.ID
+	deck.AddCard("card-YmFy.bmlsCg.0")
+	note, _ := NewNote("note-Zm9v", model)
+	card, _ := NewCard("theme-abcd", 0, "card-YmFy.bmlsCg.0")
+	fdeck, _ := NewFilteredDeck("fdeck-ZmRlY2s", "is:due")
+	fdeck.Cards = []string{card.ID}
+	card.Deck = fdeck.ID
+	card.HomeDeck = deck.ID
+	review, _ := NewReview(card.ID)
+	return &Package{
+		Created:       now(),
+		Modified:      now(),
+		Bundle:        &Bundle{ID: "bundle-mzxw6", Owner: "mjxwe", Created: now(), Modified: now()},
+		Themes:        []*Theme{theme},
+		DeckConfigs:   []*DeckConfig{dconf},
+		Decks:         []*Deck{deck},
+		FilteredDecks: []*FilteredDeck{fdeck},
+		Notes:         []*Note{note},
+		Cards:         []*Card{card},
+		Reviews:       []*Review{review},
+	}
+}
+
+// packageDocs returns the documents of p in the order written by
+// PackageWriter.
+func packageDocs(p *Package) []interface{} {
+	docs := []interface{}{p.Bundle}
+	for _, t := range p.Themes {
+		docs = append(docs, t)
+	}
+	for _, dc := range p.DeckConfigs {
+		docs = append(docs, dc)
+	}
+	for _, d := range p.Decks {
+		docs = append(docs, d)
+	}
+	for _, fd := range p.FilteredDecks {
+		docs = append(docs, fd)
+	}
+	for _, n := range p.Notes {
+		docs = append(docs, n)
+	}
+	for _, c := range p.Cards {
+		docs = append(docs, c)
+	}
+	for _, r := range p.Reviews {
+		docs = append(docs, r)
+	}
+	return docs
+}
+
+func readAll(data []byte) ([]interface{}, *PackageReader, error) {
+	pr, err := NewPackageReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, nil, err
+	}
+	var docs []interface{}
+	for {
+		doc, err := pr.Next()
+		if err == io.EOF {
+			return docs, pr, nil
+		}
+		if err != nil {
+			return docs, pr, err
+		}
+		docs = append(docs, doc)
+	}
+}
+
+func TestPackageWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		docs     []interface{}
+		expected string
+		err      string
+	}{
+		{
+			name:     "empty",
+			expected: `{"version":3, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z"}`,
+		},
+		{
+			name: "not a document",
+			docs: []interface{}{"foo"},
+			err:  "string is not a package document",
+		},
+		{
+			name: "invalid document",
+			docs: []interface{}{&Card{}},
+			err:  "cards 0: json: error calling MarshalJSON for type *fb.Card: validation error: id required",
+		},
+		{
+			name: "out of order",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				return []interface{}{p.Cards[0], p.Decks[0]}
+			}(),
+			err: "decks must be written before cards",
+		},
+		{
+			name: "second bundle",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				return []interface{}{p.Bundle, p.Bundle}
+			}(),
+			err: "bundle already written",
+		},
+		{
+			name: "card not in deck",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				return []interface{}{p.Cards[0]}
+			}(),
+			err: "card 'card-YmFy.bmlsCg.0' found in package, but not in a deck",
+		},
+		{
+			name: "missing card",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				p.Decks[0].ConfigID = ""
+				return []interface{}{p.Decks[0]}
+			}(),
+			err: "card 'card-YmFy.bmlsCg.0' listed in deck, but not found in package",
+		},
+		{
+			name: "missing deck config",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				return []interface{}{p.Decks[0], p.Cards[0]}
+			}(),
+			err: "deck config 'dconf-ZGNvbmY' used by deck 'deck-ZGVjaw' not found in package",
+		},
+		{
+			name: "card in two decks",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				p.Decks[0].ConfigID = ""
+				other, _ := NewDeck("deck-b3RoZXI")
+				other.AddCard("card-YmFy.bmlsCg.0")
+				return []interface{}{p.Decks[0], other}
+			}(),
+			err: "card 'card-YmFy.bmlsCg.0' listed in decks 'deck-ZGVjaw' and 'deck-b3RoZXI'",
+		},
+		{
+			name: "missing parent deck",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				p.Decks[0].ConfigID = ""
+				p.Decks[0].ParentID = "deck-Zm9v"
+				return []interface{}{p.Decks[0], p.Cards[0]}
+			}(),
+			err: "parent deck 'deck-Zm9v' of deck 'deck-ZGVjaw' not found",
+		},
+		{
+			name: "missing filtered card",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				p.FilteredDecks[0].Cards = []string{"card-YmFy.bmlsCg.1"}
+				return []interface{}{p.FilteredDecks[0]}
+			}(),
+			err: "card 'card-YmFy.bmlsCg.1' listed in filtered deck, but not found in package",
+		},
+		{
+			name: "card in two filtered decks",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				other, _ := NewFilteredDeck("fdeck-b3RoZXI", "is:due")
+				other.Cards = []string{"card-YmFy.bmlsCg.0"}
+				return []interface{}{p.FilteredDecks[0], other}
+			}(),
+			err: "card 'card-YmFy.bmlsCg.0' listed in filtered decks 'fdeck-ZmRlY2s' and 'fdeck-b3RoZXI'",
+		},
+		{
+			name: "deck and card",
+			docs: func() []interface{} {
+				p := testStreamPackage()
+				p.Decks[0].ConfigID = ""
+				return []interface{}{p.Decks[0], p.FilteredDecks[0], p.Cards[0]}
+			}(),
+			expected: `{"version":3, "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z",
+				"decks": [{"_id":"deck-ZGVjaw", "type":"deck", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "cards":["card-YmFy.bmlsCg.0"]}],
+				"filteredDecks": [{"_id":"fdeck-ZmRlY2s", "type":"filteredDeck", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z",
+					"query":"is:due", "order":0, "limit":100, "reschedule":true, "cards":["card-YmFy.bmlsCg.0"]}],
+				"cards": [{"_id":"card-YmFy.bmlsCg.0", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "model": "theme-abcd/0",
+					"deck":"fdeck-ZmRlY2s", "homeDeck":"deck-ZGVjaw"}]
+			}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			pw, err := NewPackageWriter(buf, now(), now())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, doc := range test.docs {
+				if err = pw.Write(doc); err != nil {
+					break
+				}
+			}
+			if err == nil {
+				err = pw.Close()
+			}
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if d := diff.JSON([]byte(test.expected), buf.Bytes()); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestPackageWriterClosed(t *testing.T) {
+	pw, _ := NewPackageWriter(&bytes.Buffer{}, now(), now())
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	checkErr(t, "package writer closed", pw.Write(testStreamPackage().Bundle))
+	checkErr(t, "package writer closed", pw.Close())
+}
+
+func TestPackageStreamRoundTrip(t *testing.T) {
+	p := testStreamPackage()
+	buf := &bytes.Buffer{}
+	pw, err := NewPackageWriter(buf, p.Created, p.Modified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, doc := range packageDocs(p) {
+		if err := pw.Write(doc); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	t.Run("PackageReader", func(t *testing.T) {
+		docs, pr, err := readAll(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(packageDocs(p), docs); d != nil {
+			t.Error(d)
+		}
+		if note := docs[5].(*Note); note.Model != docs[1].(*Theme).Models[0] {
+			t.Errorf("Note model not assigned")
+		}
+		if pr.Version() != CurrentVersion || !pr.Created().Equal(now()) || !pr.Modified().Equal(now()) {
+			t.Errorf("Unexpected header: %d, %s, %s", pr.Version(), pr.Created(), pr.Modified())
+		}
+	})
+	t.Run("Unmarshal", func(t *testing.T) {
+		result := &Package{}
+		if err := json.Unmarshal(buf.Bytes(), result); err != nil {
+			t.Fatal(err)
+		}
+		if d := diff.AsJSON(p, result); d != nil {
+			t.Error(d)
+		}
+	})
+}
+
+func TestPackageReader(t *testing.T) {
+	const card = `{"_id":"card-YmFy.bmlsCg.0", "type":"card", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "model": "theme-abcd/0"}`
+	const deck = `{"_id":"deck-ZGVjaw", "type":"deck", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "cards":["card-YmFy.bmlsCg.0"]}`
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+		err      string
+	}{
+		{
+			name:  "invalid json",
+			input: "invalid json",
+			err:   "invalid character 'i' looking for beginning of value",
+		},
+		{
+			name:  "not an object",
+			input: "[]",
+			err:   "package must be a JSON object",
+		},
+		{
+			name:  "no version",
+			input: "{}",
+			err:   "package version 0 < 1",
+		},
+		{
+			name:  "too new",
+			input: `{"version":4, "cards":[` + card + `]}`,
+			err:   "package version 4 is newer than the supported version 3",
+		},
+		{
+			name:  "section not an array",
+			input: `{"version":3, "cards":{}}`,
+			err:   "cards must be an array",
+		},
+		{
+			name:  "invalid document",
+			input: `{"version":3, "cards":[{"type":"card"}]}`,
+			err:   "validation error: id required",
+		},
+		{
+			name:  "card not in deck",
+			input: `{"version":3, "cards":[` + card + `]}`,
+			err:   "card 'card-YmFy.bmlsCg.0' found in package, but not in a deck",
+		},
+		{
+			name:  "note without model",
+			input: `{"version":3, "notes":[{"_id":"note-Zm9v", "type":"note", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "_attachments":{}, "fieldValues":null, "theme":"theme-abcd", "model":0}]}`,
+			err:   "note 'note-Zm9v' has no matching model (theme-abcd/0)",
+		},
+		{
+			name: "deck cycle",
+			input: `{"version":3, "decks":[{"_id":"deck-AQ", "type":"deck", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "parent":"deck-Ag", "cards":[]},
+				{"_id":"deck-Ag", "type":"deck", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "parent":"deck-AQ", "cards":[]}]}`,
+			err: "deck 'deck-AQ' is its own ancestor",
+		},
+		{
+			name:     "cards before deck, version last",
+			input:    `{"cards":[` + card + `], "unknown":{"foo":[1,2]}, "themes":null, "decks":[` + deck + `], "version":2}`,
+			expected: 2,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs, _, err := readAll([]byte(test.input))
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			if len(docs) != test.expected {
+				t.Errorf("Expected %d documents, got %d", test.expected, len(docs))
+			}
+		})
+	}
+}
+
+func TestPackageReaderMarshaled(t *testing.T) {
+	// Package.MarshalJSON writes notes before themes
+	p := testStreamPackage()
+	data, err := json.Marshal(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Index(string(data), `"notes"`) > strings.Index(string(data), `"themes"`) {
+		t.Fatal("Expected notes to precede themes")
+	}
+	docs, _, err := readAll(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != len(packageDocs(p)) {
+		t.Errorf("Expected %d documents, got %d", len(packageDocs(p)), len(docs))
+	}
+}
+
+func TestPackageReaderMigration(t *testing.T) {
+	input := `{"version":2, "themes":[{"_id":"theme-abcd", "type":"theme", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "modelSequence":1, "files":[],
+		"_attachments":{
+			"Card 1.question.html": {"content_type":"text/html", "data":"e3tGcm9udH19"},
+			"Card 1.answer.html": {"content_type":"text/html", "data":"e3tCYWNrfX0="}
+		},
+		"models":[{"id":0, "modelType":"foo", "files":["Card 1.answer.html", "Card 1.question.html"], "templates":["Card 1"]}]}]}`
+	docs, pr, err := readAll([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &MigrationReport{
+		From:    2,
+		To:      3,
+		Changes: []string{"theme 'theme-abcd': model 0: moved template 'Card 1' into model"},
+	}
+	if d := diff.Interface(expected, pr.Migration()); d != nil {
+		t.Error(d)
+	}
+	m := docs[0].(*Theme).Models[0]
+	if d := diff.Interface([]*Template{{Name: "Card 1", Question: "{{Front}}", Answer: "{{Back}}"}}, m.Templates); d != nil {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,203 @@
+package fb
+
+import (
+	"math/rand"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// CardLookup returns the card with the requested ID.
+type CardLookup func(id string) (*Card, error)
+
+// StudyOptions modifies the selection of cards by BuildStudyQueue.
+type StudyOptions struct {
+	// Limit is the maximum number of cards to return. Zero means no limit.
+	Limit int
+	// NewDone and ReviewsDone are the number of new cards and reviews already
+	// studied today, which count against the deck's daily limits.
+	NewDone     int
+	ReviewsDone int
+}
+
+// BuildStudyQueue returns the cards of d which are due for study now, in the
+// order they should be studied. Cards in the learning queues are returned
+// first, followed by due review cards with new cards spread evenly amongst
+// them. Suspended and buried cards are skipped, as are cards currently in a
+// filtered deck, and the daily new card and review limits of conf are
+// applied. If conf buries new or review siblings, only the first card of each
+// note is included. If conf is nil, the default settings are used. lookup is
+// called to fetch each card in the deck.
+func BuildStudyQueue(d *Deck, conf *DeckConfig, lookup CardLookup, opts StudyOptions) ([]*Card, error) {
+	if conf == nil {
+		conf = defaultDeckConfig()
+	}
+	var learning, reviews, news []*Card
+	notes := make(map[*Card]NoteID)
+	current := Now()
+	var ids []string
+	if d.Cards != nil {
+		ids = d.Cards.All()
+	}
+	for _, id := range ids {
+		c, err := lookupCard(lookup, id)
+		if err != nil {
+			return nil, err
+		}
+		if c.Suspended || c.IsBuried() || c.Deck != d.ID || c.HomeDeck != "" {
+			continue
+		}
+		noteID, err := c.NoteID()
+		if err != nil {
+			return nil, errors.Wrapf(err, "card '%s'", id)
+		}
+		notes[c] = noteID
+		switch c.queue() {
+		case QueueNew:
+			news = append(news, c)
+		case QueueReview:
+			if !c.Due.After(current) {
+				reviews = append(reviews, c)
+			}
+		default:
+			if !c.Due.After(current) {
+				learning = append(learning, c)
+			}
+		}
+	}
+	sortByDue(learning)
+	sortByDue(reviews)
+	seen := make(map[NoteID]bool)
+	for _, c := range learning {
+		seen[notes[c]] = true
+	}
+	if conf.Reviews.Bury {
+		reviews = skipSiblings(reviews, notes, seen)
+	}
+	reviews = limitCards(reviews, conf.Reviews.PerDay-opts.ReviewsDone)
+	for _, c := range reviews {
+		seen[notes[c]] = true
+	}
+	if conf.New.Order == NewCardsRandom {
+		shuffleCards(news)
+	} else {
+		sort.SliceStable(news, func(i, j int) bool {
+			return news[i].Created.Before(news[j].Created)
+		})
+	}
+	if conf.New.Bury {
+		news = skipSiblings(news, notes, seen)
+	}
+	news = limitCards(news, conf.New.PerDay-opts.NewDone)
+
+	queue := append(learning, interleave(reviews, news)...)
+	if opts.Limit > 0 {
+		queue = limitCards(queue, opts.Limit)
+	}
+	return queue, nil
+}
+
+// BuildStudyQueue returns the cards of the filtered deck which may be studied
+// now, in the order they should be studied. Cards in the learning queues
+// which are due are returned first, followed by the remaining cards in the
+// deck's order, whether or not they are due. Learning cards not yet due are
+// skipped, as are suspended and buried cards, and those which have since left
+// the deck. Daily limits do not apply to filtered decks, so only opts.Limit
+// is used. lookup is called to fetch each card in the deck.
+func (fd *FilteredDeck) BuildStudyQueue(lookup CardLookup, opts StudyOptions) ([]*Card, error) {
+	var learning, others []*Card
+	current := Now()
+	for _, id := range fd.Cards {
+		c, err := lookupCard(lookup, id)
+		if err != nil {
+			return nil, err
+		}
+		if c.Suspended || c.IsBuried() || c.Deck != fd.ID {
+			continue
+		}
+		if !c.queue().learning() {
+			others = append(others, c)
+			continue
+		}
+		if !c.Due.After(current) {
+			learning = append(learning, c)
+		}
+	}
+	sortByDue(learning)
+	queue := append(learning, others...)
+	if opts.Limit > 0 {
+		queue = limitCards(queue, opts.Limit)
+	}
+	return queue, nil
+}
+
+// lookupCard returns the card with the requested ID, or an error if it is not
+// found.
+func lookupCard(lookup CardLookup, id string) (*Card, error) {
+	c, err := lookup(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "card '%s'", id)
+	}
+	if c == nil {
+		return nil, errors.Errorf("card '%s' not found", id)
+	}
+	return c, nil
+}
+
+// shuffleCards shuffles cards randomly. The shuffle is seeded by date, so
+// the order is stable throughout the day.
+func shuffleCards(cards []*Card) {
+	rnd := rand.New(rand.NewSource(Today().Time().Unix()))
+	for i := len(cards) - 1; i > 0; i-- {
+		j := rnd.Intn(i + 1)
+		cards[i], cards[j] = cards[j], cards[i]
+	}
+}
+
+// sortByDue sorts cards by due date, breaking ties by ID.
+func sortByDue(cards []*Card) {
+	sort.Slice(cards, func(i, j int) bool {
+		if cards[i].Due.Equal(cards[j].Due) {
+			return cards[i].ID < cards[j].ID
+		}
+		return cards[j].Due.After(cards[i].Due)
+	})
+}
+
+// skipSiblings returns those of cards whose note, as given by notes, has not
+// been seen, marking each note as seen as it goes.
+func skipSiblings(cards []*Card, notes map[*Card]NoteID, seen map[NoteID]bool) []*Card {
+	result := make([]*Card, 0, len(cards))
+	for _, c := range cards {
+		if seen[notes[c]] {
+			continue
+		}
+		seen[notes[c]] = true
+		result = append(result, c)
+	}
+	return result
+}
+
+func limitCards(cards []*Card, limit int) []*Card {
+	if limit < 0 {
+		limit = 0
+	}
+	if len(cards) > limit {
+		return cards[:limit]
+	}
+	return cards
+}
+
+// interleave spreads news evenly between reviews.
+func interleave(reviews, news []*Card) []*Card {
+	result := make([]*Card, 0, len(reviews)+len(news))
+	var r int
+	for i, c := range news {
+		until := ((i+1)*len(reviews) + (len(news)+1)/2) / (len(news) + 1)
+		for ; r < until; r++ {
+			result = append(result, reviews[r])
+		}
+		result = append(result, c)
+	}
+	return append(result, reviews[r:]...)
+}
@@ -0,0 +1,411 @@
+package fb
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestBuildStudyQueue(t *testing.T) {
+	card := func(id string, fn func(c *Card)) *Card {
+		c := &Card{ID: "card-abcd.note" + id + ".0", Deck: "deck-AQ", Created: parseTime("2016-12-01T00:00:00Z")}
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+	review := func(id, due string) *Card {
+		return card(id, func(c *Card) {
+			c.Queue = QueueReview
+			c.Interval = 2 * Day
+			c.Due = parseDue(due)
+		})
+	}
+	newCard := func(id, created string) *Card {
+		return card(id, func(c *Card) { c.Created = parseTime(created) })
+	}
+	tests := []struct {
+		name     string
+		cards    []*Card
+		lookup   CardLookup
+		conf     *DeckConfig
+		opts     StudyOptions
+		expected []string
+		err      string
+	}{
+		{
+			name:  "lookup failure",
+			cards: []*Card{review("a", "2017-01-01")},
+			lookup: func(_ string) (*Card, error) {
+				return nil, errors.New("db failure")
+			},
+			err: "card 'card-abcd.notea.0': db failure",
+		},
+		{
+			name:  "card not found",
+			cards: []*Card{review("a", "2017-01-01")},
+			lookup: func(_ string) (*Card, error) {
+				return nil, nil
+			},
+			err: "card 'card-abcd.notea.0' not found",
+		},
+		{
+			name:  "invalid card ID",
+			cards: []*Card{review("a", "2017-01-01")},
+			lookup: func(_ string) (*Card, error) {
+				return &Card{ID: "card-abcd", Deck: "deck-AQ"}, nil
+			},
+			err: "card 'card-abcd.notea.0': invalid ID format",
+		},
+		{
+			name: "empty deck",
+		},
+		{
+			name: "due reviews",
+			cards: []*Card{
+				review("a", "2017-01-01"),
+				review("b", "2016-12-25"),
+				review("c", "2017-01-02"),
+			},
+			expected: []string{"b", "a"},
+		},
+		{
+			name: "suspended and buried skipped",
+			cards: []*Card{
+				review("a", "2017-01-01"),
+				card("b", func(c *Card) { c.Suspended = true }),
+				card("c", func(c *Card) { c.BuriedUntil = parseDue("2017-01-02") }),
+				card("d", func(c *Card) { c.BuriedUntil = parseDue("2017-01-01") }),
+			},
+			expected: []string{"a", "d"},
+		},
+		{
+			name: "cards in other decks skipped",
+			cards: []*Card{
+				review("a", "2017-01-01"),
+				card("b", func(c *Card) {
+					c.Deck = "fdeck-AQ"
+					c.HomeDeck = "deck-AQ"
+				}),
+				card("c", func(c *Card) { c.Deck = "deck-Ag" }),
+			},
+			expected: []string{"a"},
+		},
+		{
+			name: "learning first",
+			cards: []*Card{
+				review("a", "2016-12-31"),
+				card("b", func(c *Card) {
+					c.Queue = QueueRelearning
+					c.Due = parseDue("2016-12-31 23:58:00")
+				}),
+				card("c", func(c *Card) {
+					c.Queue = QueueLearning
+					c.Due = parseDue("2016-12-31 23:50:00")
+				}),
+				card("d", func(c *Card) {
+					c.Queue = QueueLearning
+					c.Due = parseDue("2017-01-01 00:10:00")
+				}),
+			},
+			expected: []string{"c", "b", "a"},
+		},
+		{
+			name: "new cards in order",
+			cards: []*Card{
+				newCard("a", "2016-12-03T00:00:00Z"),
+				newCard("b", "2016-12-01T00:00:00Z"),
+				newCard("c", "2016-12-02T00:00:00Z"),
+			},
+			expected: []string{"b", "c", "a"},
+		},
+		{
+			name: "new cards interleaved",
+			cards: []*Card{
+				review("a", "2016-12-27"),
+				review("b", "2016-12-28"),
+				review("c", "2016-12-29"),
+				review("d", "2016-12-30"),
+				newCard("e", "2016-12-03T00:00:00Z"),
+				newCard("f", "2016-12-04T00:00:00Z"),
+			},
+			expected: []string{"a", "e", "b", "c", "f", "d"},
+		},
+		{
+			name: "daily limits",
+			cards: []*Card{
+				review("a", "2016-12-27"),
+				review("b", "2016-12-28"),
+				review("c", "2016-12-29"),
+				newCard("d", "2016-12-03T00:00:00Z"),
+				newCard("e", "2016-12-04T00:00:00Z"),
+			},
+			conf: &DeckConfig{
+				New:     NewCardConfig{PerDay: 2},
+				Reviews: ReviewConfig{PerDay: 3},
+			},
+			opts:     StudyOptions{NewDone: 1, ReviewsDone: 1},
+			expected: []string{"a", "d", "b"},
+		},
+		{
+			name: "limits exhausted",
+			cards: []*Card{
+				review("a", "2016-12-27"),
+				newCard("b", "2016-12-03T00:00:00Z"),
+			},
+			conf: &DeckConfig{
+				New:     NewCardConfig{PerDay: 2},
+				Reviews: ReviewConfig{PerDay: 3},
+			},
+			opts: StudyOptions{NewDone: 5, ReviewsDone: 5},
+		},
+		{
+			name: "siblings buried",
+			cards: []*Card{
+				card("a", func(c *Card) {
+					c.Queue = QueueLearning
+					c.Due = parseDue("2016-12-31 23:50:00")
+				}),
+				card("a", func(c *Card) {
+					c.ID = "card-abcd.notea.1"
+					c.Queue = QueueReview
+					c.Interval = 2 * Day
+					c.Due = parseDue("2016-12-27")
+				}),
+				review("b", "2016-12-28"),
+				card("b", func(c *Card) { c.ID = "card-abcd.noteb.1" }),
+				newCard("c", "2016-12-03T00:00:00Z"),
+			},
+			conf: &DeckConfig{
+				New:     NewCardConfig{PerDay: 20, Bury: true},
+				Reviews: ReviewConfig{PerDay: 200, Bury: true},
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name: "siblings not buried",
+			cards: []*Card{
+				review("b", "2016-12-28"),
+				card("b", func(c *Card) { c.ID = "card-abcd.noteb.1" }),
+			},
+			expected: []string{"b", "b"},
+		},
+		{
+			name: "overall limit",
+			cards: []*Card{
+				review("a", "2016-12-27"),
+				review("b", "2016-12-28"),
+				review("c", "2016-12-29"),
+			},
+			opts:     StudyOptions{Limit: 2},
+			expected: []string{"a", "b"},
+		},
+		{
+			name: "random order",
+			cards: []*Card{
+				newCard("a", "2016-12-01T00:00:00Z"),
+				newCard("b", "2016-12-02T00:00:00Z"),
+				newCard("c", "2016-12-03T00:00:00Z"),
+				newCard("d", "2016-12-04T00:00:00Z"),
+			},
+			conf: &DeckConfig{
+				New:     NewCardConfig{PerDay: 20, Order: NewCardsRandom},
+				Reviews: ReviewConfig{PerDay: 200},
+			},
+			expected: []string{"d", "c", "b", "a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			deck := &Deck{ID: "deck-AQ", Cards: NewCardCollection()}
+			cards := make(map[string]*Card)
+			for _, c := range test.cards {
+				deck.Cards.col[c.ID] = struct{}{}
+				cards[c.ID] = c
+			}
+			lookup := test.lookup
+			if lookup == nil {
+				lookup = func(id string) (*Card, error) {
+					return cards[id], nil
+				}
+			}
+			result, err := BuildStudyQueue(deck, test.conf, lookup, test.opts)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, c := range result {
+				ids = append(ids, c.ID[len("card-abcd.note"):len(c.ID)-2])
+			}
+			if d := diff.Interface(test.expected, ids); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestFilteredDeckBuildStudyQueue(t *testing.T) {
+	card := func(id string, fn func(c *Card)) *Card {
+		c := &Card{ID: "card-abcd.note" + id + ".0", Deck: "fdeck-AQ", HomeDeck: "deck-AQ"}
+		if fn != nil {
+			fn(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name     string
+		cards    []*Card
+		lookup   CardLookup
+		opts     StudyOptions
+		expected []string
+		err      string
+	}{
+		{
+			name:  "card not found",
+			cards: []*Card{card("a", nil)},
+			lookup: func(_ string) (*Card, error) {
+				return nil, nil
+			},
+			err: "card 'card-abcd.notea.0' not found",
+		},
+		{
+			name: "empty deck",
+		},
+		{
+			name: "deck order",
+			cards: []*Card{
+				card("a", func(c *Card) {
+					c.Queue = QueueReview
+					c.Interval = 10 * Day
+					c.Due = parseDue("2017-01-05")
+				}),
+				card("b", nil),
+				card("c", func(c *Card) {
+					c.Queue = QueueReview
+					c.Interval = 10 * Day
+					c.Due = parseDue("2016-12-25")
+				}),
+			},
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name: "due learning first",
+			cards: []*Card{
+				card("a", nil),
+				card("b", func(c *Card) {
+					c.Queue = QueueRelearning
+					c.Due = parseDue("2016-12-31 23:58:00")
+				}),
+				card("c", func(c *Card) {
+					c.Queue = QueueLearning
+					c.Due = parseDue("2016-12-31 23:50:00")
+				}),
+				card("d", func(c *Card) {
+					c.Queue = QueueLearning
+					c.Due = parseDue("2017-01-01 00:10:00")
+				}),
+			},
+			expected: []string{"c", "b", "a"},
+		},
+		{
+			name: "skipped cards",
+			cards: []*Card{
+				card("a", nil),
+				card("b", func(c *Card) { c.Suspended = true }),
+				card("c", func(c *Card) { c.BuriedUntil = parseDue("2017-01-02") }),
+				card("d", func(c *Card) {
+					c.Deck = "deck-AQ"
+					c.HomeDeck = ""
+				}),
+			},
+			expected: []string{"a"},
+		},
+		{
+			name: "limit",
+			cards: []*Card{
+				card("a", nil),
+				card("b", nil),
+				card("c", nil),
+			},
+			opts:     StudyOptions{Limit: 2},
+			expected: []string{"a", "b"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fd := &FilteredDeck{ID: "fdeck-AQ"}
+			cards := make(map[string]*Card)
+			for _, c := range test.cards {
+				fd.Cards = append(fd.Cards, c.ID)
+				cards[c.ID] = c
+			}
+			lookup := test.lookup
+			if lookup == nil {
+				lookup = func(id string) (*Card, error) {
+					return cards[id], nil
+				}
+			}
+			result, err := fd.BuildStudyQueue(lookup, test.opts)
+			checkErr(t, test.err, err)
+			if err != nil {
+				return
+			}
+			var ids []string
+			for _, c := range result {
+				ids = append(ids, c.ID[len("card-abcd.note"):len(c.ID)-2])
+			}
+			if d := diff.Interface(test.expected, ids); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
+
+func TestInterleave(t *testing.T) {
+	cards := func(ids ...string) []*Card {
+		var result []*Card
+		for _, id := range ids {
+			result = append(result, &Card{ID: id})
+		}
+		return result
+	}
+	tests := []struct {
+		name     string
+		reviews  []*Card
+		news     []*Card
+		expected []*Card
+	}{
+		{
+			name:     "no new cards",
+			reviews:  cards("r1", "r2"),
+			expected: cards("r1", "r2"),
+		},
+		{
+			name:     "no reviews",
+			news:     cards("n1", "n2"),
+			expected: cards("n1", "n2"),
+		},
+		{
+			name:     "more new cards than reviews",
+			reviews:  cards("r1"),
+			news:     cards("n1", "n2", "n3"),
+			expected: cards("n1", "r1", "n2", "n3"),
+		},
+		{
+			name:     "one new card",
+			reviews:  cards("r1", "r2", "r3", "r4"),
+			news:     cards("n1"),
+			expected: cards("r1", "r2", "n1", "r3", "r4"),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := interleave(test.reviews, test.news)
+			if d := diff.Interface(test.expected, result); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}
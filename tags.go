@@ -0,0 +1,170 @@
+package fb
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// TagSeparator separates the levels of a hierarchical tag, as in Anki. The
+// tag "spanish::verbs" is a child of the tag "spanish".
+const TagSeparator = "::"
+
+// NormalizeTag returns the canonical spelling of a tag. Surrounding space is
+// removed from each level of the tag, empty levels are dropped, and any
+// remaining whitespace is replaced with underscores, as tags may not contain
+// spaces. An empty string is returned if nothing remains of the tag.
+func NormalizeTag(tag string) string {
+	parts := strings.Split(tag, TagSeparator)
+	levels := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if level := strings.Join(strings.Fields(part), "_"); level != "" {
+			levels = append(levels, level)
+		}
+	}
+	return strings.Join(levels, TagSeparator)
+}
+
+// tagKey returns the key by which tags are compared, which is the lower-case
+// normalized tag.
+func tagKey(tag string) string {
+	return strings.ToLower(NormalizeTag(tag))
+}
+
+// isUnderTag returns true if key is the same as, or a descendant of, parent.
+// Both must be tag keys.
+func isUnderTag(key, parent string) bool {
+	return key == parent || strings.HasPrefix(key, parent+TagSeparator)
+}
+
+// TagSet is a set of tags. Tags are normalized when added, and compared
+// case-insensitively; the set keeps the spelling of each tag as it was first
+// added. A nil *TagSet is a valid, empty set, but cannot be added to.
+type TagSet struct {
+	tags map[string]string
+}
+
+// NewTagSet returns a new TagSet containing the provided tags.
+func NewTagSet(tags ...string) *TagSet {
+	ts := &TagSet{tags: make(map[string]string, len(tags))}
+	ts.Add(tags...)
+	return ts
+}
+
+// Add adds the provided tags to the set. Tags which normalize to an empty
+// string, or which are already in the set, are ignored.
+func (ts *TagSet) Add(tags ...string) {
+	if ts.tags == nil {
+		ts.tags = make(map[string]string, len(tags))
+	}
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if tag == "" {
+			continue
+		}
+		key := strings.ToLower(tag)
+		if _, ok := ts.tags[key]; !ok {
+			ts.tags[key] = tag
+		}
+	}
+}
+
+// Remove removes the provided tags from the set. Descendants of the tags are
+// not removed.
+func (ts *TagSet) Remove(tags ...string) {
+	if ts == nil {
+		return
+	}
+	for _, tag := range tags {
+		delete(ts.tags, tagKey(tag))
+	}
+}
+
+// Len returns the number of tags in the set.
+func (ts *TagSet) Len() int {
+	if ts == nil {
+		return 0
+	}
+	return len(ts.tags)
+}
+
+// Has returns true if the set contains tag.
+func (ts *TagSet) Has(tag string) bool {
+	if ts == nil {
+		return false
+	}
+	_, ok := ts.tags[tagKey(tag)]
+	return ok
+}
+
+// HasUnder returns true if the set contains tag, or any tag beneath it in
+// the hierarchy. For example, a set containing "spanish::verbs" is under
+// both "spanish" and "spanish::verbs", but not under "span".
+func (ts *TagSet) HasUnder(tag string) bool {
+	if ts == nil {
+		return false
+	}
+	parent := tagKey(tag)
+	if parent == "" {
+		return false
+	}
+	for key := range ts.tags {
+		if isUnderTag(key, parent) {
+			return true
+		}
+	}
+	return false
+}
+
+// All returns all of the tags in the set, in case-insensitive order.
+func (ts *TagSet) All() []string {
+	if ts == nil {
+		return []string{}
+	}
+	keys := make([]string, 0, len(ts.tags))
+	for key := range ts.tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	tags := make([]string, len(keys))
+	for i, key := range keys {
+		tags[i] = ts.tags[key]
+	}
+	return tags
+}
+
+// Union returns a new set containing the tags of both sets. Where both sets
+// contain a tag, the spelling from ts is kept.
+func (ts *TagSet) Union(other *TagSet) *TagSet {
+	union := NewTagSet(ts.All()...)
+	union.Add(other.All()...)
+	return union
+}
+
+// MarshalJSON implements the json.Marshaler interface for the TagSet type.
+func (ts *TagSet) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ts.All())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface for the TagSet
+// type.
+func (ts *TagSet) UnmarshalJSON(data []byte) error {
+	var tags []string
+	if err := json.Unmarshal(data, &tags); err != nil {
+		return err
+	}
+	*ts = *NewTagSet(tags...)
+	return nil
+}
+
+// NotesUnderTag returns the notes which have tag, or any tag beneath it in
+// the hierarchy, in their original order.
+func NotesUnderTag(notes []*Note, tag string) []*Note {
+	var result []*Note
+	for _, n := range notes {
+		if n.Tags.HasUnder(tag) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
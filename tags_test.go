@@ -0,0 +1,102 @@
+package fb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/flimzy/diff"
+)
+
+func TestNormalizeTag(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "", expected: ""},
+		{input: "   ", expected: ""},
+		{input: "verbs", expected: "verbs"},
+		{input: " Spanish :: Verbs ", expected: "Spanish::Verbs"},
+		{input: "::a::::b::", expected: "a::b"},
+		{input: "chapter one::part  two", expected: "chapter_one::part_two"},
+		{input: ":: ::", expected: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			if result := NormalizeTag(test.input); result != test.expected {
+				t.Errorf("Unexpected result: %q", result)
+			}
+		})
+	}
+}
+
+func TestTagSet(t *testing.T) {
+	ts := NewTagSet("Spanish::Verbs", "spanish::verbs", "", "Chapter::1::Intro", "misc")
+	if d := diff.Interface([]string{"Chapter::1::Intro", "misc", "Spanish::Verbs"}, ts.All()); d != nil {
+		t.Error(d)
+	}
+	tests := []struct {
+		tag      string
+		has      bool
+		hasUnder bool
+	}{
+		{tag: "spanish::VERBS", has: true, hasUnder: true},
+		{tag: "spanish", hasUnder: true},
+		{tag: "span"},
+		{tag: "chapter::1", hasUnder: true},
+		{tag: " Chapter :: 1 :: Intro ", has: true, hasUnder: true},
+		{tag: "chapter::1::intro::more"},
+		{tag: ""},
+	}
+	for _, test := range tests {
+		t.Run(test.tag, func(t *testing.T) {
+			if has := ts.Has(test.tag); has != test.has {
+				t.Errorf("Has: %t", has)
+			}
+			if hasUnder := ts.HasUnder(test.tag); hasUnder != test.hasUnder {
+				t.Errorf("HasUnder: %t", hasUnder)
+			}
+		})
+	}
+	ts.Remove("MISC", "chapter")
+	if d := diff.Interface([]string{"Chapter::1::Intro", "Spanish::Verbs"}, ts.All()); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestNilTagSet(t *testing.T) {
+	var ts *TagSet
+	if ts.Len() != 0 || ts.Has("foo") || ts.HasUnder("foo") {
+		t.Error("Expected an empty set")
+	}
+	ts.Remove("foo")
+	if d := diff.Interface([]string{"foo"}, ts.Union(NewTagSet("foo")).All()); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestTagSetJSON(t *testing.T) {
+	ts := &TagSet{}
+	if err := json.Unmarshal([]byte(`["b", "A::x", "a::X", "  "]`), ts); err != nil {
+		t.Fatal(err)
+	}
+	if d := diff.AsJSON(json.RawMessage(`["A::x", "b"]`), ts); d != nil {
+		t.Error(d)
+	}
+	checkErr(t, "json: cannot unmarshal object into Go value of type []string", json.Unmarshal([]byte(`{}`), ts))
+}
+
+func TestNotesUnderTag(t *testing.T) {
+	notes := []*Note{
+		{ID: "note-MQ", Tags: NewTagSet("chapter::1")},
+		{ID: "note-Mg"},
+		{ID: "note-Mw", Tags: NewTagSet("chapter::2::a")},
+		{ID: "note-NA", Tags: NewTagSet("chapters")},
+	}
+	var ids []string
+	for _, n := range NotesUnderTag(notes, "Chapter") {
+		ids = append(ids, n.ID)
+	}
+	if d := diff.Interface([]string{"note-MQ", "note-Mw"}, ids); d != nil {
+		t.Error(d)
+	}
+}
@@ -2,6 +2,7 @@ package fb
 
 import (
 	"encoding/json"
+	"fmt"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -34,42 +35,53 @@ type Theme struct {
 // appears valid and self consistent. A nil return value means no errors were
 // detected.
 func (t *Theme) Validate() error {
+	return t.ValidateAll().Err()
+}
+
+// ValidateAll validates the theme as Validate does, but reports every problem
+// found, rather than only the first.
+func (t *Theme) ValidateAll() *ValidationReport {
+	v := newReporter()
+	t.validate(v)
+	return v.report
+}
+
+func (t *Theme) validate(v *reporter) {
 	if t.ID == "" {
-		return errors.New("id required")
-	}
-	if err := validateDocID(t.ID); err != nil {
-		return err
-	}
-	if !strings.HasPrefix(t.ID, "theme-") {
-		return errors.New("incorrect doc type")
+		v.errorf("_id", ProblemRequired, "id required")
+	} else if err := validateDocID(t.ID); err != nil {
+		v.error("_id", ProblemInvalidID, err)
+	} else if !strings.HasPrefix(t.ID, "theme-") {
+		v.errorf("_id", ProblemInvalidID, "incorrect doc type")
 	}
 	if t.Created.IsZero() {
-		return errors.New("created time required")
+		v.errorf("created", ProblemRequired, "created time required")
 	}
 	if t.Modified.IsZero() {
-		return errors.New("modified time required")
+		v.errorf("modified", ProblemRequired, "modified time required")
 	}
 	if t.Attachments == nil {
-		return errors.New("attachments collection must not be nil")
+		v.errorf("_attachments", ProblemRequired, "attachments collection must not be nil")
 	}
 	if t.Files == nil {
-		return errors.New("file list must not be nil")
-	}
-	if !t.Attachments.hasMemberView(t.Files) {
-		return errors.New("file list must be a member of attachments collection")
-	}
-	for _, m := range t.Models {
-		if t.ModelSequence <= m.ID {
-			return errors.New("modelSequence must be larger than existing model IDs")
+		v.errorf("files", ProblemRequired, "file list must not be nil")
+	} else if t.Attachments != nil && !t.Attachments.hasMemberView(t.Files) {
+		v.errorf("files", ProblemInconsistent, "file list must be a member of attachments collection")
+	}
+	for i, m := range t.Models {
+		mv := v.atIndex("models", i)
+		if m == nil {
+			mv.errorf("", ProblemRequired, "model %d is nil", i)
+			continue
 		}
-		if !t.Attachments.hasMemberView(m.Files) {
-			return errors.Errorf("model %d file list must be a member of attachments collection", m.ID)
+		if t.ModelSequence <= m.ID {
+			v.errorf("modelSequence", ProblemInconsistent, "modelSequence must be larger than existing model IDs")
 		}
-		if err := m.Validate(); err != nil {
-			return errors.Wrap(err, "invalid model")
+		if t.Attachments != nil && !t.Attachments.hasMemberView(m.Files) {
+			mv.errorf("files", ProblemInconsistent, "model %d file list must be a member of attachments collection", m.ID)
 		}
+		m.validate(mv.wrap("invalid model"))
 	}
-	return nil
 }
 
 // NewTheme returns a new, bare-bones theme, with the specified ID.
@@ -127,29 +139,43 @@ func (t *Theme) NewModel(mType string) (*Model, error) {
 
 // UnmarshalJSON implements the json.Unmarshaler interface for the Theme type.
 func (t *Theme) UnmarshalJSON(data []byte) error {
+	_, err := t.unmarshal(data)
+	return err
+}
+
+// unmarshal decodes the theme as UnmarshalJSON does, and returns a
+// description of each change made in migrating its models from older forms.
+func (t *Theme) unmarshal(data []byte) ([]string, error) {
 	doc := &themeAlias{}
 	if err := json.Unmarshal(data, doc); err != nil {
-		return errors.Wrap(err, "failed to unmarshal Theme")
+		return nil, errors.Wrap(err, "failed to unmarshal Theme")
 	}
 	*t = Theme(*doc)
 
 	if t.Attachments == nil {
-		return errors.New("invalid theme: no attachments")
+		return nil, errors.New("invalid theme: no attachments")
 	}
 	if t.Files == nil {
-		return errors.New("invalid theme: no file list")
+		return nil, errors.New("invalid theme: no file list")
 	}
 
 	if err := t.Attachments.AddView(t.Files); err != nil {
-		return err
+		return nil, err
 	}
+	var changes []string
 	for _, m := range t.Models {
 		if err := t.Attachments.AddView(m.Files); err != nil {
-			return err
+			return nil, err
 		}
 		m.Theme = t
+		for _, change := range m.migrateTemplates() {
+			changes = append(changes, fmt.Sprintf("model %d: %s", m.ID, change))
+		}
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
 	}
-	return t.Validate()
+	return changes, nil
 }
 
 // NextModelSequence returns the next available model sequence, while also
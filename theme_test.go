@@ -269,6 +269,51 @@ func TestThemeUnmarshalJSON(t *testing.T) {
 				return theme
 			}(),
 		},
+		{
+			name: "legacy template missing answer",
+			input: `{"_id":"theme-abcd", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "modelSequence":1, "files":[],
+				"_attachments": {"Card 1.question.html": {"content_type":"text/html", "data":"e3tGcm9udH19"}},
+				"models": [{"id":0, "modelType":"foo", "files":["Card 1.question.html"], "templates":["Card 1"]}]}`,
+			expected: func() *Theme {
+				theme, _ := NewTheme("theme-abcd")
+				theme.Created = now()
+				theme.Modified = now()
+				theme.ModelSequence = 1
+				m := &Model{
+					Theme:     theme,
+					Type:      "foo",
+					Files:     theme.Attachments.NewView(),
+					Templates: []*Template{{Name: "Card 1", Question: "{{Front}}"}},
+				}
+				theme.Models = []*Model{m}
+				return theme
+			}(),
+		},
+		{
+			name: "legacy templates",
+			input: `{"_id":"theme-abcd", "created":"2017-01-01T00:00:00Z", "modified":"2017-01-01T00:00:00Z", "modelSequence":1, "files":[],
+				"_attachments": {
+					"Card 1.question.html": {"content_type":"text/html", "data":"e3tGcm9udH19"},
+					"Card 1.answer.html": {"content_type":"text/html", "data":"e3tCYWNrfX0="},
+					"foo.png": {"content_type":"image/png", "data":"cG5n"}
+				},
+				"models": [{"id":0, "modelType":"foo", "files":["Card 1.question.html", "Card 1.answer.html", "foo.png"], "templates":["Card 1"]}]}`,
+			expected: func() *Theme {
+				theme, _ := NewTheme("theme-abcd")
+				theme.Created = now()
+				theme.Modified = now()
+				theme.ModelSequence = 1
+				m := &Model{
+					Theme:     theme,
+					Type:      "foo",
+					Files:     theme.Attachments.NewView(),
+					Templates: []*Template{{Name: "Card 1", Question: "{{Front}}", Answer: "{{Back}}"}},
+				}
+				m.Files.SetFile("foo.png", "image/png", []byte("png"))
+				theme.Models = []*Model{m}
+				return theme
+			}(),
+		},
 	}
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
@@ -311,7 +356,7 @@ func TestThemeNewModel(t *testing.T) {
 				theme.ModelSequence = 1
 				model := &Model{
 					Type:      "chicken",
-					Templates: []string{},
+					Templates: []*Template{},
 					Fields:    []*Field{},
 					Files:     theme.Attachments.NewView(),
 					Theme:     theme,
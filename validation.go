@@ -0,0 +1,193 @@
+package fb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Severity is the severity of a validation problem.
+type Severity int
+
+const (
+	// SeverityError indicates a problem which makes the document invalid.
+	SeverityError Severity = iota
+	// SeverityWarning indicates a problem which does not make the document
+	// invalid, but which is likely a mistake.
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	}
+	return "unknown severity " + strconv.Itoa(int(s))
+}
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// ProblemCode identifies the kind of a validation problem, in a form suitable
+// for programmatic use.
+type ProblemCode string
+
+// The validation problem codes.
+const (
+	// ProblemRequired indicates that a required value is missing.
+	ProblemRequired ProblemCode = "required"
+	// ProblemInvalidID indicates a malformed document ID, or one of the wrong
+	// document type.
+	ProblemInvalidID ProblemCode = "invalid_id"
+	// ProblemInvalidValue indicates a value which is out of range, or
+	// otherwise malformed.
+	ProblemInvalidValue ProblemCode = "invalid_value"
+	// ProblemInconsistent indicates values which conflict with each other.
+	ProblemInconsistent ProblemCode = "inconsistent"
+	// ProblemDuplicate indicates a value which must be unique, but is not.
+	ProblemDuplicate ProblemCode = "duplicate"
+	// ProblemMissingReference indicates a reference to a document which
+	// could not be found.
+	ProblemMissingReference ProblemCode = "missing_reference"
+	// ProblemOrphaned indicates a document which should be, but is not,
+	// referred to by another document, such as a card which is in no deck.
+	ProblemOrphaned ProblemCode = "orphaned"
+)
+
+// Problem describes a single problem found by validation.
+type Problem struct {
+	// Path locates the offending document and field, using their JSON names,
+	// such as "notes[12].fieldValues[3]". It is empty when the problem is
+	// with the validated document as a whole.
+	Path     string      `json:"path,omitempty"`
+	Severity Severity    `json:"severity"`
+	Code     ProblemCode `json:"code"`
+	// Message is the human-readable description of the problem, as it would
+	// be returned by Validate.
+	Message string `json:"message"`
+	// err is the error returned by Err, which may wrap an underlying cause.
+	err error
+}
+
+func (p *Problem) String() string {
+	if p.Path == "" {
+		return fmt.Sprintf("%s: %s (%s)", p.Severity, p.Message, p.Code)
+	}
+	return fmt.Sprintf("%s: %s: %s (%s)", p.Severity, p.Path, p.Message, p.Code)
+}
+
+// ValidationReport holds all of the problems found by validating a document,
+// as returned by the ValidateAll methods.
+type ValidationReport struct {
+	Problems []*Problem `json:"problems"`
+}
+
+// Errors returns the problems which make the document invalid.
+func (r *ValidationReport) Errors() []*Problem {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the problems which do not make the document invalid.
+func (r *ValidationReport) Warnings() []*Problem {
+	return r.filter(SeverityWarning)
+}
+
+func (r *ValidationReport) filter(s Severity) []*Problem {
+	var problems []*Problem
+	for _, p := range r.Problems {
+		if p.Severity == s {
+			problems = append(problems, p)
+		}
+	}
+	return problems
+}
+
+// Err returns the first error in the report, which is the one Validate
+// would return, or nil if there are no errors.
+func (r *ValidationReport) Err() error {
+	for _, p := range r.Problems {
+		if p.Severity == SeverityError {
+			if p.err != nil {
+				return p.err
+			}
+			return errors.New(p.Message)
+		}
+	}
+	return nil
+}
+
+// reporter adds problems to a report. Each problem is located relative to
+// the path of the reporter, and its message follows the prefixes of any
+// enclosing documents.
+type reporter struct {
+	report *ValidationReport
+	path   string
+	prefix string
+}
+
+func newReporter() *reporter {
+	return &reporter{report: &ValidationReport{}}
+}
+
+// at returns a reporter for the named field.
+func (v *reporter) at(field string) *reporter {
+	return &reporter{report: v.report, path: joinPath(v.path, field), prefix: v.prefix}
+}
+
+// atIndex returns a reporter for the i'th element of the named field.
+func (v *reporter) atIndex(field string, i int) *reporter {
+	return v.at(field + "[" + strconv.Itoa(i) + "]")
+}
+
+// wrap returns a reporter which prefixes messages with the formatted text,
+// in the way of errors.Wrapf.
+func (v *reporter) wrap(format string, args ...interface{}) *reporter {
+	return &reporter{report: v.report, path: v.path, prefix: v.prefix + fmt.Sprintf(format, args...) + ": "}
+}
+
+// add adds err as a problem for the named field, prefixed as the reporter's
+// messages are.
+func (v *reporter) add(severity Severity, field string, code ProblemCode, err error) {
+	if v.prefix != "" {
+		err = errors.Wrap(err, strings.TrimSuffix(v.prefix, ": "))
+	}
+	v.report.Problems = append(v.report.Problems, &Problem{
+		Path:     joinPath(v.path, field),
+		Severity: severity,
+		Code:     code,
+		Message:  err.Error(),
+		err:      err,
+	})
+}
+
+// errorf adds an error for the named field, which may be empty.
+func (v *reporter) errorf(field string, code ProblemCode, format string, args ...interface{}) {
+	v.add(SeverityError, field, code, errors.Errorf(format, args...))
+}
+
+// error adds err as an error for the named field, which may be empty. The
+// error returned by the report's Err method then has err as its cause.
+func (v *reporter) error(field string, code ProblemCode, err error) {
+	v.add(SeverityError, field, code, err)
+}
+
+// warnf adds a warning for the named field, which may be empty.
+func (v *reporter) warnf(field string, code ProblemCode, format string, args ...interface{}) {
+	v.add(SeverityWarning, field, code, errors.Errorf(format, args...))
+}
+
+func joinPath(path, field string) string {
+	switch {
+	case field == "":
+		return path
+	case path == "" || strings.HasPrefix(field, "["):
+		return path + field
+	}
+	return path + "." + field
+}
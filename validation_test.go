@@ -1,6 +1,11 @@
 package fb
 
-import "testing"
+import (
+	"testing"
+
+	"github.com/flimzy/diff"
+	"github.com/pkg/errors"
+)
 
 type validator interface {
 	Validate() error
@@ -20,3 +25,152 @@ func testValidation(t *testing.T, tests []validationTest) {
 		})
 	}
 }
+
+func TestValidationReport(t *testing.T) {
+	r := &ValidationReport{
+		Problems: []*Problem{
+			{Path: "cards[0]", Severity: SeverityWarning, Code: ProblemMissingReference, Message: "foo"},
+			{Path: "cards[1]._id", Severity: SeverityError, Code: ProblemRequired, Message: "bar"},
+			{Severity: SeverityError, Code: ProblemInvalidValue, Message: "baz"},
+		},
+	}
+	checkErr(t, "bar", r.Err())
+	if d := diff.Interface(r.Problems[1:], r.Errors()); d != nil {
+		t.Error(d)
+	}
+	if d := diff.Interface(r.Problems[:1], r.Warnings()); d != nil {
+		t.Error(d)
+	}
+	expected := []string{
+		"warning: cards[0]: foo (missing_reference)",
+		"error: cards[1]._id: bar (required)",
+		"error: baz (invalid_value)",
+	}
+	for i, p := range r.Problems {
+		if s := p.String(); s != expected[i] {
+			t.Errorf("Unexpected string for problem %d: %s", i, s)
+		}
+	}
+	if err := (&ValidationReport{Problems: r.Problems[:1]}).Err(); err != nil {
+		t.Errorf("Warnings should not be errors: %s", err)
+	}
+	if d := diff.AsJSON(map[string]string{"path": "cards[0]", "severity": "warning", "code": "missing_reference", "message": "foo"}, r.Problems[0]); d != nil {
+		t.Error(d)
+	}
+}
+
+func TestValidationReportErrCause(t *testing.T) {
+	cause := errors.New("foo")
+	v := newReporter()
+	v.atIndex("decks", 0).wrap("deck '%s' validation", "deck-Zm9v").error("_id", ProblemInvalidID, cause)
+	err := v.report.Err()
+	checkErr(t, "deck 'deck-Zm9v' validation: foo", err)
+	if errors.Cause(err) != cause {
+		t.Errorf("Unexpected cause: %v", errors.Cause(err))
+	}
+}
+
+func TestValidateAll(t *testing.T) {
+	tests := []struct {
+		name     string
+		v        interface{ ValidateAll() *ValidationReport }
+		expected []*Problem
+	}{
+		{
+			name: "card",
+			v:    &Card{ModelID: "foo", Queue: 99, LearningStep: -1},
+			expected: []*Problem{
+				{Path: "_id", Code: ProblemRequired, Message: "id required"},
+				{Path: "created", Code: ProblemRequired, Message: "created time required"},
+				{Path: "modified", Code: ProblemRequired, Message: "modified time required"},
+				{Path: "model", Code: ProblemInvalidID, Message: "invalid theme ID type"},
+				{Path: "state", Code: ProblemInvalidValue, Message: "invalid queue 99"},
+				{Path: "learningStep", Code: ProblemInvalidValue, Message: "learning step must not be negative"},
+			},
+		},
+		{
+			name: "deck",
+			v: &Deck{ID: "card-Zm9v", Created: now(), Modified: now(), ConfigID: "deck-Zm9v",
+				Cards: &CardCollection{col: map[string]struct{}{"card-a.b.0": {}, "foo": {}}}},
+			expected: []*Problem{
+				{Path: "_id", Code: ProblemInvalidID, Message: "incorrect doc type"},
+				{Path: "config", Code: ProblemInvalidID, Message: "invalid config ID: incorrect doc type"},
+				{Path: "cards[1]", Code: ProblemInvalidID, Message: "'foo': invalid ID type"},
+			},
+		},
+		{
+			name: "theme",
+			v: func() *Theme {
+				th, _ := NewTheme("theme-Zm9v")
+				m, _ := th.NewModel("foo")
+				m.Type = ""
+				m.Templates = []*Template{{}, {Name: "Card 1"}, {Name: "Card 1"}}
+				th.ModelSequence = 0
+				return th
+			}(),
+			expected: []*Problem{
+				{Path: "modelSequence", Code: ProblemInconsistent, Message: "modelSequence must be larger than existing model IDs"},
+				{Path: "models[0].modelType", Code: ProblemRequired, Message: "invalid model: type is required"},
+				{Path: "models[0].templates[0].name", Code: ProblemRequired, Message: "invalid model: invalid template 0: name is required"},
+				{Path: "models[0].templates[2].name", Code: ProblemDuplicate, Message: "invalid model: duplicate template name 'Card 1'"},
+			},
+		},
+		{
+			name: "note",
+			v: func() *Note {
+				th, _ := NewTheme("theme-Zm9v")
+				m, _ := th.NewModel("foo")
+				_ = m.AddField(TextField, "Front")
+				_ = m.AddField(AudioField, "Audio")
+				return &Note{ID: "deck-Zm9v", Model: m, ThemeID: th.ID, Attachments: NewFileCollection(),
+					FieldValues: []*FieldValue{{Text: "foo"}, {Text: "bar"}}}
+			}(),
+			expected: []*Problem{
+				{Path: "_id", Code: ProblemInvalidID, Message: "incorrect doc type"},
+				{Path: "created", Code: ProblemRequired, Message: "created time required"},
+				{Path: "modified", Code: ProblemRequired, Message: "modified time required"},
+				{Path: "fieldValues[1]", Code: ProblemInvalidValue, Message: "audio field 1 must not have text"},
+			},
+		},
+		{
+			name: "package",
+			v: &Package{
+				Bundle: &Bundle{ID: "bundle-mzxw6", Owner: "mjxwe", Created: now(), Modified: now()},
+				Decks: []*Deck{
+					{ID: "deck-AQID", Created: now(), Modified: now(), ConfigID: "dconf-Zm9v",
+						Cards: &CardCollection{col: map[string]struct{}{"card-a.b.0": {}, "card-a.c.0": {}}}},
+					{ID: "deck-AQIE", Created: now(), Modified: now(),
+						Cards: &CardCollection{col: map[string]struct{}{"card-a.b.0": {}}}},
+				},
+				Cards: []*Card{
+					{ID: "card-a.b.0", ModelID: "theme-Zm9v/0", Created: now(), Modified: now()},
+					{ID: "card-a.d.0", ModelID: "theme-Zm9v/0", Created: now(), Modified: now()},
+					{ID: "card-a.e.0", ModelID: "theme-Zm9v/0", Created: now(), Modified: now()},
+				},
+				Notes: []*Note{
+					{ID: "note-b", ThemeID: "theme-Zm9v", Created: now(), Modified: now(), Attachments: NewFileCollection()},
+				},
+				Reviews: []*Review{{CardID: "card-a.f.0", Timestamp: now()}},
+			},
+			expected: []*Problem{
+				{Path: "decks[0].config", Code: ProblemMissingReference, Message: "deck config 'dconf-Zm9v' used by deck 'deck-AQID' not found in package"},
+				{Path: "decks[0].cards[1]", Code: ProblemMissingReference, Message: "card 'card-a.c.0' listed in deck, but not found in package"},
+				{Path: "decks[1].cards[0]", Code: ProblemDuplicate, Message: "card 'card-a.b.0' listed in decks 'deck-AQID' and 'deck-AQIE'"},
+				{Path: "cards[1]", Code: ProblemOrphaned, Message: "card 'card-a.d.0' found in package, but not in a deck"},
+				{Path: "cards[2]", Code: ProblemOrphaned, Message: "card 'card-a.e.0' found in package, but not in a deck"},
+				{Path: "notes[0].model", Code: ProblemMissingReference, Message: "note 'note-b' has no matching model (theme-Zm9v/0)"},
+				{Path: "cards[1]._id", Severity: SeverityWarning, Code: ProblemMissingReference, Message: "note 'note-d' of card 'card-a.d.0' not found in package"},
+				{Path: "cards[2]._id", Severity: SeverityWarning, Code: ProblemMissingReference, Message: "note 'note-e' of card 'card-a.e.0' not found in package"},
+				{Path: "reviews[0].cardID", Severity: SeverityWarning, Code: ProblemMissingReference, Message: "card 'card-a.f.0' of review not found in package"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := test.v.ValidateAll()
+			if d := diff.AsJSON(test.expected, result.Problems); d != nil {
+				t.Error(d)
+			}
+		})
+	}
+}